@@ -0,0 +1,172 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+	"library-api/logger"
+)
+
+// Stable, machine-readable error codes. Clients branch on these, so never
+// change one once released; add a new code instead.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidToken       = "invalid_token"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodePreconditionNeeded = "precondition_required"
+	CodeBodyTooLarge       = "body_too_large"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+)
+
+// Logger receives the causes of internal errors, which clients never see.
+var Logger *logger.AsyncLogger
+
+// Error is an error with everything needed to answer a request with it.
+// Detail is shown to clients; Err, the underlying cause, is not.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Errors []FieldError // Per-field problems, for validation errors
+	// Location points at a related resource, such as the existing record
+	// behind a conflict. It is sent as the Location header too.
+	Location string
+	Err      error
+}
+
+// FieldError is one invalid field. Field is the JSON name, or the path or
+// query parameter name; nested fields are dotted, e.g. audience.role, and
+// list items indexed, e.g. contributors[0].role.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// Wrap keeps err as the cause, for logs and errors.Is.
+func Wrap(err error, status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail, Err: err}
+}
+
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeInvalidRequest, detail)
+}
+
+func Validation(detail string) *Error {
+	return New(http.StatusUnprocessableEntity, CodeValidationFailed, detail)
+}
+
+// InvalidFields is a 422 listing every invalid body field.
+func InvalidFields(errs []FieldError) *Error {
+	return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidationFailed, Detail: "The request has invalid fields", Errors: errs}
+}
+
+// InvalidParams is a 400 listing every invalid path or query parameter.
+func InvalidParams(errs []FieldError) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "The request has invalid parameters", Errors: errs}
+}
+
+func Unauthorized(code, detail string) *Error {
+	return New(http.StatusUnauthorized, code, detail)
+}
+
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// NotFound uses codes like book_not_found for the given resource.
+func NotFound(resource, detail string) *Error {
+	return New(http.StatusNotFound, resource+"_not_found", detail)
+}
+
+func Conflict(code, detail string) *Error {
+	return New(http.StatusConflict, code, detail)
+}
+
+// PreconditionFailed answers a write whose If-Match no longer matches.
+func PreconditionFailed(detail string) *Error {
+	return New(http.StatusPreconditionFailed, CodePreconditionFailed, detail)
+}
+
+// PreconditionRequired answers a write that should have sent If-Match.
+func PreconditionRequired(detail string) *Error {
+	return New(http.StatusPreconditionRequired, CodePreconditionNeeded, detail)
+}
+
+func Internal(err error) *Error {
+	return Wrap(err, http.StatusInternalServerError, CodeInternal, "An unexpected error occurred")
+}
+
+// Problem is an RFC 7807 problem details document.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Location string       `json:"location,omitempty"`
+}
+
+// From turns any error into an *Error. Errors that aren't one already are
+// internal, except a missing GORM record, which is a generic not found.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Wrap(err, http.StatusNotFound, CodeNotFound, "The requested resource was not found")
+	}
+	return Internal(err)
+}
+
+// Write answers the request with err as application/problem+json.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := From(err)
+	if appErr.Status >= 500 && Logger != nil {
+		Logger.Log(fmt.Sprintf("%s %s: %v", r.Method, r.URL.Path, appErr))
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if appErr.Location != "" {
+		w.Header().Set("Location", appErr.Location)
+	}
+	w.WriteHeader(appErr.Status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(appErr.Status),
+		Status:   appErr.Status,
+		Detail:   appErr.Detail,
+		Instance: r.URL.Path,
+		Code:     appErr.Code,
+		Errors:   appErr.Errors,
+		Location: appErr.Location,
+	})
+}
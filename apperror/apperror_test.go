@@ -0,0 +1,64 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func write(err error) (*httptest.ResponseRecorder, Problem) {
+	rec := httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodGet, "/books/7", nil), err)
+	var problem Problem
+	json.Unmarshal(rec.Body.Bytes(), &problem)
+	return rec, problem
+}
+
+func TestWrite_AppError(t *testing.T) {
+	rec, problem := write(NotFound("book", "Book not found"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, Problem{
+		Type:     "about:blank",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "Book not found",
+		Instance: "/books/7",
+		Code:     "book_not_found",
+	}, problem)
+}
+
+func TestWrite_WrappedAppErrorKeepsItsCode(t *testing.T) {
+	err := fmt.Errorf("saving: %w", Conflict("username_taken", "Username is taken"))
+	rec, problem := write(err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "username_taken", problem.Code)
+}
+
+func TestWrite_Location(t *testing.T) {
+	err := Conflict("isbn_taken", "Book 3 already has ISBN 9780306406157")
+	err.Location = "/books/3"
+	rec, problem := write(err)
+	assert.Equal(t, "/books/3", rec.Header().Get("Location"))
+	assert.Equal(t, "/books/3", problem.Location)
+}
+
+func TestWrite_UnknownErrorsDontLeak(t *testing.T) {
+	rec, problem := write(errors.New("Error 1054: Unknown column 'titel' in 'field list'"))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, CodeInternal, problem.Code)
+	assert.NotContains(t, rec.Body.String(), "titel")
+}
+
+func TestFrom_RecordNotFound(t *testing.T) {
+	err := From(fmt.Errorf("find: %w", gorm.ErrRecordNotFound))
+	assert.Equal(t, http.StatusNotFound, err.Status)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
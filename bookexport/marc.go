@@ -0,0 +1,114 @@
+package bookexport
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"library-api/models"
+)
+
+// MARCNamespace is the MARC 21 XML schema namespace.
+const MARCNamespace = "http://www.loc.gov/MARC21/slim"
+
+// marcLeader describes a new record for a monograph (language material),
+// full level, Unicode, without ISBD punctuation. Record length and base
+// address only matter in binary MARC, so they are left as zeros.
+const marcLeader = "00000nam a2200000   4500"
+
+type marcRecord struct {
+	XMLName       xml.Name           `xml:"record"`
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// marcWriter writes a <collection> of records, one per book:
+//
+//	001  control number (the book ID)
+//	005  date and time of latest transaction
+//	020  ISBN, once for each form
+//	100  main entry, personal name (the author)
+//	245  title statement
+type marcWriter struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	started bool
+}
+
+func newMARCWriter(w io.Writer) *marcWriter {
+	return &marcWriter{w: w, enc: xml.NewEncoder(w)}
+}
+
+func (m *marcWriter) start() error {
+	if m.started {
+		return nil
+	}
+	m.started = true
+	_, err := io.WriteString(m.w, xml.Header+`<collection xmlns="`+MARCNamespace+`">`+"\n")
+	return err
+}
+
+func (m *marcWriter) Write(book *models.Book) error {
+	if err := m.start(); err != nil {
+		return err
+	}
+	record := marcRecord{
+		Leader: marcLeader,
+		ControlFields: []marcControlField{
+			{Tag: "001", Value: strconv.FormatUint(uint64(book.ID), 10)},
+			{Tag: "005", Value: book.UpdatedAt.UTC().Format("20060102150405") + ".0"},
+		},
+	}
+	for _, number := range []*string{book.ISBN13, book.ISBN10} {
+		if number != nil {
+			record.DataFields = append(record.DataFields, marcDataField{
+				Tag: "020", Ind1: " ", Ind2: " ",
+				Subfields: []marcSubfield{{Code: "a", Value: *number}},
+			})
+		}
+	}
+	// Title indicator 1 says whether there's a 1XX main entry to trace
+	titleInd1 := "0"
+	if book.Author != "" {
+		titleInd1 = "1"
+		record.DataFields = append(record.DataFields, marcDataField{
+			Tag: "100", Ind1: "1", Ind2: " ",
+			Subfields: []marcSubfield{{Code: "a", Value: book.Author}},
+		})
+	}
+	record.DataFields = append(record.DataFields, marcDataField{
+		Tag: "245", Ind1: titleInd1, Ind2: "0",
+		Subfields: []marcSubfield{{Code: "a", Value: book.Title}},
+	})
+	if err := m.enc.Encode(record); err != nil {
+		return err
+	}
+	_, err := io.WriteString(m.w, "\n")
+	return err
+}
+
+func (m *marcWriter) Close() error {
+	if err := m.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(m.w, "</collection>\n")
+	return err
+}
@@ -0,0 +1,151 @@
+// Package bookexport writes books as CSV, JSON Lines or MARCXML, one at a
+// time, so an export can be streamed straight to the client.
+package bookexport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"library-api/models"
+)
+
+// Formats an export can be in.
+const (
+	CSV     = "csv"
+	JSONL   = "jsonl"
+	MARCXML = "marcxml"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{CSV, JSONL, MARCXML}
+
+var ErrUnknownFormat = errors.New("format must be csv, jsonl or marcxml")
+
+// Writer encodes books. Close finishes the document and must be called
+// after the last book.
+type Writer interface {
+	Write(book *models.Book) error
+	Close() error
+}
+
+// NewWriter returns a Writer for format that writes to w.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w), nil
+	case JSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	case MARCXML:
+		return newMARCWriter(w), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ContentType is the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSONL:
+		return "application/x-ndjson"
+	case MARCXML:
+		return "application/marcxml+xml"
+	}
+	return "application/octet-stream"
+}
+
+// Extension is the file extension for format, without the dot.
+func Extension(format string) string {
+	if format == MARCXML {
+		return "xml"
+	}
+	return format
+}
+
+// Record is a book as CSV and JSONL exports describe it. The fields match
+// what bookimport reads back.
+type Record struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	ISBN13    string    `json:"isbn13,omitempty"`
+	ISBN10    string    `json:"isbn10,omitempty"`
+	Version   uint      `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewRecord(book *models.Book) Record {
+	return Record{
+		ID:        book.ID,
+		Title:     book.Title,
+		Author:    book.Author,
+		ISBN13:    deref(book.ISBN13),
+		ISBN10:    deref(book.ISBN10),
+		Version:   book.Version,
+		CreatedAt: book.CreatedAt.UTC(),
+		UpdatedAt: book.UpdatedAt.UTC(),
+	}
+}
+
+var csvHeader = []string{"id", "title", "author", "isbn13", "isbn10", "version", "created_at", "updated_at"}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(book *models.Book) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	r := NewRecord(book)
+	return c.w.Write([]string{
+		strconv.FormatUint(uint64(r.ID), 10),
+		r.Title,
+		r.Author,
+		r.ISBN13,
+		r.ISBN10,
+		strconv.FormatUint(uint64(r.Version), 10),
+		r.CreatedAt.Format(time.RFC3339),
+		r.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+// Close writes the header even for an empty export.
+func (c *csvWriter) Close() error {
+	if !c.header {
+		c.header = true
+		c.w.Write(csvHeader)
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(book *models.Book) error {
+	return j.enc.Encode(NewRecord(book)) // Encode ends every value with a newline
+}
+
+func (j *jsonlWriter) Close() error { return nil }
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,108 @@
+package bookexport
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"library-api/bookimport"
+	"library-api/models"
+)
+
+func books() []models.Book {
+	at := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	isbn13, isbn10 := "9780441013593", "0441013597"
+	dune := models.Book{Title: "Dune", Author: "Frank Herbert", ISBN13: &isbn13, ISBN10: &isbn10, Version: 2}
+	dune.ID, dune.CreatedAt, dune.UpdatedAt = 1, at, at
+	odd := models.Book{Title: `Say "hi", <world> & co`, Author: "Ada, Countess", Version: 1}
+	odd.ID, odd.CreatedAt, odd.UpdatedAt = 2, at, at
+	return []models.Book{dune, odd}
+}
+
+func export(t *testing.T, format string, list []models.Book) string {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format)
+	require.NoError(t, err)
+	for i := range list {
+		require.NoError(t, w.Write(&list[i]))
+	}
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestCSV(t *testing.T) {
+	out := export(t, CSV, books())
+	assert.Equal(t, "id,title,author,isbn13,isbn10,version,created_at,updated_at\n"+
+		"1,Dune,Frank Herbert,9780441013593,0441013597,2,2024-03-01T12:30:00Z,2024-03-01T12:30:00Z\n"+
+		`2,"Say ""hi"", <world> & co","Ada, Countess",,,1,2024-03-01T12:30:00Z,2024-03-01T12:30:00Z`+"\n", out)
+
+	assert.Equal(t, "id,title,author,isbn13,isbn10,version,created_at,updated_at\n", export(t, CSV, nil))
+}
+
+func TestJSONL(t *testing.T) {
+	out := export(t, JSONL, books())
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"id":1,"title":"Dune","author":"Frank Herbert","isbn13":"9780441013593","isbn10":"0441013597","version":2,"created_at":"2024-03-01T12:30:00Z","updated_at":"2024-03-01T12:30:00Z"}`, lines[0])
+}
+
+// Exports can be imported again as they are.
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{CSV, JSONL} {
+		r, err := bookimport.NewReader(strings.NewReader(export(t, format, books())), format)
+		require.NoError(t, err)
+		for _, want := range books() {
+			row, err := r.Next()
+			require.NoError(t, err)
+			assert.Empty(t, row.Errors)
+			assert.Equal(t, want.ID, row.ID, format)
+			assert.Equal(t, want.Title, row.Title, format)
+			assert.Equal(t, want.Author, row.Author, format)
+			assert.Equal(t, deref(want.ISBN13), row.ISBN, format)
+		}
+		_, err = r.Next()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestMARCXML(t *testing.T) {
+	out := export(t, MARCXML, books())
+	type collection struct {
+		XMLName xml.Name     `xml:"http://www.loc.gov/MARC21/slim collection"`
+		Records []marcRecord `xml:"record"`
+	}
+	var doc collection
+	require.NoError(t, xml.Unmarshal([]byte(out), &doc))
+	require.Len(t, doc.Records, 2)
+
+	var isbns []string
+	for _, field := range doc.Records[0].DataFields {
+		if field.Tag == "020" {
+			isbns = append(isbns, field.Subfields[0].Value)
+		}
+	}
+	assert.Equal(t, []string{"9780441013593", "0441013597"}, isbns)
+
+	rec := doc.Records[1]
+	assert.Len(t, rec.Leader, 24)
+	assert.Equal(t, []marcControlField{{Tag: "001", Value: "2"}, {Tag: "005", Value: "20240301123000.0"}}, rec.ControlFields)
+	assert.Equal(t, "100", rec.DataFields[0].Tag)
+	assert.Equal(t, "Ada, Countess", rec.DataFields[0].Subfields[0].Value)
+	assert.Equal(t, "245", rec.DataFields[1].Tag)
+	assert.Equal(t, "1", rec.DataFields[1].Ind1)
+	assert.Equal(t, `Say "hi", <world> & co`, rec.DataFields[1].Subfields[0].Value)
+
+	var empty collection
+	require.NoError(t, xml.Unmarshal([]byte(export(t, MARCXML, nil)), &empty))
+	assert.Empty(t, empty.Records)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := NewWriter(io.Discard, "xlsx")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -0,0 +1,217 @@
+// Package bookimport reads catalog rows from CSV or JSON Lines uploads one
+// at a time, so a file of any size can be imported in constant memory.
+package bookimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+
+	"library-api/apperror"
+	"library-api/isbn"
+	"library-api/validate"
+)
+
+// Formats an import can be in.
+const (
+	CSV   = "csv"
+	JSONL = "jsonl"
+)
+
+// MaxLineBytes bounds a single JSONL line.
+const MaxLineBytes = 64 << 10
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv or jsonl")
+	ErrMissingColumn = errors.New("CSV header is missing a required column")
+)
+
+// Row is one book from the file. Line is the 1-based line it started on
+// (for CSV, counting the header). A row with Errors must not be imported.
+type Row struct {
+	Line   int                   `json:"line"`
+	ID     uint                  `json:"id,omitempty"` // Set to update an existing book
+	Title  string                `json:"title" validate:"required,max=255"`
+	Author string                `json:"author" validate:"required,max=255"`
+	ISBN   string                `json:"isbn,omitempty" validate:"isbn"` // Normalized to ISBN-13 once valid
+	Errors []apperror.FieldError `json:"errors,omitempty"`
+
+	unparsed bool // The line itself was broken, so there's nothing to validate
+}
+
+// DetectFormat picks the format from a file name or content type.
+func DetectFormat(filename, contentType string) (string, bool) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return CSV, true
+	case ".jsonl", ".ndjson":
+		return JSONL, true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return CSV, true
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		return JSONL, true
+	}
+	return "", false
+}
+
+// Reader returns the rows of an upload. Rows that can't be parsed or
+// don't validate come back with Errors set rather than stopping the read.
+type Reader struct {
+	next func() (Row, error)
+}
+
+// NewReader reads rows in format from r. For CSV the header is read
+// straight away and must name the title and author columns; id and isbn
+// (or isbn13 or isbn10) are optional and other columns are ignored.
+func NewReader(r io.Reader, format string) (*Reader, error) {
+	switch format {
+	case CSV:
+		return newCSVReader(r)
+	case JSONL:
+		return newJSONLReader(r), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Next returns the next row, or io.EOF after the last one. Other errors
+// mean the upload itself can't be read any further.
+func (r *Reader) Next() (Row, error) {
+	row, err := r.next()
+	if err != nil {
+		return row, err
+	}
+	if !row.unparsed {
+		row.Errors = append(row.Errors, validate.Struct(&row)...)
+	}
+	if len(row.Errors) == 0 && row.ISBN != "" {
+		row.ISBN, _ = isbn.Normalize(row.ISBN)
+	}
+	return row, nil
+}
+
+func newCSVReader(r io.Reader) (*Reader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrMissingColumn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	for _, required := range []string{"title", "author"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingColumn, required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	return &Reader{next: func() (Row, error) {
+		record, err := cr.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Row{Line: parseErr.StartLine, unparsed: true, Errors: []apperror.FieldError{{Code: "invalid_csv", Message: parseErr.Err.Error()}}}, nil
+		}
+		if err != nil {
+			return Row{}, err
+		}
+		line, _ := cr.FieldPos(0)
+		row := Row{Line: line, Title: field(record, "title"), Author: field(record, "author")}
+		row.ISBN = firstOf(field(record, "isbn"), field(record, "isbn13"), field(record, "isbn10"))
+		if id := field(record, "id"); id != "" {
+			n, err := strconv.ParseUint(id, 10, 32)
+			if err != nil || n == 0 {
+				row.Errors = append(row.Errors, apperror.FieldError{Field: "id", Code: "invalid_id", Message: "must be a positive whole number"})
+			}
+			row.ID = uint(n)
+		}
+		return row, nil
+	}}, nil
+}
+
+func newJSONLReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxLineBytes)
+	line := 0
+	return &Reader{next: func() (Row, error) {
+		for scanner.Scan() {
+			line++
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			row := Row{Line: line}
+			// Unknown fields are allowed so that exports can be imported again
+			var fields struct {
+				ID     *json.Number `json:"id"`
+				Title  string       `json:"title"`
+				Author string       `json:"author"`
+				ISBN   string       `json:"isbn"`
+				ISBN13 string       `json:"isbn13"`
+				ISBN10 string       `json:"isbn10"`
+			}
+			if err := json.Unmarshal(data, &fields); err != nil {
+				row.Errors = []apperror.FieldError{jsonError(err)}
+				row.unparsed = true
+				return row, nil
+			}
+			row.Title = strings.TrimSpace(fields.Title)
+			row.Author = strings.TrimSpace(fields.Author)
+			row.ISBN = firstOf(strings.TrimSpace(fields.ISBN), strings.TrimSpace(fields.ISBN13), strings.TrimSpace(fields.ISBN10))
+			if fields.ID != nil {
+				n, err := strconv.ParseUint(fields.ID.String(), 10, 32)
+				if err != nil || n == 0 {
+					row.Errors = append(row.Errors, apperror.FieldError{Field: "id", Code: "invalid_id", Message: "must be a positive whole number"})
+				}
+				row.ID = uint(n)
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return Row{}, fmt.Errorf("line %d is longer than %d bytes", line+1, MaxLineBytes)
+			}
+			return Row{}, err
+		}
+		return Row{}, io.EOF
+	}}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func jsonError(err error) apperror.FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return apperror.FieldError{Field: typeErr.Field, Code: "invalid_type", Message: "has the wrong type"}
+	}
+	return apperror.FieldError{Code: "invalid_json", Message: "line is not a JSON object"}
+}
@@ -0,0 +1,96 @@
+package bookimport
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, input, format string) []Row {
+	r, err := NewReader(strings.NewReader(input), format)
+	require.NoError(t, err)
+	var rows []Row
+	for {
+		row, err := r.Next()
+		if err == io.EOF {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func codes(row Row) map[string]string {
+	out := map[string]string{}
+	for _, e := range row.Errors {
+		out[e.Field] = e.Code
+	}
+	return out
+}
+
+func TestCSV(t *testing.T) {
+	input := "\ufeffID,Title,Author,Shelf,ISBN10\n" +
+		",Dune,Frank Herbert,A1,0-441-01359-7\n" +
+		"7, Emma ,Jane Austen,B2,\n" +
+		"x,,Nobody,C3,0441013598\n" +
+		"\"Unterminated,Someone\n"
+	rows := readAll(t, input, CSV)
+	require.Len(t, rows, 4)
+
+	assert.Equal(t, Row{Line: 2, Title: "Dune", Author: "Frank Herbert", ISBN: "9780441013593"}, rows[0])
+	assert.Equal(t, uint(7), rows[1].ID)
+	assert.Equal(t, "Emma", rows[1].Title)
+	assert.Equal(t, 3, rows[1].Line)
+	assert.Equal(t, map[string]string{"id": "invalid_id", "title": "required", "isbn": "invalid_isbn"}, codes(rows[2]))
+	assert.Equal(t, map[string]string{"": "invalid_csv"}, codes(rows[3]))
+}
+
+func TestCSVHeader(t *testing.T) {
+	_, err := NewReader(strings.NewReader("title,writer\nDune,Herbert\n"), CSV)
+	assert.ErrorIs(t, err, ErrMissingColumn)
+
+	_, err = NewReader(strings.NewReader(""), CSV)
+	assert.ErrorIs(t, err, ErrMissingColumn)
+}
+
+func TestJSONL(t *testing.T) {
+	input := `{"title": "Dune", "author": "Frank Herbert", "version": 3}` + "\n" +
+		"\n" +
+		`{"id": 7, "title": "Emma", "author": "Jane Austen", "isbn13": "978-0-14-143958-7"}` + "\n" +
+		`{"title": 5}` + "\n" +
+		`not json` + "\n" +
+		`{"id": -1, "title": "` + strings.Repeat("a", 256) + `", "author": "x"}`
+	rows := readAll(t, input, JSONL)
+	require.Len(t, rows, 5)
+
+	assert.Equal(t, Row{Line: 1, Title: "Dune", Author: "Frank Herbert"}, rows[0])
+	assert.Equal(t, Row{Line: 3, ID: 7, Title: "Emma", Author: "Jane Austen", ISBN: "9780141439587"}, rows[1])
+	assert.Equal(t, map[string]string{"title": "invalid_type"}, codes(rows[2]))
+	assert.Equal(t, map[string]string{"": "invalid_json"}, codes(rows[3]))
+	assert.Equal(t, map[string]string{"id": "invalid_id", "title": "too_large"}, codes(rows[4]))
+	assert.Equal(t, 6, rows[4].Line)
+}
+
+func TestJSONLLineTooLong(t *testing.T) {
+	r, err := NewReader(strings.NewReader(strings.Repeat("x", MaxLineBytes+1)), JSONL)
+	require.NoError(t, err)
+	_, err = r.Next()
+	assert.Error(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
+
+func TestDetectFormat(t *testing.T) {
+	format, ok := DetectFormat("catalog.CSV", "application/octet-stream")
+	assert.True(t, ok)
+	assert.Equal(t, CSV, format)
+
+	format, ok = DetectFormat("", "application/x-ndjson; charset=utf-8")
+	assert.True(t, ok)
+	assert.Equal(t, JSONL, format)
+
+	_, ok = DetectFormat("catalog.xlsx", "")
+	assert.False(t, ok)
+}
@@ -0,0 +1,225 @@
+package broadcast
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Event is one message on a topic. IDs increase within a topic and are what
+// clients send back as Last-Event-ID.
+type Event struct {
+	ID   uint64
+	Type string
+	Data []byte
+}
+
+// Source feeds a topic from elsewhere, such as Redis pub/sub. It runs while
+// the topic has subscribers, calls ready once it is listening and must return
+// when ctx is cancelled.
+type Source func(ctx context.Context, topic string, publish func(Event), ready func())
+
+// Hub fans events out to any number of subscribers per topic and keeps the
+// last few events of each topic so reconnecting clients can catch up.
+type Hub struct {
+	mu          sync.Mutex
+	topics      map[string]*topic
+	historySize int
+	bufferSize  int
+	source      Source
+	grace       time.Duration // How long a sourced topic outlives its last subscriber
+}
+
+type topic struct {
+	history []Event // Oldest first, at most historySize
+	lastID  uint64
+	subs    map[*Subscription]struct{}
+	stop    context.CancelFunc // Stops the source, if any
+	ready   chan struct{}      // Closed once the source is listening
+	idle    *time.Timer        // Forgets the topic once the grace period is over
+}
+
+// Subscription receives a topic's events on C. C is closed when the
+// subscriber is dropped for falling behind, or when the topic is removed.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	hub   *Hub
+	topic string
+	once  sync.Once
+}
+
+func NewHub(historySize, bufferSize int) *Hub {
+	return &Hub{topics: make(map[string]*topic), historySize: historySize, bufferSize: bufferSize, grace: 30 * time.Second}
+}
+
+// WithSource makes the hub pull topics from source instead of expecting
+// Publish calls. Topics fed this way are forgotten a grace period after
+// their last subscriber leaves, so a client that reconnects meanwhile still
+// finds the history it missed.
+func (h *Hub) WithSource(source Source) *Hub {
+	h.source = source
+	return h
+}
+
+// WithGrace sets how long a sourced topic and its history are kept once
+// nobody subscribes to it. The default is 30 seconds.
+func (h *Hub) WithGrace(grace time.Duration) *Hub {
+	h.grace = grace
+	return h
+}
+
+// Publish adds an event to the topic and hands it to every subscriber.
+// Events with an ID at or below the last one seen are duplicates and ignored.
+// A subscriber whose buffer is full is dropped rather than slowing the rest down.
+func (h *Hub) Publish(name string, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.topics[name]; !ok && h.historySize == 0 {
+		return // Nobody listening and nothing to keep
+	}
+	h.publish(h.topic(name), event)
+}
+
+func (h *Hub) publish(t *topic, event Event) {
+	if event.ID <= t.lastID {
+		return
+	}
+	t.lastID = event.ID
+	t.history = append(t.history, event)
+	if len(t.history) > h.historySize {
+		t.history = t.history[len(t.history)-h.historySize:]
+	}
+	for sub := range t.subs {
+		select {
+		case sub.c <- event:
+		default:
+			delete(t.subs, sub)
+			sub.closeChan()
+		}
+	}
+}
+
+// Subscribe joins a topic and returns the buffered events after lastID.
+// complete is false when events after lastID have already left the history,
+// in which case the caller has to send the client a full snapshot first.
+func (h *Hub) Subscribe(name string, lastID uint64) (sub *Subscription, replay []Event, complete bool) {
+	h.mu.Lock()
+	t := h.topic(name)
+	c := make(chan Event, h.bufferSize)
+	sub = &Subscription{C: c, c: c, hub: h, topic: name}
+	t.subs[sub] = struct{}{}
+	if t.idle != nil {
+		t.idle.Stop()
+		t.idle = nil
+	}
+	if h.source != nil && t.stop == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.stop = cancel
+		t.ready = make(chan struct{})
+		var once sync.Once
+		go h.source(ctx, name, func(event Event) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.topics[name] == t { // Not removed in the meantime
+				h.publish(t, event)
+			}
+		}, func() { once.Do(func() { close(t.ready) }) })
+	}
+	ready := t.ready
+	h.mu.Unlock()
+
+	// Wait until the source listens, so anything the caller reads after this returns is covered
+	if ready != nil {
+		select {
+		case <-ready:
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// A first connection (lastID 0) is only complete if the history goes back to the start
+	complete = lastID != 0 && lastID == t.lastID
+	for _, event := range t.history {
+		if event.ID == lastID+1 {
+			complete = true
+		}
+		if event.ID > lastID {
+			replay = append(replay, event)
+		}
+	}
+	return sub, replay, complete
+}
+
+// Close leaves the topic.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	t, ok := s.hub.topics[s.topic]
+	if !ok {
+		return
+	}
+	delete(t.subs, s)
+	s.closeChan()
+	if len(t.subs) > 0 {
+		return
+	}
+	if t.stop != nil {
+		h, name := s.hub, s.topic
+		t.idle = time.AfterFunc(h.grace, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.topics[name] == t && len(t.subs) == 0 { // Nobody came back
+				t.stop()
+				delete(h.topics, name)
+			}
+		})
+	} else if len(t.history) == 0 {
+		delete(s.hub.topics, s.topic)
+	}
+}
+
+// Remove drops a topic and its history and disconnects its subscribers.
+func (h *Hub) Remove(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[name]
+	if !ok {
+		return
+	}
+	for sub := range t.subs {
+		sub.closeChan()
+	}
+	if t.idle != nil {
+		t.idle.Stop()
+	}
+	if t.stop != nil {
+		t.stop()
+	}
+	delete(h.topics, name)
+}
+
+// Subscribers returns how many subscribers a topic has.
+func (h *Hub) Subscribers(name string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if t, ok := h.topics[name]; ok {
+		return len(t.subs)
+	}
+	return 0
+}
+
+func (h *Hub) topic(name string) *topic {
+	t, ok := h.topics[name]
+	if !ok {
+		t = &topic{subs: make(map[*Subscription]struct{})}
+		h.topics[name] = t
+	}
+	return t
+}
+
+func (s *Subscription) closeChan() {
+	s.once.Do(func() { close(s.c) })
+}
@@ -0,0 +1,123 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func publishN(h *Hub, topic string, from, to uint64) {
+	for id := from; id <= to; id++ {
+		h.Publish(topic, Event{ID: id, Data: []byte(fmt.Sprint(id))})
+	}
+}
+
+func TestHub_FansOutToAllSubscribers(t *testing.T) {
+	h := NewHub(10, 10)
+	a, _, _ := h.Subscribe("task", 0)
+	b, _, _ := h.Subscribe("task", 0)
+	publishN(h, "task", 1, 3)
+
+	for _, sub := range []*Subscription{a, b} {
+		for id := uint64(1); id <= 3; id++ {
+			assert.Equal(t, id, (<-sub.C).ID)
+		}
+	}
+	a.Close()
+	assert.Equal(t, 1, h.Subscribers("task"))
+}
+
+func TestHub_ReplaysAfterLastEventID(t *testing.T) {
+	h := NewHub(5, 10)
+	publishN(h, "task", 1, 4)
+
+	_, replay, complete := h.Subscribe("task", 2)
+	assert.True(t, complete)
+	assert.Len(t, replay, 2)
+	assert.Equal(t, uint64(3), replay[0].ID)
+
+	_, replay, complete = h.Subscribe("task", 0)
+	assert.True(t, complete, "history still starts at 1")
+	assert.Len(t, replay, 4)
+
+	publishN(h, "task", 5, 8) // Events 1-3 fall out of the history
+	_, replay, complete = h.Subscribe("task", 1)
+	assert.False(t, complete)
+	assert.Len(t, replay, 5)
+
+	_, replay, complete = h.Subscribe("task", 8)
+	assert.True(t, complete)
+	assert.Empty(t, replay)
+}
+
+func TestHub_IgnoresDuplicatesAndDropsSlowSubscribers(t *testing.T) {
+	h := NewHub(10, 2)
+	slow, _, _ := h.Subscribe("task", 0)
+	publishN(h, "task", 1, 2)
+	h.Publish("task", Event{ID: 2})
+	assert.Equal(t, 1, h.Subscribers("task"))
+
+	h.Publish("task", Event{ID: 3}) // Buffer of 2 is full
+	assert.Equal(t, 0, h.Subscribers("task"))
+	<-slow.C
+	<-slow.C
+	_, open := <-slow.C
+	assert.False(t, open)
+}
+
+func TestHub_SourceRunsWhileSubscribed(t *testing.T) {
+	stopped := make(chan struct{})
+	h := NewHub(10, 10).WithGrace(10 * time.Millisecond).WithSource(func(ctx context.Context, topic string, publish func(Event), ready func()) {
+		ready()
+		publish(Event{ID: 1, Data: []byte(topic)})
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	sub, _, _ := h.Subscribe("task", 0)
+	assert.Equal(t, "task", string((<-sub.C).Data))
+	sub.Close()
+	<-stopped
+	assert.Equal(t, 0, h.Subscribers("task"))
+}
+
+func TestHub_SourcedTopicOutlivesLastSubscriberForGrace(t *testing.T) {
+	var starts atomic.Int32
+	stopped := make(chan struct{})
+	h := NewHub(10, 10).WithGrace(100 * time.Millisecond).WithSource(func(ctx context.Context, topic string, publish func(Event), ready func()) {
+		first := starts.Add(1) == 1
+		ready()
+		publish(Event{ID: 1})
+		publish(Event{ID: 2})
+		<-ctx.Done()
+		if first {
+			close(stopped)
+		}
+	})
+
+	sub, _, _ := h.Subscribe("task", 0)
+	<-sub.C
+	<-sub.C
+	sub.Close()
+
+	// Reconnecting within the grace period replays from the kept history
+	sub, replay, complete := h.Subscribe("task", 1)
+	assert.True(t, complete)
+	assert.Equal(t, []Event{{ID: 2}}, replay)
+	assert.Equal(t, int32(1), starts.Load(), "the source keeps running")
+	sub.Close()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("source still running after the grace period")
+	}
+	sub, replay, _ = h.Subscribe("task", 2)
+	defer sub.Close()
+	assert.Equal(t, int32(2), starts.Load())
+	assert.Len(t, replay, 0)
+}
@@ -32,4 +32,34 @@ func (c *Cache) Get(key string, dest interface{}) error {
 		return err
 	}
 	return json.Unmarshal(data, dest)
-}
\ No newline at end of file
+}
+
+// SetNX stores value only if key doesn't exist yet and reports whether it did.
+func (c *Cache) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return c.Client.SetNX(context.Background(), key, data, expiration).Result()
+}
+
+func (c *Cache) Delete(key string) error {
+	return c.Client.Del(context.Background(), key).Err()
+}
+
+var deleteIfEqual = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// DeleteIfEqual deletes key only if it still holds value, and reports
+// whether it did.
+func (c *Cache) DeleteIfEqual(key string, value interface{}) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	n, err := deleteIfEqual.Run(context.Background(), c.Client, []string{key}, data).Int()
+	return n == 1, err
+}
@@ -3,35 +3,108 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
-	JWTSecret  string
-	DBHost     string
-	DBPort     int
-	DBUser     string
-	DBPassword string
-	DBName     string
-	RedisAddr  string
-	SMTPHost   string
-	SMTPPort   string
-	SMTPUser   string
-	SMTPPass   string
+	JWTSecret        string
+	DBHost           string
+	DBPort           int
+	DBUser           string
+	DBPassword       string
+	DBName           string
+	RedisAddr        string
+	SMTPHost         string
+	SMTPPort         string
+	SMTPUser         string
+	SMTPPass         string
+	EmailTemplateDir string        // Directory of <name>.subject/.html/.txt files; optional
+	TaskRetention    time.Duration // How long finished bulk tasks are kept
+	IdempotencyTTL   time.Duration // How long responses are kept for Idempotency-Key retries
+	MetadataProvider string        // openlibrary (default), fixtures or none
+	MetadataFixtures string        // Directory of <isbn13>.json files for the fixtures provider
+	OpenLibraryURL   string        // Base URL of the Open Library API or a mirror
+	AutoEnrich       bool          // Enrich new books with an ISBN automatically
+	CoverStorage     string        // local (default) or s3
+	CoverDir         string        // Directory of the local cover storage
+	CoverMaxBytes    int64         // Largest cover upload accepted
+	S3Endpoint       string        // e.g. https://s3.eu-west-1.amazonaws.com or a MinIO URL
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+
+	RecommendationsRebuild time.Duration // How often recommendations are recomputed
+	TrashRetention         time.Duration // How long deleted books and users are kept before being purged
+	LoanPeriod             time.Duration // How long a book is lent for when checkout doesn't say
 }
 
 func LoadConfig() *Config {
 	dbPort, _ := strconv.Atoi(os.Getenv("DB_PORT"))
+	retentionHours, _ := strconv.Atoi(os.Getenv("BULK_TASK_RETENTION_HOURS"))
+	if retentionHours <= 0 {
+		retentionHours = 24
+	}
+	idempotencyHours, _ := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL_HOURS"))
+	if idempotencyHours <= 0 {
+		idempotencyHours = 24
+	}
+	metadataProvider := os.Getenv("METADATA_PROVIDER")
+	if metadataProvider == "" {
+		metadataProvider = "openlibrary"
+	}
+	autoEnrich, _ := strconv.ParseBool(os.Getenv("METADATA_AUTO_ENRICH"))
+	coverStorage := os.Getenv("COVER_STORAGE")
+	if coverStorage == "" {
+		coverStorage = "local"
+	}
+	coverDir := os.Getenv("COVER_DIR")
+	if coverDir == "" {
+		coverDir = "./data/covers"
+	}
+	rebuildMinutes, _ := strconv.Atoi(os.Getenv("RECOMMENDATIONS_REBUILD_MINUTES"))
+	if rebuildMinutes <= 0 {
+		rebuildMinutes = 60
+	}
+	trashDays, _ := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if trashDays <= 0 {
+		trashDays = 30
+	}
+	loanDays, _ := strconv.Atoi(os.Getenv("LOAN_PERIOD_DAYS"))
+	if loanDays <= 0 {
+		loanDays = 14
+	}
+	coverMaxBytes, _ := strconv.ParseInt(os.Getenv("COVER_MAX_BYTES"), 10, 64)
 	return &Config{
-		JWTSecret:  os.Getenv("JWT_SECRET"),
-		DBHost:     os.Getenv("DB_HOST"),
-		DBPort:     dbPort,
-		DBUser:     os.Getenv("DB_USER"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBName:     os.Getenv("DB_NAME"),
-		RedisAddr:  os.Getenv("REDIS_ADDR"),
-		SMTPHost:   os.Getenv("SMTP_HOST"),
-		SMTPPort:   os.Getenv("SMTP_PORT"),
-		SMTPUser:   os.Getenv("SMTP_USER"),
-		SMTPPass:   os.Getenv("SMTP_PASS"),
-	}
-}
\ No newline at end of file
+		JWTSecret:        os.Getenv("JWT_SECRET"),
+		DBHost:           os.Getenv("DB_HOST"),
+		DBPort:           dbPort,
+		DBUser:           os.Getenv("DB_USER"),
+		DBPassword:       os.Getenv("DB_PASSWORD"),
+		DBName:           os.Getenv("DB_NAME"),
+		RedisAddr:        os.Getenv("REDIS_ADDR"),
+		SMTPHost:         os.Getenv("SMTP_HOST"),
+		SMTPPort:         os.Getenv("SMTP_PORT"),
+		SMTPUser:         os.Getenv("SMTP_USER"),
+		SMTPPass:         os.Getenv("SMTP_PASS"),
+		EmailTemplateDir: os.Getenv("EMAIL_TEMPLATE_DIR"),
+		TaskRetention:    time.Duration(retentionHours) * time.Hour,
+		IdempotencyTTL:   time.Duration(idempotencyHours) * time.Hour,
+		MetadataProvider: metadataProvider,
+		MetadataFixtures: os.Getenv("METADATA_FIXTURES_DIR"),
+		OpenLibraryURL:   os.Getenv("OPENLIBRARY_URL"),
+		AutoEnrich:       autoEnrich,
+		CoverStorage:     coverStorage,
+		CoverDir:         coverDir,
+		CoverMaxBytes:    coverMaxBytes,
+		S3Endpoint:       os.Getenv("S3_ENDPOINT"),
+		S3Region:         os.Getenv("S3_REGION"),
+		S3Bucket:         os.Getenv("S3_BUCKET"),
+		S3AccessKey:      os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:      os.Getenv("S3_SECRET_KEY"),
+
+		RecommendationsRebuild: time.Duration(rebuildMinutes) * time.Minute,
+		TrashRetention:         time.Duration(trashDays) * 24 * time.Hour,
+		LoanPeriod:             time.Duration(loanDays) * 24 * time.Hour,
+	}
+}
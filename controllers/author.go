@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"library-api/models"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type AuthorController struct {
+	Service *services.AuthorService
+}
+
+func NewAuthorController(service *services.AuthorService) *AuthorController {
+	return &AuthorController{Service: service}
+}
+
+type authorRequest struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type mergeAuthorsRequest struct {
+	AuthorIDs []uint `json:"author_ids" validate:"required,max=100"` // Duplicates to merge away
+}
+
+// ListAuthors lists authors by name; ?q= matches part of the name.
+func (c *AuthorController) ListAuthors(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	query := p.QueryString("q", false)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	authors, err := c.Service.ListAuthors(query, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authors)
+}
+
+func (c *AuthorController) CreateAuthor(w http.ResponseWriter, r *http.Request) {
+	var req authorRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	author, err := c.Service.CreateAuthor(req.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/authors/%d", author.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(author)
+}
+
+// GetAuthor answers for an author that was merged away with a permanent
+// redirect to the author it was merged into.
+func (c *AuthorController) GetAuthor(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	author, err := c.Service.GetAuthor(id)
+	if redirectMerged(w, r, err, "") {
+		return
+	}
+	if err != nil {
+		writeError(w, r, orNotFound(err, "author", "Author not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(author)
+}
+
+// RenameAuthor changes the author's name; the books crediting them show
+// the new name.
+func (c *AuthorController) RenameAuthor(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req authorRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	author, err := c.Service.RenameAuthor(id, req.Name)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "author", "Author not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(author)
+}
+
+// GetAuthorBooks lists the books crediting the author; ?role= keeps only
+// books where they have that role.
+func (c *AuthorController) GetAuthorBooks(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	role := p.QueryOneOf("role", "", models.ContributorAuthor, models.ContributorEditor, models.ContributorTranslator)
+	limit := p.QueryInt("limit", 10, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	books, err := c.Service.GetAuthorBooks(id, role, limit, offset)
+	if redirectMerged(w, r, err, "/books") {
+		return
+	}
+	if err != nil {
+		writeError(w, r, orNotFound(err, "author", "Author not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(books)
+}
+
+// MergeAuthors merges the authors in the body into the one in the path and
+// answers with the surviving author.
+func (c *AuthorController) MergeAuthors(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req mergeAuthorsRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	author, err := c.Service.MergeAuthors(id, req.AuthorIDs)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "author", "Author not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(author)
+}
+
+// redirectMerged sends reads of a merged author's resources on to the
+// author it was merged into, keeping the query. It reports whether it did.
+func redirectMerged(w http.ResponseWriter, r *http.Request, err error, suffix string) bool {
+	var merged *services.MergedAuthorError
+	if !errors.As(err, &merged) {
+		return false
+	}
+	target := fmt.Sprintf("/authors/%d%s", merged.MergedInto, suffix)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+	return true
+}
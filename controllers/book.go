@@ -3,12 +3,128 @@ package controllers
 import (
 	"fmt"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
-	"strconv"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+	"library-api/apperror"
+	"library-api/bookexport"
+	"library-api/isbn"
+	"library-api/models"
+	"library-api/patch"
+	"library-api/repositories"
 	"library-api/services"
-	"github.com/gorilla/mux"
+	"library-api/validate"
 )
 
+// bookRequest is the body of POST and PUT /books, and the document PATCH
+// patches are applied to. Either author or contributors is required.
+type bookRequest struct {
+	Title         string   `json:"title" validate:"required,max=255"`
+	Author        string   `json:"author" validate:"max=255"`
+	ISBN          string   `json:"isbn" validate:"isbn"` // ISBN-10 or ISBN-13; stored as both
+	Publisher     string   `json:"publisher" validate:"max=255"`
+	PublishedYear int      `json:"published_year" validate:"max=2100"`
+	PageCount     int      `json:"page_count" validate:"max=100000"`
+	Subjects      []string `json:"subjects" validate:"max=50"`
+	Tags          []string `json:"tags" validate:"max=50"`
+	Language      string   `json:"language" validate:"max=35"`
+	Description   string   `json:"description" validate:"max=10000"`
+	CoverURL      string   `json:"cover_url" validate:"url,max=2048"`
+	WorkID        *uint    `json:"work_id"`
+	SeriesID      *uint    `json:"series_id"`
+	SeriesNumber  *float64 `json:"series_number" validate:"min=0,max=100000"`
+	// Contributors replaces author when given; author is then derived
+	Contributors []contributorRequest `json:"contributors" validate:"max=50"`
+}
+
+// contributorRequest credits an author by ID, or by name for an author
+// who may not exist yet.
+type contributorRequest struct {
+	AuthorID uint   `json:"author_id,omitempty"`
+	Name     string `json:"name,omitempty" validate:"max=255"`
+	Role     string `json:"role" validate:"oneof=author|editor|translator"`
+}
+
+// check covers the rules struct tags can't express.
+func (req bookRequest) check() error {
+	var errs []apperror.FieldError
+	if strings.TrimSpace(req.Author) == "" && len(req.Contributors) == 0 {
+		errs = append(errs, apperror.FieldError{Field: "author", Code: "required", Message: "is required unless contributors are given"})
+	}
+	for i, credit := range req.Contributors {
+		if credit.AuthorID == 0 && strings.TrimSpace(credit.Name) == "" {
+			errs = append(errs, apperror.FieldError{Field: fmt.Sprintf("contributors[%d].name", i), Code: "required", Message: "is required unless author_id is given"})
+		}
+	}
+	if req.SeriesNumber != nil && req.SeriesID == nil {
+		errs = append(errs, apperror.FieldError{Field: "series_number", Code: "series_required", Message: "needs a series_id"})
+	}
+	if len(errs) > 0 {
+		return apperror.InvalidFields(errs)
+	}
+	return nil
+}
+
+// newBookRequest describes book as a request body, the document a PATCH
+// applies to.
+func newBookRequest(book *models.Book) bookRequest {
+	return bookRequest{
+		Title:         book.Title,
+		Author:        book.Author,
+		ISBN:          deref(book.ISBN13),
+		Publisher:     book.Publisher,
+		PublishedYear: book.PublishedYear,
+		PageCount:     book.PageCount,
+		Subjects:      book.Subjects,
+		Tags:          book.Tags,
+		Language:      book.Language,
+		Description:   book.Description,
+		CoverURL:      book.CoverURL,
+		WorkID:        book.WorkID,
+		SeriesID:      book.SeriesID,
+		SeriesNumber:  book.SeriesNumber,
+		Contributors:  newContributorRequests(book.Contributors),
+	}
+}
+
+func newContributorRequests(credits []models.BookAuthor) []contributorRequest {
+	var reqs []contributorRequest
+	for _, credit := range credits {
+		reqs = append(reqs, contributorRequest{AuthorID: credit.AuthorID, Role: credit.Role})
+	}
+	return reqs
+}
+
+func (req bookRequest) input() services.BookInput {
+	input := services.BookInput{
+		Title:         req.Title,
+		Author:        req.Author,
+		ISBN:          req.ISBN,
+		Publisher:     req.Publisher,
+		PublishedYear: req.PublishedYear,
+		PageCount:     req.PageCount,
+		Subjects:      req.Subjects,
+		Tags:          req.Tags,
+		Language:      req.Language,
+		Description:   req.Description,
+		CoverURL:      req.CoverURL,
+		WorkID:        req.WorkID,
+		SeriesID:      req.SeriesID,
+		SeriesNumber:  req.SeriesNumber,
+	}
+	for _, credit := range req.Contributors {
+		input.Contributors = append(input.Contributors, services.ContributorInput{
+			AuthorID: credit.AuthorID, Name: credit.Name, Role: credit.Role,
+		})
+	}
+	return input
+}
+
 type BookController struct {
 	Service *services.BookService
 }
@@ -18,76 +134,313 @@ func NewBookController(service *services.BookService) *BookController {
 }
 
 func (c *BookController) CreateBook(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Title  string `json:"title"`
-		Author string `json:"author"`
+	var req bookRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := req.check(); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	book, err := c.Service.CreateBook(req.Title, req.Author)
+	book, err := c.Service.CreateBook(req.input())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	fmt.Println("Book created successfully!")
+	w.Header().Set("Location", fmt.Sprintf("/books/%d", book.ID))
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(book)
 }
 
+// bookFilter reads the filters that listings and exports share.
+func bookFilter(p *validate.Params) repositories.BookFilter {
+	return repositories.BookFilter{
+		Title:       p.QueryString("title", false),
+		Author:      p.QueryString("author", false),
+		AuthorID:    uint(p.QueryInt("author_id", 0, 0, math.MaxInt32)),
+		PublisherID: uint(p.QueryInt("publisher_id", 0, 0, math.MaxInt32)),
+		SubjectID:   uint(p.QueryInt("subject", 0, 0, math.MaxInt32)),
+		Tag:         p.QueryString("tag", false),
+		Language:    p.QueryString("language", false),
+		WorkID:      uint(p.QueryInt("work_id", 0, 0, math.MaxInt32)),
+		SeriesID:    uint(p.QueryInt("series_id", 0, 0, math.MaxInt32)),
+		Available:   p.QueryOptionalBool("available"),
+	}
+}
+
+// GetFacets counts the books matching the listing filters by subject,
+// author, language and availability, for a filter sidebar.
+func (c *BookController) GetFacets(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	filter := bookFilter(p)
+	limit := p.QueryInt("facet_limit", 20, 1, 100)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	facets, err := c.Service.GetFacets(filter, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(facets)
+}
+
+// GetBooks lists books by ID, or with ?sort=rating or ?sort=rating_count
+// best or most rated first.
 func (c *BookController) GetBooks(w http.ResponseWriter, r *http.Request) {
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit == 0 {
-		limit = 10 // Default limit
+	p := validate.NewParams(r)
+	filter := bookFilter(p)
+	filter.Sort = p.QueryOneOf("sort", "", repositories.SortRating, repositories.SortRatingCount)
+	limit := p.QueryInt("limit", 10, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
 	}
-	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
-	books, err := c.Service.GetBooks(limit, offset)
+	books, err := c.Service.GetBooks(filter, limit, offset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(books)
 }
 
+// ExportBooks streams the books matching the listing filters as a
+// download. Once the first bytes are out an error can't be reported
+// properly, so the connection is cut instead; the client sees a failed
+// download rather than a file that looks complete.
+func (c *BookController) ExportBooks(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	filter := bookFilter(p)
+	format := p.QueryOneOf("format", bookexport.CSV, bookexport.Formats...)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("books-%s.%s", time.Now().UTC().Format("20060102"), bookexport.Extension(format))
+	w.Header().Set("Content-Type", bookexport.ContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	out, _ := bookexport.NewWriter(w, format)
+	flusher, _ := w.(http.Flusher)
+	err := c.Service.ExportBooks(filter, func(books []models.Book) error {
+		for i := range books {
+			if err := out.Write(&books[i]); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		if apperror.Logger != nil {
+			apperror.Logger.Log(fmt.Sprintf("Export failed: %v", err))
+		}
+		panic(http.ErrAbortHandler)
+	}
+}
+
 func (c *BookController) GetBook(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	book, err := c.Service.GetBook(uint(id))
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	book, err := c.Service.GetBook(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.Header().Set("ETag", bookETag(book))
+	if notModified(r, book) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(book)
 }
 
+// GetBookByISBN looks a book up by either form of its ISBN.
+func (c *BookController) GetBookByISBN(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	raw := p.PathString("isbn")
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	book, err := c.Service.GetBookByISBN(raw)
+	if errors.Is(err, isbn.ErrInvalid) {
+		writeError(w, r, apperror.InvalidParams([]apperror.FieldError{{Field: "isbn", Code: "invalid_isbn", Message: "must be a valid ISBN-10 or ISBN-13"}}))
+		return
+	}
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "No book has this ISBN"))
+		return
+	}
+	w.Header().Set("Content-Location", fmt.Sprintf("/books/%d", book.ID))
+	w.Header().Set("ETag", bookETag(book))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
 func (c *BookController) UpdateBook(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	var req struct {
-		Title  string `json:"title"`
-		Author string `json:"author"`
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req bookRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	book, err := c.Service.UpdateBook(uint(id), req.Title, req.Author)
+	current, err := c.Service.GetBook(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
 		return
 	}
+	version, err := ifMatch(r, current.Version)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	c.saveBook(w, r, id, version, req)
+}
+
+// PatchBook applies a JSON Merge Patch or a JSON Patch, chosen by the
+// Content-Type, to the editable fields of a book. The result is validated
+// like a PUT body, so a patch can't remove a required field.
+func (c *BookController) PatchBook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != patch.MergePatchType && mediaType != patch.JSONPatchType {
+		w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		writeError(w, r, apperror.New(http.StatusUnsupportedMediaType, "unsupported_media_type",
+			"Send a patch as "+patch.MergePatchType+" or "+patch.JSONPatchType))
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, validate.MaxBodyBytes))
+	if err != nil {
+		writeError(w, r, apperror.New(http.StatusRequestEntityTooLarge, apperror.CodeBodyTooLarge, "Patch is too large"))
+		return
+	}
+	current, err := c.Service.GetBook(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	version, err := ifMatch(r, current.Version)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	doc, err := json.Marshal(newBookRequest(current))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if mediaType == patch.MergePatchType {
+		doc, err = patch.Merge(doc, body)
+	} else {
+		doc, err = patch.Apply(doc, body)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req bookRequest
+	if err := validate.Unmarshal(doc, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// The document carries both the author name and the credits it's
+	// derived from. A patch that only changed the name means a new author.
+	if req.Author != current.Author && reflect.DeepEqual(req.Contributors, newContributorRequests(current.Contributors)) {
+		req.Contributors = nil
+	}
+	c.saveBook(w, r, id, version, req)
+}
+
+// saveBook writes req over the book at version and answers with the result.
+func (c *BookController) saveBook(w http.ResponseWriter, r *http.Request, id, version uint, req bookRequest) {
+	if err := req.check(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	book, err := c.Service.UpdateBook(id, version, req.input())
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.Header().Set("ETag", bookETag(book))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(book)
 }
 
-func (c *BookController) DeleteBook(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	if err := c.Service.DeleteBook(uint(id)); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// EnrichBook fills in the book's details from the metadata provider by
+// its ISBN. ?overwrite=true replaces details the book already has.
+func (c *BookController) EnrichBook(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	overwrite := p.QueryBool("overwrite")
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
 		return
 	}
+	book, err := c.Service.EnrichBook(r.Context(), id, overwrite)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.Header().Set("ETag", bookETag(book))
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte("Book deleted"))
-	
-}
\ No newline at end of file
+	json.NewEncoder(w).Encode(book)
+}
+
+func (c *BookController) DeleteBook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	current, err := c.Service.GetBook(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	version, err := ifMatch(r, current.Version)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.DeleteBook(id, version); err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
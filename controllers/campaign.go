@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"math"
+	"time"
+
+	"library-api/apperror"
+	"library-api/email"
+	"library-api/middleware"
+	"library-api/models"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type CampaignController struct {
+	Service *services.CampaignService
+}
+
+func NewCampaignController(service *services.CampaignService) *CampaignController {
+	return &CampaignController{Service: service}
+}
+
+func (c *CampaignController) CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string                  `json:"name" validate:"max=255"`
+		Subject     string                  `json:"subject" validate:"max=255"`
+		Template    string                  `json:"template" validate:"max=100"`
+		Body        string                  `json:"body" validate:"max=100000"`
+		Audience    models.CampaignAudience `json:"audience"`
+		ScheduledAt *time.Time              `json:"scheduled_at"`
+		DryRun      bool                    `json:"dry_run"`
+	}
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p := validate.NewParams(r)
+	dryRun := p.QueryBool("dry_run")
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if req.DryRun || dryRun {
+		count, err := c.Service.CountRecipients(req.Audience)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"dry_run": true, "recipient_count": count})
+		return
+	}
+
+	campaign := &models.Campaign{
+		Name:        req.Name,
+		Subject:     req.Subject,
+		Template:    req.Template,
+		Body:        req.Body,
+		Audience:    req.Audience,
+		ScheduledAt: req.ScheduledAt,
+	}
+	if claims := middleware.CurrentClaims(r); claims != nil {
+		campaign.CreatedBy = claims.Username
+	}
+	campaign, err := c.Service.CreateCampaign(campaign)
+	if errors.Is(err, email.ErrTemplateNotFound) {
+		writeError(w, r, apperror.Validation("Unknown email template"))
+		return
+	}
+	if err != nil {
+		// One that failed to send is stored as failed; the error points at it
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/campaigns/%d", campaign.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(campaign)
+}
+
+func (c *CampaignController) ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	campaigns, err := c.Service.ListCampaigns(limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaigns)
+}
+
+func (c *CampaignController) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	campaign, err := c.Service.GetCampaign(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "campaign", "Campaign not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaign)
+}
+
+func (c *CampaignController) CancelCampaign(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	campaign, err := c.Service.CancelCampaign(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "campaign", "Campaign not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaign)
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"library-api/middleware"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type CollectionController struct {
+	Service *services.CollectionService
+}
+
+func NewCollectionController(service *services.CollectionService) *CollectionController {
+	return &CollectionController{Service: service}
+}
+
+type collectionRequest struct {
+	Title       string `json:"title" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=5000"`
+	Visibility  string `json:"visibility" validate:"oneof=private|unlisted|public"` // Defaults to private
+}
+
+func (req collectionRequest) input() services.CollectionInput {
+	return services.CollectionInput{Title: req.Title, Description: req.Description, Visibility: req.Visibility}
+}
+
+type collectionBooksRequest struct {
+	BookIDs  []uint `json:"book_ids" validate:"required,max=1000"`
+	Position *int   `json:"position" validate:"min=0"` // Adding only; appends if absent
+}
+
+// ListPublic lists public collections, without their books.
+func (c *CollectionController) ListPublic(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	collections, err := c.Service.ListPublic(limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// ListOwn lists the caller's collections, without their books.
+func (c *CollectionController) ListOwn(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	collections, err := c.Service.ListOwn(middleware.CurrentClaims(r).UserID, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// GetShared is the public read of a public or unlisted collection, by the
+// share token in its link.
+func (c *CollectionController) GetShared(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	token := p.PathString("token")
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	collection, err := c.Service.GetShared(token)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "collection", "Collection not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// GetCollection reads one of the caller's collections with its books.
+func (c *CollectionController) GetCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	collection, err := c.Service.GetOwn(id, middleware.CurrentClaims(r).UserID)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "collection", "Collection not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+func (c *CollectionController) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	var req collectionRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	collection, err := c.Service.CreateCollection(middleware.CurrentClaims(r).UserID, req.input())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/collections/%d", collection.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(collection)
+}
+
+func (c *CollectionController) UpdateCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req collectionRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	collection, err := c.Service.UpdateCollection(id, middleware.CurrentClaims(r).UserID, req.input())
+	if err != nil {
+		writeError(w, r, orNotFound(err, "collection", "Collection not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+func (c *CollectionController) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.DeleteCollection(id, middleware.CurrentClaims(r).UserID); err != nil {
+		writeError(w, r, orNotFound(err, "collection", "Collection not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddBooks adds books to the collection, at "position" or at the end, and
+// answers with the collection.
+func (c *CollectionController) AddBooks(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req collectionBooksRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	collection, err := c.Service.AddBooks(id, middleware.CurrentClaims(r).UserID, req.BookIDs, req.Position)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "collection", "Collection not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// ReorderBooks takes every book of the collection in its new order.
+func (c *CollectionController) ReorderBooks(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req collectionBooksRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	collection, err := c.Service.ReorderBooks(id, middleware.CurrentClaims(r).UserID, req.BookIDs)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "collection", "Collection not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+func (c *CollectionController) RemoveBook(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	bookID := p.PathID("book_id")
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.RemoveBook(id, middleware.CurrentClaims(r).UserID, bookID); err != nil {
+		writeError(w, r, orNotFound(err, "collection", "Collection not found, or the book isn't in it"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"library-api/apperror"
+	"library-api/cover"
+	"library-api/models"
+	"library-api/services"
+	"library-api/validate"
+)
+
+// DefaultMaxCoverBytes bounds a cover upload unless configured otherwise.
+const DefaultMaxCoverBytes = 5 << 20
+
+// coverCacheControl lets clients and proxies keep covers but makes them
+// revalidate every time: the URL stays the same when a cover is replaced or
+// removed, and the ETag is what changes, so a revalidated cover is never
+// stale. Revalidation of an unchanged cover is a cheap 304.
+const coverCacheControl = "public, no-cache"
+
+type CoverController struct {
+	Service  *services.CoverService
+	MaxBytes int64
+}
+
+func NewCoverController(service *services.CoverService) *CoverController {
+	return &CoverController{Service: service, MaxBytes: DefaultMaxCoverBytes}
+}
+
+// UploadCover takes a JPEG or PNG as the "file" field of a multipart form
+// and answers with the updated book.
+func (c *CoverController) UploadCover(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Room for the form around the file; the file itself is checked below
+	r.Body = http.MaxBytesReader(w, r.Body, c.MaxBytes+1<<20)
+	part, err := filePart(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer part.Close()
+	data, err := io.ReadAll(io.LimitReader(part, c.MaxBytes+1))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || int64(len(data)) > c.MaxBytes {
+		writeError(w, r, apperror.New(http.StatusRequestEntityTooLarge, apperror.CodeBodyTooLarge,
+			fmt.Sprintf("Covers must not be larger than %d KB", c.MaxBytes>>10)))
+		return
+	}
+	if err != nil {
+		writeError(w, r, apperror.BadRequest("Request body is not a valid multipart form"))
+		return
+	}
+	book, err := c.Service.UploadCover(r.Context(), id, data)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.Header().Set("ETag", bookETag(book))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+// GetCover serves the uploaded cover in ?size=small, medium, large or
+// original (the default is large). Books without one are redirected to
+// their external cover_url if they have it.
+func (c *CoverController) GetCover(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	size := p.QueryOneOf("size", cover.Large, cover.Small, cover.Medium, cover.Large, cover.Original)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	book, err := c.Service.GetBook(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	etag := coverETag(book, size)
+	if book.CoverKey != "" && noneMatch(r, etag) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", coverCacheControl)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, length, err := c.Service.OpenCover(r.Context(), book, size)
+	if errors.Is(err, services.ErrNoCover) {
+		if book.CoverURL != "" {
+			http.Redirect(w, r, book.CoverURL, http.StatusFound)
+			return
+		}
+		writeError(w, r, apperror.NotFound("cover", "Book has no cover"))
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", book.CoverType)
+	if length >= 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(length))
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", coverCacheControl)
+	if book.CoverUpdatedAt != nil {
+		w.Header().Set("Last-Modified", book.CoverUpdatedAt.UTC().Format(http.TimeFormat))
+	}
+	io.Copy(w, body)
+}
+
+// coverETag names one size of one upload; every upload has its own key.
+func coverETag(book *models.Book, size string) string {
+	return `"` + strings.ReplaceAll(book.CoverKey, "/", "-") + "-" + size + `"`
+}
+
+// DeleteCover removes the uploaded cover.
+func (c *CoverController) DeleteCover(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if _, err := c.Service.RemoveCover(id); err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"library-api/email"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type EmailTemplateController struct {
+	Service *services.EmailTemplateService
+}
+
+func NewEmailTemplateController(service *services.EmailTemplateService) *EmailTemplateController {
+	return &EmailTemplateController{Service: service}
+}
+
+func (c *EmailTemplateController) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := c.Service.ListTemplates()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+func (c *EmailTemplateController) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := c.Service.GetTemplate(mux.Vars(r)["name"])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tmpl)
+}
+
+func (c *EmailTemplateController) SaveTemplate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string   `json:"name"` // Ignored, the path names the template; accepted so GET output can be PUT back
+		Subject   string   `json:"subject" validate:"required,max=255"`
+		HTML      string   `json:"html" validate:"max=200000"`
+		Text      string   `json:"text" validate:"max=200000"`
+		Variables []string `json:"variables" validate:"max=50"`
+	}
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p := validate.NewParams(r)
+	name := p.PathString("name")
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	tmpl, err := c.Service.SaveTemplate(&email.Template{
+		Name:      name,
+		Subject:   req.Subject,
+		HTML:      req.HTML,
+		Text:      req.Text,
+		Variables: req.Variables,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tmpl)
+}
+
+func (c *EmailTemplateController) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if err := c.Service.DeleteTemplate(mux.Vars(r)["name"]); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewTemplate renders a template with the posted variables without sending anything.
+func (c *EmailTemplateController) PreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if r.ContentLength != 0 {
+		if err := validate.DecodeJSON(w, r, &req); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	rendered, err := c.Service.PreviewTemplate(mux.Vars(r)["name"], req.Data)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rendered)
+}
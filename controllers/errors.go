@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+	"library-api/apperror"
+	"library-api/bookimport"
+	"library-api/cover"
+	"library-api/email"
+	"library-api/isbn"
+	"library-api/metadata"
+	"library-api/patch"
+	"library-api/repositories"
+	"library-api/services"
+	"library-api/validate"
+)
+
+// writeError answers with err as a problem document. Domain errors from the
+// services and the email package get their own codes; anything unknown is a
+// 500 that doesn't reveal the cause.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apperror.Write(w, r, domainError(err))
+}
+
+func domainError(err error) error {
+	var dupISBN *services.DuplicateISBNError
+	var merged *services.MergedAuthorError
+	var reviewed *services.ReviewExistsError
+	var unsent *services.CampaignSendError
+	var holding *services.HoldExistsError
+	switch {
+	case errors.As(err, &dupISBN):
+		detail := fmt.Sprintf("Book %d already has ISBN %s", dupISBN.BookID, dupISBN.ISBN)
+		if dupISBN.Deleted {
+			detail = fmt.Sprintf("Deleted book %d has ISBN %s; restore it instead", dupISBN.BookID, dupISBN.ISBN)
+		}
+		appErr := apperror.Wrap(err, http.StatusConflict, "isbn_taken", detail)
+		appErr.Location = fmt.Sprintf("/books/%d", dupISBN.BookID)
+		return appErr
+	case errors.Is(err, services.ErrUnknownAuthor):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "contributors", Code: "unknown_author", Message: err.Error()}})
+	case errors.As(err, &merged):
+		appErr := apperror.Wrap(err, http.StatusConflict, "author_merged", fmt.Sprintf("Author %d was merged into author %d", merged.ID, merged.MergedInto))
+		appErr.Location = fmt.Sprintf("/authors/%d", merged.MergedInto)
+		return appErr
+	case errors.Is(err, services.ErrMergeIntoSelf):
+		return apperror.Wrap(err, http.StatusUnprocessableEntity, "merge_into_self", "An author can't be merged into itself")
+	case errors.Is(err, services.ErrUnknownWork):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "work_id", Code: "unknown_work", Message: "must be an existing work"}})
+	case errors.Is(err, services.ErrUnknownSeries):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "series_id", Code: "unknown_series", Message: "must be an existing series"}})
+	case errors.Is(err, services.ErrUnknownBook):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "book_ids", Code: "unknown_book", Message: "must all be existing books"}})
+	case errors.Is(err, services.ErrCollectionFull):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "book_ids", Code: "collection_full", Message: err.Error()}})
+	case errors.Is(err, repositories.ErrOrderMismatch):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "book_ids", Code: "order_mismatch", Message: "must list each of the collection's books once"}})
+	case errors.Is(err, services.ErrUnknownParent):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "parent_id", Code: "unknown_subject", Message: "must be an existing subject"}})
+	case errors.Is(err, services.ErrSubjectCycle):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "parent_id", Code: "subject_cycle", Message: "can't be the subject itself or one below it"}})
+	case errors.Is(err, services.ErrSubjectHasChildren):
+		return apperror.Conflict("subject_has_children", "Move or delete the subject's children first")
+	case errors.Is(err, services.ErrTagTaken):
+		return apperror.Conflict("tag_taken", "Another tag has this name")
+	case errors.As(err, &reviewed):
+		appErr := apperror.Wrap(err, http.StatusConflict, "review_exists", "You have already reviewed this book; edit that review instead")
+		appErr.Location = fmt.Sprintf("/reviews/%d", reviewed.ReviewID)
+		return appErr
+	case errors.Is(err, services.ErrNotReviewAuthor):
+		return apperror.Wrap(err, http.StatusForbidden, apperror.CodeForbidden, "Only the review's author can change it")
+	case errors.As(err, &unsent):
+		appErr := apperror.Wrap(err, http.StatusServiceUnavailable, "campaign_send_failed",
+			fmt.Sprintf("Campaign %d was saved but could not be sent; it is marked failed", unsent.CampaignID))
+		appErr.Location = fmt.Sprintf("/campaigns/%d", unsent.CampaignID)
+		return appErr
+	case errors.Is(err, services.ErrNotBorrower):
+		return apperror.Wrap(err, http.StatusForbidden, "not_a_borrower", "Only members who have borrowed this book can review it")
+	case errors.Is(err, services.ErrUnknownMember):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "user_id", Code: "unknown_user", Message: "must be an existing member"}})
+	case errors.Is(err, services.ErrLoanUnknownBook):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "book_id", Code: "unknown_book", Message: "must be an existing book"}})
+	case errors.Is(err, services.ErrDueInPast):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "due_at", Code: "due_in_past", Message: "must be in the future"}})
+	case errors.Is(err, repositories.ErrBookOnLoan):
+		return apperror.Conflict("book_on_loan", "The book is already on loan; return that loan first")
+	case errors.Is(err, repositories.ErrBookOnHold):
+		return apperror.Conflict("book_on_hold", "The book is set aside for another member's hold")
+	case errors.As(err, &holding):
+		appErr := apperror.Wrap(err, http.StatusConflict, "hold_exists", "You already have a hold on this work")
+		appErr.Location = fmt.Sprintf("/holds/%d", holding.HoldID)
+		return appErr
+	case errors.Is(err, repositories.ErrHoldClosed):
+		return apperror.Conflict("hold_closed", "The hold was already fulfilled or cancelled")
+	case errors.Is(err, repositories.ErrOpenLoans):
+		return apperror.Conflict("open_loans", "Books are still out on loans of this record; return them before purging it")
+	case errors.Is(err, repositories.ErrLoanReturned):
+		return apperror.Conflict("loan_returned", "The loan was already returned")
+	case errors.Is(err, cover.ErrUnsupportedType):
+		return apperror.Wrap(err, http.StatusUnsupportedMediaType, "unsupported_media_type", "Covers must be JPEG or PNG images")
+	case errors.Is(err, cover.ErrInvalidImage), errors.Is(err, cover.ErrTooLarge):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "file", Code: "invalid_image", Message: err.Error()}})
+	case errors.Is(err, services.ErrNoCover):
+		return apperror.NotFound("cover", "Book has no uploaded cover")
+	case errors.Is(err, services.ErrEnrichmentDisabled):
+		return apperror.New(http.StatusNotImplemented, "enrichment_disabled", "Metadata enrichment is not configured")
+	case errors.Is(err, services.ErrBookHasNoISBN):
+		return apperror.Wrap(err, http.StatusUnprocessableEntity, "book_has_no_isbn", "Add an ISBN to the book before enriching it")
+	case errors.Is(err, metadata.ErrNotFound):
+		return apperror.NotFound("metadata", "The metadata provider has no record for this ISBN")
+	case errors.Is(err, metadata.ErrUnavailable):
+		return apperror.Wrap(err, http.StatusBadGateway, "metadata_unavailable", "The metadata provider could not be reached; try again later")
+	case errors.Is(err, isbn.ErrInvalid):
+		return apperror.InvalidFields([]apperror.FieldError{{Field: "isbn", Code: "invalid_isbn", Message: "must be a valid ISBN-10 or ISBN-13"}})
+	case errors.Is(err, email.ErrTemplateNotFound):
+		return apperror.NotFound("template", "Email template not found")
+	case errors.Is(err, email.ErrInvalidTemplate):
+		// Parse and render errors are about the caller's own template
+		return apperror.Wrap(err, http.StatusUnprocessableEntity, "invalid_template", err.Error())
+	case errors.Is(err, email.ErrTaskNotFound):
+		return apperror.NotFound("task", "Task not found")
+	case errors.Is(err, email.ErrTaskNotRunning):
+		return apperror.Conflict("task_not_running", "Task is not running")
+	case errors.Is(err, email.ErrTaskNotPaused):
+		return apperror.Conflict("task_not_paused", "Task is not paused")
+	case errors.Is(err, email.ErrTaskFinished):
+		return apperror.Conflict("task_finished", "Task has already finished")
+	case errors.Is(err, services.ErrUsernameTaken):
+		return apperror.Conflict("username_taken", "Username is already taken")
+	case errors.Is(err, services.ErrDeleteSelf):
+		return apperror.Conflict("delete_self", "Admins can't delete their own account")
+	case errors.Is(err, services.ErrCampaignNotCancellable):
+		return apperror.Conflict("campaign_not_cancellable", "Only scheduled campaigns can be cancelled")
+	case errors.Is(err, services.ErrInvalidWebhookURL), errors.Is(err, services.ErrInvalidWebhookEvents):
+		return apperror.Wrap(err, http.StatusUnprocessableEntity, apperror.CodeValidationFailed, err.Error())
+	case errors.Is(err, bookimport.ErrUnknownFormat):
+		return apperror.Wrap(err, http.StatusUnsupportedMediaType, "unsupported_media_type", "Imports must be CSV (.csv, text/csv) or JSON Lines (.jsonl, application/x-ndjson)")
+	case errors.Is(err, bookimport.ErrMissingColumn), errors.As(err, new(*csv.ParseError)):
+		return apperror.Wrap(err, http.StatusUnprocessableEntity, "invalid_import", err.Error())
+	case errors.Is(err, repositories.ErrVersionConflict):
+		return apperror.PreconditionFailed("The resource was changed by someone else; fetch it again and retry")
+	case errors.Is(err, patch.ErrMalformed):
+		return apperror.Wrap(err, http.StatusBadRequest, "invalid_patch", err.Error())
+	case errors.Is(err, patch.ErrInvalid):
+		return apperror.Wrap(err, http.StatusUnprocessableEntity, "invalid_patch", err.Error())
+	case errors.Is(err, patch.ErrTestFailed):
+		return apperror.Wrap(err, http.StatusConflict, "patch_test_failed", err.Error())
+	}
+	return err
+}
+
+// orNotFound turns a missing record into a not found error for resource,
+// e.g. book_not_found.
+func orNotFound(err error, resource, detail string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apperror.NotFound(resource, detail)
+	}
+	return err
+}
+
+// pathID parses a single ID path parameter.
+func pathID(r *http.Request, name string) (uint, error) {
+	p := validate.NewParams(r)
+	id := p.PathID(name)
+	return id, p.Err()
+}
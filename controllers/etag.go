@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"library-api/apperror"
+	"library-api/models"
+)
+
+// versionETag is the strong ETag of a row at the given version.
+func versionETag(version uint) string {
+	return `"v` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// bookETag is the strong ETag of a book: its version, which edits bump, and
+// its rating, which reviews change without bumping the version.
+func bookETag(book *models.Book) string {
+	return `"v` + strconv.FormatUint(uint64(book.Version), 10) +
+		".r" + strconv.Itoa(book.RatingCount) + "-" + strconv.FormatFloat(book.RatingAverage, 'f', 2, 64) + `"`
+}
+
+// ifMatch checks a write's If-Match header against the current version and
+// returns the version the write must apply to. Writes without the header
+// are refused so that clients can't overwrite changes they haven't seen.
+// Only the version of a bookETag counts: a review in the meantime isn't a
+// change the write could overwrite.
+func ifMatch(r *http.Request, current uint) (uint, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, apperror.PreconditionRequired("Send If-Match with the ETag from your last read")
+	}
+	version := versionETag(current)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// If-Match uses strong comparison, so weak tags never match
+		if tag == "*" || tag == version || strings.HasPrefix(tag, strings.TrimSuffix(version, `"`)+".r") {
+			return current, nil
+		}
+	}
+	return 0, apperror.PreconditionFailed("The resource was changed by someone else; fetch it again and retry")
+}
+
+// notModified reports whether a GET's If-None-Match already names the
+// book as it is, in which case the caller answers 304.
+func notModified(r *http.Request, book *models.Book) bool {
+	return noneMatch(r, bookETag(book))
+}
+
+// noneMatch reports whether a GET's If-None-Match names etag.
+func noneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
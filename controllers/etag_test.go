@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"library-api/apperror"
+	"library-api/models"
+)
+
+func TestBookETag_ReviewDuringEdit(t *testing.T) {
+	book := &models.Book{Version: 3, RatingCount: 2, RatingAverage: 4}
+	read := bookETag(book)
+	assert.Equal(t, `"v3.r2-4.00"`, read)
+
+	// A review lands while the editor has the book open; the version stays
+	book.RatingCount, book.RatingAverage = 3, 4.33
+
+	get := httptest.NewRequest(http.MethodGet, "/books/1", nil)
+	get.Header.Set("If-None-Match", read)
+	assert.False(t, notModified(get, book), "a cached copy with the old rating is stale")
+	get.Header.Set("If-None-Match", bookETag(book))
+	assert.True(t, notModified(get, book))
+
+	put := httptest.NewRequest(http.MethodPut, "/books/1", nil)
+	put.Header.Set("If-Match", read)
+	version, err := ifMatch(put, book.Version)
+	require.NoError(t, err, "the review doesn't conflict with the edit")
+	assert.Equal(t, uint(3), version)
+
+	// Another edit does
+	_, err = ifMatch(put, book.Version+1)
+	var appErr *apperror.Error
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, http.StatusPreconditionFailed, appErr.Status)
+
+	put.Header.Set("If-Match", `"v3"`)
+	_, err = ifMatch(put, 3)
+	assert.NoError(t, err, "version-only tags from before still match")
+	put.Header.Set("If-Match", `"v31.r2-4.00"`)
+	_, err = ifMatch(put, 3)
+	assert.Error(t, err)
+}
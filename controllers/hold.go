@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"library-api/middleware"
+	"library-api/models"
+	"library-api/repositories"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type HoldController struct {
+	Service *services.HoldService
+}
+
+func NewHoldController(service *services.HoldService) *HoldController {
+	return &HoldController{Service: service}
+}
+
+var holdStatuses = []string{models.HoldWaiting, models.HoldReady, models.HoldFulfilled, models.HoldCancelled}
+
+// holder is the caller as services.HoldService sees them.
+func holder(r *http.Request) services.Holder {
+	claims := middleware.CurrentClaims(r)
+	return services.Holder{
+		UserID: claims.UserID,
+		Staff:  claims.Role == models.RoleStaff || claims.Role == models.RoleAdmin,
+	}
+}
+
+// PlaceHold queues the caller for the work. A second open hold on the same
+// work is refused with 409 and a Location pointing at the first.
+func (c *HoldController) PlaceHold(w http.ResponseWriter, r *http.Request) {
+	workID, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hold, err := c.Service.PlaceHold(workID, holder(r).UserID)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "work", "Work not found"))
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/holds/%d", hold.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hold)
+}
+
+// ListWorkHolds lists the work's holds in queue order; ?status= narrows
+// them.
+func (c *HoldController) ListWorkHolds(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	workID := p.PathID("id")
+	status := p.QueryOneOf("status", "", holdStatuses...)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	holds, err := c.Service.ListWorkHolds(workID, status, limit, offset)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "work", "Work not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holds)
+}
+
+// ListOwn lists the caller's holds, oldest first.
+func (c *HoldController) ListOwn(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	filter := repositories.HoldFilter{UserID: holder(r).UserID, Status: p.QueryOneOf("status", "", holdStatuses...)}
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	holds, err := c.Service.ListHolds(filter, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holds)
+}
+
+func (c *HoldController) GetHold(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hold, err := c.Service.GetHold(id, holder(r))
+	if err != nil {
+		writeError(w, r, orNotFound(err, "hold", "Hold not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
+
+// CancelHold cancels the hold and answers with it.
+func (c *HoldController) CancelHold(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hold, err := c.Service.CancelHold(id, holder(r))
+	if err != nil {
+		writeError(w, r, orNotFound(err, "hold", "Hold not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"library-api/apperror"
+	"library-api/bookimport"
+	"library-api/middleware"
+	"library-api/services"
+	"library-api/validate"
+)
+
+// MaxImportBytes bounds an import upload.
+const MaxImportBytes = 200 << 20
+
+type ImportController struct {
+	Service *services.ImportService
+}
+
+func NewImportController(service *services.ImportService) *ImportController {
+	return &ImportController{Service: service}
+}
+
+// StartImport takes a CSV or JSONL file, either as the raw body or as the
+// "file" field of a multipart form, and answers 202 with the new job. The
+// format comes from ?format=, the file name or the content type.
+func (c *ImportController) StartImport(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	format := p.QueryString("format", false)
+	dryRun := p.QueryBool("dry_run")
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportBytes)
+
+	var upload io.Reader = r.Body
+	filename, contentType := "", r.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		part, err := filePart(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer part.Close()
+		upload = part
+		filename, contentType = part.FileName(), part.Header.Get("Content-Type")
+	}
+	if format == "" {
+		format, _ = bookimport.DetectFormat(filename, contentType)
+	}
+	if format != bookimport.CSV && format != bookimport.JSONL {
+		writeError(w, r, bookimport.ErrUnknownFormat)
+		return
+	}
+
+	var userID uint
+	if claims := middleware.CurrentClaims(r); claims != nil {
+		userID = claims.UserID
+	}
+	job, err := c.Service.StartImport(upload, format, dryRun, userID)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, apperror.New(http.StatusRequestEntityTooLarge, apperror.CodeBodyTooLarge,
+			fmt.Sprintf("Imports must not be larger than %d MB", MaxImportBytes>>20)))
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/books/import/%d", job.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// filePart streams the "file" field of a multipart upload without
+// buffering the whole form.
+func filePart(r *http.Request) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, apperror.BadRequest("Request body is not a valid multipart form")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, apperror.InvalidFields([]apperror.FieldError{{Field: "file", Code: "required", Message: "is required"}})
+		}
+		if err != nil {
+			return nil, apperror.BadRequest("Request body is not a valid multipart form")
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+func (c *ImportController) ListImports(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jobs, err := c.Service.ListImports(limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func (c *ImportController) GetImport(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	job, err := c.Service.GetImport(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "import", "Import not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// ListImportErrors pages through the rows that were rejected, by line.
+func (c *ImportController) ListImportErrors(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	limit := p.QueryInt("limit", 100, 1, 1000)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rowErrors, err := c.Service.ImportErrors(id, limit, offset)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "import", "Import not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rowErrors)
+}
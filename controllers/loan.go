@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"library-api/middleware"
+	"library-api/repositories"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type LoanController struct {
+	Service *services.LoanService
+}
+
+func NewLoanController(service *services.LoanService) *LoanController {
+	return &LoanController{Service: service}
+}
+
+type checkoutRequest struct {
+	BookID uint       `json:"book_id" validate:"required"`
+	UserID uint       `json:"user_id" validate:"required"`
+	DueAt  *time.Time `json:"due_at"` // Defaults to the lending period from now
+}
+
+// loanFilter reads ?book_id=, ?user_id= and ?open=.
+func loanFilter(r *http.Request, p *validate.Params) repositories.LoanFilter {
+	filter := repositories.LoanFilter{
+		BookID: uint(p.QueryInt("book_id", 0, 0, math.MaxInt32)),
+		UserID: uint(p.QueryInt("user_id", 0, 0, math.MaxInt32)),
+	}
+	if r.URL.Query().Has("open") {
+		open := p.QueryBool("open")
+		filter.Open = &open
+	}
+	return filter
+}
+
+// ListLoans is the staff's view of every loan, most recently borrowed
+// first.
+func (c *LoanController) ListLoans(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	filter := loanFilter(r, p)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	loans, err := c.Service.ListLoans(filter, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loans)
+}
+
+// ListOwn lists the caller's loans; ?open=true only the books they have
+// out.
+func (c *LoanController) ListOwn(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	filter := loanFilter(r, p)
+	filter.UserID = middleware.CurrentClaims(r).UserID
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	loans, err := c.Service.ListLoans(filter, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loans)
+}
+
+func (c *LoanController) GetLoan(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	loan, err := c.Service.GetLoan(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "loan", "Loan not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loan)
+}
+
+// CreateLoan checks a book out to a member. A book already out is refused
+// with 409 book_on_loan.
+func (c *LoanController) CreateLoan(w http.ResponseWriter, r *http.Request) {
+	var req checkoutRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	loan, err := c.Service.Checkout(req.BookID, req.UserID, req.DueAt)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/loans/%d", loan.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(loan)
+}
+
+// ReturnLoan checks the book back in and answers with the closed loan.
+func (c *LoanController) ReturnLoan(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	loan, err := c.Service.Return(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "loan", "Loan not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loan)
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"library-api/apperror"
+	"library-api/middleware"
+	"library-api/notify"
+)
+
+type NotificationController struct {
+	Notifier *notify.Notifier
+	upgrader websocket.Upgrader
+}
+
+func NewNotificationController(notifier *notify.Notifier) *NotificationController {
+	c := &NotificationController{Notifier: notifier}
+	c.upgrader.Error = func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		apperror.Write(w, r, apperror.New(status, apperror.CodeInvalidRequest, reason.Error()))
+	}
+	return c
+}
+
+// ServeWS upgrades to a WebSocket for the authenticated caller. Clients pick
+// topics with {"action": "subscribe", "topics": [...]}.
+func (c *NotificationController) ServeWS(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.CurrentClaims(r)
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has already replied
+	}
+	c.Notifier.Serve(conn, claims.UserID, claims.Role)
+}
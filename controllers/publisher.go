@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"library-api/services"
+	"library-api/validate"
+)
+
+// PublisherController is read-only: publishers are created by naming them
+// on a book.
+type PublisherController struct {
+	Service *services.PublisherService
+}
+
+func NewPublisherController(service *services.PublisherService) *PublisherController {
+	return &PublisherController{Service: service}
+}
+
+func (c *PublisherController) ListPublishers(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	query := p.QueryString("q", false)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	publishers, err := c.Service.ListPublishers(query, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(publishers)
+}
+
+func (c *PublisherController) GetPublisher(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	publisher, err := c.Service.GetPublisher(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "publisher", "Publisher not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(publisher)
+}
+
+func (c *PublisherController) GetPublisherBooks(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	limit := p.QueryInt("limit", 10, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	books, err := c.Service.GetPublisherBooks(id, limit, offset)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "publisher", "Publisher not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(books)
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"library-api/middleware"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type RecommendationController struct {
+	Service *services.RecommendationService
+}
+
+func NewRecommendationController(service *services.RecommendationService) *RecommendationController {
+	return &RecommendationController{Service: service}
+}
+
+// ForMember recommends books the caller hasn't read yet.
+func (c *RecommendationController) ForMember(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	limit := p.QueryInt("limit", 20, 1, 50)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	recommendations, err := c.Service.ForMember(middleware.CurrentClaims(r).UserID, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recommendations)
+}
+
+// Similar lists books read by the same members as the book, or sharing its
+// authors or subjects.
+func (c *RecommendationController) Similar(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	limit := p.QueryInt("limit", 10, 1, 50)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	recommendations, err := c.Service.Similar(id, limit)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recommendations)
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"library-api/middleware"
+	"library-api/models"
+	"library-api/repositories"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type ReviewController struct {
+	Service *services.ReviewService
+}
+
+func NewReviewController(service *services.ReviewService) *ReviewController {
+	return &ReviewController{Service: service}
+}
+
+type reviewRequest struct {
+	Rating int    `json:"rating" validate:"required,min=1,max=5"`
+	Text   string `json:"text" validate:"max=10000"`
+}
+
+type hideRequest struct {
+	Hidden *bool  `json:"hidden" validate:"required"`
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// reviewer is the caller as services.ReviewService sees them; nobody on
+// public routes.
+func reviewer(r *http.Request) services.Reviewer {
+	claims := middleware.CurrentClaims(r)
+	if claims == nil {
+		return services.Reviewer{}
+	}
+	return services.Reviewer{
+		UserID:    claims.UserID,
+		Moderator: claims.Role == models.RoleStaff || claims.Role == models.RoleAdmin,
+	}
+}
+
+// ListBookReviews lists the book's visible reviews, newest first.
+func (c *ReviewController) ListBookReviews(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	bookID := p.PathID("id")
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	reviews, err := c.Service.ListBookReviews(bookID, limit, offset)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// ListReviews is the moderators' view of every review, hidden ones
+// included; ?hidden=true lists only those.
+func (c *ReviewController) ListReviews(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	filter := repositories.ReviewFilter{
+		BookID: uint(p.QueryInt("book_id", 0, 0, math.MaxInt32)),
+		UserID: uint(p.QueryInt("user_id", 0, 0, math.MaxInt32)),
+	}
+	if r.URL.Query().Has("hidden") {
+		hidden := p.QueryBool("hidden")
+		filter.Hidden = &hidden
+	}
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	reviews, err := c.Service.ListReviews(filter, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+func (c *ReviewController) GetReview(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	review, err := c.Service.GetReview(id, reviewer(r))
+	if err != nil {
+		writeError(w, r, orNotFound(err, "review", "Review not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// CreateReview reviews the book as the caller. A second review of the same
+// book is refused with 409 and a Location pointing at the first.
+func (c *ReviewController) CreateReview(w http.ResponseWriter, r *http.Request) {
+	bookID, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req reviewRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	review, err := c.Service.CreateReview(bookID, reviewer(r), req.Rating, req.Text)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "Book not found"))
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/reviews/%d", review.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+func (c *ReviewController) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req reviewRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	review, err := c.Service.UpdateReview(id, reviewer(r), req.Rating, req.Text)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "review", "Review not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+func (c *ReviewController) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.DeleteReview(id, reviewer(r)); err != nil {
+		writeError(w, r, orNotFound(err, "review", "Review not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ModerateReview hides a review, with an optional reason, or shows it
+// again: {"hidden": true, "reason": "Spoilers"}.
+func (c *ReviewController) ModerateReview(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req hideRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	review, err := c.Service.HideReview(id, reviewer(r).UserID, *req.Hidden, req.Reason)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "review", "Review not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"library-api/models"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type SeriesController struct {
+	Service *services.SeriesService
+}
+
+func NewSeriesController(service *services.SeriesService) *SeriesController {
+	return &SeriesController{Service: service}
+}
+
+// seriesResponse lists the series' books in volume order.
+type seriesResponse struct {
+	models.Series
+	Books []models.Book `json:"books"`
+}
+
+func (c *SeriesController) ListSeries(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	query := p.QueryString("q", false)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	series, err := c.Service.ListSeries(query, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+func (c *SeriesController) CreateSeries(w http.ResponseWriter, r *http.Request) {
+	var req workRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	series, err := c.Service.CreateSeries(&models.Series{Title: req.Title, Description: req.Description})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/series/%d", series.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(seriesResponse{Series: *series, Books: []models.Book{}})
+}
+
+func (c *SeriesController) GetSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	series, books, err := c.Service.GetSeries(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "series", "Series not found"))
+		return
+	}
+	if books == nil {
+		books = []models.Book{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seriesResponse{Series: *series, Books: books})
+}
+
+func (c *SeriesController) UpdateSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req workRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	series, err := c.Service.UpdateSeries(id, models.Series{Title: req.Title, Description: req.Description})
+	if err != nil {
+		writeError(w, r, orNotFound(err, "series", "Series not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+func (c *SeriesController) DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.DeleteSeries(id); err != nil {
+		writeError(w, r, orNotFound(err, "series", "Series not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
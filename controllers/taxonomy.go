@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"library-api/models"
+	"library-api/repositories"
+	"library-api/services"
+	"library-api/validate"
+)
+
+// TaxonomyController serves subjects (and genres) and tags.
+type TaxonomyController struct {
+	Service *services.TaxonomyService
+}
+
+func NewTaxonomyController(service *services.TaxonomyService) *TaxonomyController {
+	return &TaxonomyController{Service: service}
+}
+
+type subjectRequest struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	Kind     string `json:"kind" validate:"oneof=subject|genre"` // Top-level subjects only; defaults to subject
+	ParentID *uint  `json:"parent_id"`
+}
+
+func (req subjectRequest) input() services.SubjectInput {
+	return services.SubjectInput{Name: req.Name, Kind: req.Kind, ParentID: req.ParentID}
+}
+
+type tagRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// ListSubjects lists subjects in tree order. ?kind= picks subjects or
+// genres, ?parent_id= the children of one subject (0 for the top level),
+// and ?q= matches part of the name.
+func (c *TaxonomyController) ListSubjects(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	filter := repositories.SubjectFilter{
+		Kind:  p.QueryOneOf("kind", "", models.SubjectKindSubject, models.SubjectKindGenre),
+		Query: p.QueryString("q", false),
+	}
+	if r.URL.Query().Has("parent_id") {
+		parentID := uint(p.QueryInt("parent_id", 0, 0, math.MaxInt32))
+		filter.ParentID = &parentID
+	}
+	limit := p.QueryInt("limit", 100, 1, 500)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	subjects, err := c.Service.ListSubjects(filter, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subjects)
+}
+
+func (c *TaxonomyController) GetSubject(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	subject, err := c.Service.GetSubject(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "subject", "Subject not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subject)
+}
+
+func (c *TaxonomyController) CreateSubject(w http.ResponseWriter, r *http.Request) {
+	var req subjectRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	subject, err := c.Service.CreateSubject(req.input())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/subjects/%d", subject.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subject)
+}
+
+// UpdateSubject renames a subject or moves it, with its subtree, under
+// another parent; parent_id null makes it top-level.
+func (c *TaxonomyController) UpdateSubject(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req subjectRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	subject, err := c.Service.UpdateSubject(id, req.input())
+	if err != nil {
+		writeError(w, r, orNotFound(err, "subject", "Subject not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subject)
+}
+
+func (c *TaxonomyController) DeleteSubject(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.DeleteSubject(id); err != nil {
+		writeError(w, r, orNotFound(err, "subject", "Subject not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *TaxonomyController) ListTags(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	query := p.QueryString("q", false)
+	limit := p.QueryInt("limit", 100, 1, 500)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	tags, err := c.Service.ListTags(query, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (c *TaxonomyController) GetTag(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	tag, err := c.Service.GetTag(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "tag", "Tag not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (c *TaxonomyController) CreateTag(w http.ResponseWriter, r *http.Request) {
+	var req tagRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	tag, err := c.Service.CreateTag(req.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/tags/%d", tag.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (c *TaxonomyController) RenameTag(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req tagRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	tag, err := c.Service.RenameTag(id, req.Name)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "tag", "Tag not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (c *TaxonomyController) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.DeleteTag(id); err != nil {
+		writeError(w, r, orNotFound(err, "tag", "Tag not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"library-api/services"
+	"library-api/validate"
+)
+
+// TrashController is the admins' view of deleted books and users.
+type TrashController struct {
+	Service *services.TrashService
+}
+
+func NewTrashController(service *services.TrashService) *TrashController {
+	return &TrashController{Service: service}
+}
+
+// ListBooks lists deleted books, most recently deleted first.
+func (c *TrashController) ListBooks(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	books, err := c.Service.ListBooks(limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(books)
+}
+
+// RestoreBook undeletes the book and answers with it. A live book holding
+// the same ISBN is refused with 409.
+func (c *TrashController) RestoreBook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	book, err := c.Service.RestoreBook(r.Context(), id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "book", "No deleted book with this ID"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+func (c *TrashController) PurgeBook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.PurgeBook(id); err != nil {
+		writeError(w, r, orNotFound(err, "book", "No deleted book with this ID"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUsers lists deleted users, most recently deleted first.
+func (c *TrashController) ListUsers(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	users, err := c.Service.ListUsers(limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// RestoreUser undeletes the user and answers with them. A live user with
+// the same username is refused with 409.
+func (c *TrashController) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	user, err := c.Service.RestoreUser(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "user", "No deleted user with this ID"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (c *TrashController) PurgeUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.PurgeUser(id); err != nil {
+		writeError(w, r, orNotFound(err, "user", "No deleted user with this ID"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,13 +2,20 @@ package controllers
 
 import (
     "encoding/json"
+    "errors"
     "fmt"
     "net/http"
     "os"
+    "strconv"
     "time"
-    "library-api/models"
+    "library-api/apperror"
+    "library-api/broadcast"
+    "library-api/email"
+    "library-api/middleware"
     "library-api/services"
+    "library-api/validate"
     "github.com/dgrijalva/jwt-go"
+    "github.com/gorilla/mux"
 )
 
 type UserController struct {
@@ -21,202 +28,197 @@ func NewUserController(service *services.UserService) *UserController {
 
 func (c *UserController) CreateUser(w http.ResponseWriter, r *http.Request) {
     var req struct {
-        Username string `json:"username"`
-        Password string `json:"password"`
-        Email    string `json:"email"`
+        Username string `json:"username" validate:"required,min=3,max=50"`
+        Password string `json:"password" validate:"required,min=8,max=72"` // bcrypt ignores anything past 72 bytes
+        Email    string `json:"email" validate:"required,email,max=255"`
     }
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+    if err := validate.DecodeJSON(w, r, &req); err != nil {
+        writeError(w, r, err)
         return
     }
     user, err := c.Service.CreateUser(req.Username, req.Password, req.Email)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        writeError(w, r, err)
         return
     }
+    w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusCreated)
     json.NewEncoder(w).Encode(user)
 }
 
+// DeleteUser soft-deletes a user; see the trash to restore or purge them.
+func (c *UserController) DeleteUser(w http.ResponseWriter, r *http.Request) {
+    id, err := pathID(r, "id")
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    if err := c.Service.DeleteUser(id, middleware.CurrentClaims(r).UserID); err != nil {
+        writeError(w, r, orNotFound(err, "user", "User not found"))
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
 func (c *UserController) Login(w http.ResponseWriter, r *http.Request) {
     var req struct {
-        Username string `json:"username"`
-        Password string `json:"password"`
+        Username string `json:"username" validate:"required"`
+        Password string `json:"password" validate:"required"`
     }
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+    if err := validate.DecodeJSON(w, r, &req); err != nil {
+        writeError(w, r, err)
         return
     }
     user, err := c.Service.Login(req.Username, req.Password)
     if err != nil {
-        http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+        writeError(w, r, apperror.Unauthorized(apperror.CodeInvalidCredentials, "Invalid username or password"))
         return
     }
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
         "username": user.Username,
+        "user_id":  user.ID,
+        "role":     user.Role,
         "exp":      time.Now().Add(time.Hour * 24).Unix(),
     })
     tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
     if err != nil {
-        http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+        writeError(w, r, err)
         return
     }
+    w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
 }
 
-func (c *UserController) SendBulkEmails(w http.ResponseWriter, r *http.Request) {
-    users, err := c.Service.Repo.DB.Find(&[]models.User{}).Rows()
-    if err != nil {
-        http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+// StreamBulkEmailStatus streams task progress as server-sent events. Every
+// event has an id; a client that reconnects with Last-Event-ID gets what it
+// missed, or a "snapshot" event with the full task if that is no longer buffered.
+func (c *UserController) StreamBulkEmailStatus(w http.ResponseWriter, r *http.Request) {
+    p := validate.NewParams(r)
+    taskID := p.QueryString("task_id", true)
+    if err := p.Err(); err != nil {
+        writeError(w, r, err)
         return
     }
-    defer users.Close()
+    lastEventID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
 
-    var emails []string
-    for users.Next() {
-        var user models.User
-        c.Service.Repo.DB.ScanRows(users, &user)
-        if user.Email != "" {
-            emails = append(emails, user.Email)
-        }
-    }
-
-    taskID := c.Service.EmailService.SendBulk(emails, "Library Update", "New books added!")
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]string{
-        "task_id": taskID,
-        "message": "Bulk emails queued",
-    })
-}
-
-func (c *UserController) StreamBulkEmailStatus(w http.ResponseWriter, r *http.Request) {
-    taskID := r.URL.Query().Get("task_id")
-    if taskID == "" {
-        http.Error(w, "Missing task_id", http.StatusBadRequest)
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        writeError(w, r, errors.New("response writer does not support flushing"))
         return
     }
 
-    task, ok := c.Service.EmailService.GetTaskStatus(taskID)
-    if !ok {
-        http.Error(w, "Task not found", http.StatusNotFound)
+    if _, ok := c.Service.EmailService.Snapshot(taskID); !ok {
+        writeError(w, r, email.ErrTaskNotFound)
         return
     }
+    // Subscribe before reading the snapshot we send, so nothing between the two is lost
+    sub, replay, complete := c.Service.EmailService.Subscribe(taskID, lastEventID)
+    defer sub.Close()
+    task, _ := c.Service.EmailService.Snapshot(taskID)
 
     // Set SSE headers
     w.Header().Set("Content-Type", "text/event-stream")
     w.Header().Set("Cache-Control", "no-cache")
     w.Header().Set("Connection", "keep-alive")
+    w.Header().Set("X-Accel-Buffering", "no")
 
-    flusher, ok := w.(http.Flusher)
-    if !ok {
-        http.Error(w, "Streaming not supported", http.StatusInternalServerError)
-        return
+    sent := lastEventID
+    if !complete {
+        data, _ := json.Marshal(task)
+        fmt.Fprintf(w, "id: %d\nevent: snapshot\ndata: %s\n\n", task.Seq, data)
+        flusher.Flush()
+        sent = task.Seq
+        if !task.InProgress {
+            return
+        }
     }
-
-    // Stream updates
-    type EmailStatusResponse struct {
-        Email  string `json:"email"`
-        ID     string `json:"id"`
-        Status string `json:"status"`
-        Time   string `json:"time"`
+    write := func(event broadcast.Event) bool {
+        if event.ID <= sent {
+            return true // Already covered by the snapshot
+        }
+        sent = event.ID
+        fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.ID, event.Data)
+        flusher.Flush()
+        return event.Type != "final"
+    }
+    for _, event := range replay {
+        if !write(event) {
+            return
+        }
     }
 
-    for status := range task.Updates {
-        var email string
-        for e, id := range task.Emails {
-            if id == status.ID {
-                email = e
-                break
+    heartbeat := time.NewTicker(15 * time.Second)
+    defer heartbeat.Stop()
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case <-heartbeat.C:
+            fmt.Fprint(w, ": heartbeat\n\n")
+            flusher.Flush()
+        case event, ok := <-sub.C:
+            if !ok {
+                // Dropped for being too slow; the client reconnects with Last-Event-ID
+                return
+            }
+            if !write(event) {
+                return
             }
         }
-        resp := EmailStatusResponse{
-            Email:  email,
-            ID:     status.ID,
-            Status: status.Status,
-            Time:   status.Time.Format(time.RFC3339),
-        }
-        data, _ := json.Marshal(resp)
-        fmt.Fprintf(w, "data: %s\n\n", data)
-        flusher.Flush()
     }
-
-    // Send final task completion event
-    final := struct {
-        TaskID     string `json:"task_id"`
-        Total      int    `json:"total"`
-        Completed  int    `json:"completed"`
-        InProgress bool   `json:"in_progress"`
-    }{
-        TaskID:     task.ID,
-        Total:      task.Total,
-        Completed:  task.Completed,
-        InProgress: task.InProgress,
-    }
-    data, _ := json.Marshal(final)
-    fmt.Fprintf(w, "data: %s\n\n", data)
-    flusher.Flush()
 }
 
 // Keep GetBulkEmailStatus for polling if needed
 func (c *UserController) GetBulkEmailStatus(w http.ResponseWriter, r *http.Request) {
-    taskID := r.URL.Query().Get("task_id")
-    if taskID == "" {
-        http.Error(w, "Missing task_id", http.StatusBadRequest)
+    p := validate.NewParams(r)
+    taskID := p.QueryString("task_id", true)
+    if err := p.Err(); err != nil {
+        writeError(w, r, err)
         return
     }
 
-    task, ok := c.Service.EmailService.GetTaskStatus(taskID)
+    // Served from memory or, for tasks run by another replica, from Redis
+    task, ok := c.Service.EmailService.Snapshot(taskID)
     if !ok {
-        http.Error(w, "Task not found", http.StatusNotFound)
+        writeError(w, r, email.ErrTaskNotFound)
         return
     }
-	
-	type EmailStatus struct {
-        ID     string
-        Status string
-        Time   time.Time
-    }
-
-    type EmailStatusResponse struct {
-        Email  string `json:"email"`
-        ID     string `json:"id"`
-        Status string `json:"status"`
-        Time   string `json:"time"`
-    }
-    type TaskResponse struct {
-        TaskID     string              `json:"task_id"`
-        Total      int                 `json:"total"`
-        Completed  int                 `json:"completed"`
-        InProgress bool                `json:"in_progress"`
-        Emails     []EmailStatusResponse `json:"emails"`
-    }
-
-    response := TaskResponse{
-        TaskID:     task.ID,
-        Total:      task.Total,
-        Completed:  task.Completed,
-        InProgress: task.InProgress,
-        Emails:     []EmailStatusResponse{},
-    }
-
-    task.Statuses.Range(func(key, value interface{}) bool {
-        status := value.(EmailStatus)
-        var email string
-        for e, id := range task.Emails {
-            if id == status.ID {
-                email = e
-                break
-            }
-        }
-        response.Emails = append(response.Emails, EmailStatusResponse{
-            Email:  email,
-            ID:     status.ID,
-            Status: status.Status,
-            Time:   status.Time.Format(time.RFC3339),
-        })
-        return true
-    })
+    if task.Emails == nil {
+        task.Emails = []email.RecipientStatus{}
+    }
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+    json.NewEncoder(w).Encode(task)
+}
+
+// PauseBulkEmails, ResumeBulkEmails and CancelBulkEmails control a running task.
+// Workers check the task state before every message.
+func (c *UserController) PauseBulkEmails(w http.ResponseWriter, r *http.Request) {
+    c.controlBulkEmails(w, r, c.Service.EmailService.PauseTask)
+}
+
+func (c *UserController) ResumeBulkEmails(w http.ResponseWriter, r *http.Request) {
+    c.controlBulkEmails(w, r, c.Service.EmailService.ResumeTask)
+}
+
+func (c *UserController) CancelBulkEmails(w http.ResponseWriter, r *http.Request) {
+    c.controlBulkEmails(w, r, c.Service.EmailService.CancelTask)
+}
+
+func (c *UserController) controlBulkEmails(w http.ResponseWriter, r *http.Request, action func(string) error) {
+    taskID := mux.Vars(r)["task_id"] // The route only matches non-empty IDs
+    if err := action(taskID); err != nil {
+        writeError(w, r, err)
+        return
+    }
+    // Tasks run by another replica may still show their old state for a moment
+    state := ""
+    if task, ok := c.Service.EmailService.Snapshot(taskID); ok {
+        state = task.State
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "task_id": taskID,
+        "state":   state,
+    })
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"math"
+	"strings"
+
+	"library-api/middleware"
+	"library-api/models"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type WebhookController struct {
+	Service *services.WebhookService
+}
+
+func NewWebhookController(service *services.WebhookService) *WebhookController {
+	return &WebhookController{Service: service}
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"required,max=20"`
+	Secret string   `json:"secret" validate:"min=16,max=255"`
+	Active *bool    `json:"active"`
+}
+
+// webhookResponse lists events as an array. The secret is only included
+// when the webhook is created.
+type webhookResponse struct {
+	models.Webhook
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+func toWebhookResponse(hook *models.Webhook) webhookResponse {
+	return webhookResponse{Webhook: *hook, Events: services.WebhookEvents(*hook)}
+}
+
+func (c *WebhookController) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hook := &models.Webhook{URL: req.URL, Events: strings.Join(req.Events, ","), Secret: req.Secret}
+	if claims := middleware.CurrentClaims(r); claims != nil {
+		hook.CreatedBy = claims.Username
+	}
+	hook, err := c.Service.CreateWebhook(hook)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := toWebhookResponse(hook)
+	resp.Secret = hook.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (c *WebhookController) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := c.Service.ListWebhooks()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := make([]webhookResponse, 0, len(hooks))
+	for i := range hooks {
+		resp = append(resp, toWebhookResponse(&hooks[i]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (c *WebhookController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hook, err := c.Service.GetWebhook(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "webhook", "Webhook not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toWebhookResponse(hook))
+}
+
+func (c *WebhookController) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req webhookRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	update := models.Webhook{URL: req.URL, Events: strings.Join(req.Events, ","), Secret: req.Secret, Active: true}
+	if req.Active != nil {
+		update.Active = *req.Active
+	}
+	hook, err := c.Service.UpdateWebhook(id, update)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "webhook", "Webhook not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toWebhookResponse(hook))
+}
+
+func (c *WebhookController) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.DeleteWebhook(id); err != nil {
+		writeError(w, r, orNotFound(err, "webhook", "Webhook not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *WebhookController) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	limit := p.QueryInt("limit", 50, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	deliveries, err := c.Service.ListDeliveries(id, limit, offset)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "webhook", "Webhook not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func (c *WebhookController) Redeliver(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	deliveryID := p.PathID("delivery_id")
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	delivery, err := c.Service.Redeliver(id, deliveryID)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "delivery", "Delivery not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"library-api/models"
+	"library-api/services"
+	"library-api/validate"
+)
+
+type WorkController struct {
+	Service *services.WorkService
+}
+
+func NewWorkController(service *services.WorkService) *WorkController {
+	return &WorkController{Service: service}
+}
+
+// workRequest is the body of POST and PUT /works, and of POST and PUT
+// /series, which describe themselves the same way.
+type workRequest struct {
+	Title       string `json:"title" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=10000"`
+}
+
+type addEditionsRequest struct {
+	BookIDs []uint `json:"book_ids" validate:"required,max=500"`
+}
+
+type workResponse struct {
+	models.Work
+	EditionCount int64 `json:"edition_count"`
+}
+
+func (c *WorkController) ListWorks(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	query := p.QueryString("q", false)
+	limit := p.QueryInt("limit", 20, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	works, err := c.Service.ListWorks(query, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(works)
+}
+
+func (c *WorkController) CreateWork(w http.ResponseWriter, r *http.Request) {
+	var req workRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	work, err := c.Service.CreateWork(&models.Work{Title: req.Title, Description: req.Description})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/works/%d", work.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workResponse{Work: *work})
+}
+
+func (c *WorkController) GetWork(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	work, editions, err := c.Service.GetWork(id)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "work", "Work not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workResponse{Work: *work, EditionCount: editions})
+}
+
+func (c *WorkController) UpdateWork(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req workRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	work, err := c.Service.UpdateWork(id, models.Work{Title: req.Title, Description: req.Description})
+	if err != nil {
+		writeError(w, r, orNotFound(err, "work", "Work not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(work)
+}
+
+func (c *WorkController) DeleteWork(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.DeleteWork(id); err != nil {
+		writeError(w, r, orNotFound(err, "work", "Work not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListEditions lists the books that are editions of the work.
+func (c *WorkController) ListEditions(w http.ResponseWriter, r *http.Request) {
+	p := validate.NewParams(r)
+	id := p.PathID("id")
+	limit := p.QueryInt("limit", 10, 1, 100)
+	offset := p.QueryInt("offset", 0, 0, math.MaxInt32)
+	if err := p.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	books, err := c.Service.GetEditions(id, limit, offset)
+	if err != nil {
+		writeError(w, r, orNotFound(err, "work", "Work not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(books)
+}
+
+// AddEditions groups existing books under the work.
+func (c *WorkController) AddEditions(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req addEditionsRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.Service.AddEditions(id, req.BookIDs); err != nil {
+		writeError(w, r, orNotFound(err, "work", "Work not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,161 @@
+// Package cover turns an uploaded cover image into the sizes the API
+// serves. Every size is decoded and re-encoded, which drops EXIF and any
+// other metadata the upload carried; the EXIF orientation is applied to the
+// pixels first so phone photos stay upright.
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("cover must be a JPEG or PNG image")
+	ErrInvalidImage    = errors.New("cover image can't be decoded")
+	ErrTooLarge        = errors.New("cover image dimensions are too large")
+)
+
+// MaxPixels bounds the decoded size of an upload; a small file can
+// describe a huge image.
+const MaxPixels = 50_000_000
+
+// Size is a rendition of the cover that fits in a Max x Max box.
+type Size struct {
+	Name string
+	Max  int
+}
+
+const (
+	Small    = "small"
+	Medium   = "medium"
+	Large    = "large"
+	Original = "original"
+)
+
+// Sizes lists the renditions, largest first. Original is the upload itself,
+// cleaned and capped at a size still worth serving.
+var Sizes = []Size{
+	{Original, 1600},
+	{Large, 640},
+	{Medium, 320},
+	{Small, 160},
+}
+
+// Image is one encoded rendition.
+type Image struct {
+	Size        string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Process checks the upload and renders every size in its format, JPEG or
+// PNG. Images are never scaled up.
+func Process(data []byte) ([]Image, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupportedType
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	img := toRGBA(decoded)
+	if contentType == "image/jpeg" {
+		img = orient(img, Orientation(data))
+	}
+
+	images := make([]Image, 0, len(Sizes))
+	for _, size := range Sizes {
+		img = fit(img, size.Max) // Each size is scaled from the previous, larger one
+		var buf bytes.Buffer
+		if contentType == "image/png" {
+			err = png.Encode(&buf, img)
+		} else {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, Image{
+			Size:        size.Name,
+			ContentType: contentType,
+			Width:       img.Bounds().Dx(),
+			Height:      img.Bounds().Dy(),
+			Data:        buf.Bytes(),
+		})
+	}
+	return images, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// fit scales src down, keeping its aspect ratio, until both sides are at
+// most max. Each destination pixel is the average of the source pixels it
+// covers.
+func fit(src *image.RGBA, max int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= max && h <= max {
+		return src
+	}
+	nw, nh := max, h*max/w
+	if h > w {
+		nw, nh = w*max/h, max
+	}
+	nw, nh = atLeastOne(nw), atLeastOne(nh)
+
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for dy := 0; dy < nh; dy++ {
+		y0, y1 := span(dy, h, nh)
+		for dx := 0; dx < nw; dx++ {
+			x0, x1 := span(dx, w, nw)
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r, g, b, a = r+int(p[0]), g+int(p[1]), b+int(p[2]), a+int(p[3])
+					n++
+				}
+			}
+			p := dst.Pix[dy*dst.Stride+dx*4:]
+			p[0], p[1], p[2], p[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// span is the range of source pixels that destination pixel i of n covers
+// when size source pixels are shrunk to n.
+func span(i, size, n int) (int, int) {
+	start, end := i*size/n, (i+1)*size/n
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
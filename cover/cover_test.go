@@ -0,0 +1,171 @@
+package cover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testImage is w x h, white with a red top-left pixel block so
+// orientation changes are visible.
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{255, 255, 255, 255}
+			if x < w/4 && y < h/4 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	return buf.Bytes()
+}
+
+// withExif inserts an APP1 segment holding an orientation and a camera
+// make right after the JPEG's SOI marker.
+func withExif(data []byte, order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+	entry := tiff[10:]
+	order.PutUint16(entry, 0x010F) // Make, ASCII "Cam"
+	order.PutUint16(entry[2:], 2)
+	order.PutUint32(entry[4:], 4)
+	copy(entry[8:], "Cam\x00")
+	entry = tiff[22:]
+	order.PutUint16(entry, orientationTag)
+	order.PutUint16(entry[2:], 3)
+	order.PutUint32(entry[4:], 1)
+	order.PutUint16(entry[8:], orientation)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestOrientation(t *testing.T) {
+	plain := encodeJPEG(t, testImage(8, 4))
+	assert.Equal(t, 1, Orientation(plain))
+	assert.Equal(t, 6, Orientation(withExif(plain, binary.BigEndian, 6)))
+	assert.Equal(t, 8, Orientation(withExif(plain, binary.LittleEndian, 8)))
+	assert.Equal(t, 1, Orientation(withExif(plain, binary.BigEndian, 42)), "out of range")
+	assert.Equal(t, 1, Orientation([]byte("not a jpeg")))
+	assert.Equal(t, 1, Orientation(withExif(plain, binary.BigEndian, 6)[:20]), "truncated")
+}
+
+func TestOrient(t *testing.T) {
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	src := testImage(4, 2)
+	src.SetRGBA(0, 0, red)
+	src.SetRGBA(3, 1, blue)
+
+	cases := []struct {
+		orientation int
+		w, h        int
+		red, blue   image.Point
+	}{
+		{1, 4, 2, image.Pt(0, 0), image.Pt(3, 1)},
+		{2, 4, 2, image.Pt(3, 0), image.Pt(0, 1)},
+		{3, 4, 2, image.Pt(3, 1), image.Pt(0, 0)},
+		{4, 4, 2, image.Pt(0, 1), image.Pt(3, 0)},
+		{5, 2, 4, image.Pt(0, 0), image.Pt(1, 3)},
+		{6, 2, 4, image.Pt(1, 0), image.Pt(0, 3)},
+		{7, 2, 4, image.Pt(1, 3), image.Pt(0, 0)},
+		{8, 2, 4, image.Pt(0, 3), image.Pt(1, 0)},
+	}
+	for _, c := range cases {
+		dst := orient(src, c.orientation)
+		assert.Equal(t, image.Rect(0, 0, c.w, c.h), dst.Bounds(), "orientation %d", c.orientation)
+		assert.Equal(t, red, dst.RGBAAt(c.red.X, c.red.Y), "orientation %d", c.orientation)
+		assert.Equal(t, blue, dst.RGBAAt(c.blue.X, c.blue.Y), "orientation %d", c.orientation)
+	}
+}
+
+func TestProcessJPEG(t *testing.T) {
+	data := withExif(encodeJPEG(t, testImage(2000, 1000)), binary.BigEndian, 6)
+
+	images, err := Process(data)
+	require.NoError(t, err)
+	require.Len(t, images, len(Sizes))
+
+	sizes := map[string][2]int{}
+	for _, img := range images {
+		assert.Equal(t, "image/jpeg", img.ContentType)
+		assert.NotContains(t, string(img.Data), "Exif", "metadata is stripped")
+		assert.NotContains(t, string(img.Data), "Cam")
+		decoded, err := jpeg.Decode(bytes.NewReader(img.Data))
+		require.NoError(t, err)
+		assert.Equal(t, img.Width, decoded.Bounds().Dx())
+		sizes[img.Size] = [2]int{img.Width, img.Height}
+	}
+	// Rotated to portrait, then fitted in each box
+	assert.Equal(t, [2]int{800, 1600}, sizes[Original])
+	assert.Equal(t, [2]int{320, 640}, sizes[Large])
+	assert.Equal(t, [2]int{160, 320}, sizes[Medium])
+	assert.Equal(t, [2]int{80, 160}, sizes[Small])
+}
+
+func TestProcessPNGNeverUpscales(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(200, 300)))
+
+	images, err := Process(buf.Bytes())
+	require.NoError(t, err)
+	for _, img := range images {
+		assert.Equal(t, "image/png", img.ContentType)
+		switch img.Size {
+		case Small:
+			assert.Equal(t, [2]int{106, 160}, [2]int{img.Width, img.Height})
+		default:
+			assert.Equal(t, [2]int{200, 300}, [2]int{img.Width, img.Height}, img.Size)
+		}
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	_, err := Process([]byte("GIF89a not allowed"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+
+	_, err = Process([]byte("%PDF-1.4"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+
+	jpg := encodeJPEG(t, testImage(10, 10))
+	_, err = Process(jpg[:len(jpg)/2])
+	assert.ErrorIs(t, err, ErrInvalidImage)
+
+	// A PNG header claiming 100000 x 100000 pixels
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(1, 1)))
+	huge := buf.Bytes()
+	binary.BigEndian.PutUint32(huge[16:], 100000)
+	binary.BigEndian.PutUint32(huge[20:], 100000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+	_, err = Process(huge)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
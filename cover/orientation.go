@@ -0,0 +1,114 @@
+package cover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+const orientationTag = 0x0112
+
+// Orientation reads the EXIF orientation (1 to 8) of a JPEG. Anything
+// missing or malformed reads as 1, upright.
+func Orientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0xFF {
+			pos++ // Standalone marker or fill byte
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return 1 // Image data starts; metadata comes before it
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos = end
+	}
+	return 1
+}
+
+// exifOrientation looks the orientation up in IFD0 of a TIFF structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == orientationTag {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value < 1 || value > 8 {
+				return 1
+			}
+			return value
+		}
+	}
+	return 1
+}
+
+// orient turns src upright according to an EXIF orientation.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w // 5 to 8 swap the sides
+	}
+	// from maps a destination pixel to the source pixel shown there.
+	var from func(x, y int) (int, int)
+	switch orientation {
+	case 2: // Mirrored
+		from = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // Upside down
+		from = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // Mirrored upside down
+		from = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // Mirrored, rotated counter-clockwise
+		from = func(x, y int) (int, int) { return y, x }
+	case 6: // Rotated counter-clockwise; turn clockwise
+		from = func(x, y int) (int, int) { return y, h - 1 - x }
+	case 7: // Mirrored, rotated clockwise
+		from = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case 8: // Rotated clockwise; turn counter-clockwise
+		from = func(x, y int) (int, int) { return w - 1 - y, x }
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := from(x, y)
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
@@ -16,7 +16,8 @@ func InitDB(cfg *config.Config, logger *logger.AsyncLogger) {
 		cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
 	var err error
 	for i := 0; i < 10; i++ {
-		DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+		// TranslateError turns duplicate keys into gorm.ErrDuplicatedKey
+		DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
 		if err == nil {
 			sqlDB, _ := DB.DB()
 			sqlDB.SetMaxIdleConns(10)
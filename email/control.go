@@ -0,0 +1,122 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Bulk task states
+const (
+	TaskRunning   = "running"
+	TaskPaused    = "paused"
+	TaskCancelled = "cancelled"
+	TaskCompleted = "completed"
+	// TaskInterrupted is a task whose replica stopped before it finished
+	TaskInterrupted = "interrupted"
+)
+
+var (
+	ErrTaskNotFound   = errors.New("task not found")
+	ErrTaskNotRunning = errors.New("task is not running")
+	ErrTaskNotPaused  = errors.New("task is not paused")
+	ErrTaskFinished   = errors.New("task has already finished")
+)
+
+// PauseTask stops a task before its next message. Emails already handed to
+// SMTP finish; queued ones are held until ResumeTask.
+func (s *EmailService) PauseTask(taskID string) error {
+	task, ok := s.GetTaskStatus(taskID)
+	if !ok {
+		return s.forwardControl(taskID, "pause")
+	}
+	task.mu.Lock()
+	if task.state != TaskRunning {
+		task.mu.Unlock()
+		return ErrTaskNotRunning
+	}
+	task.state = TaskPaused
+	task.mu.Unlock()
+
+	s.logger.Log(fmt.Sprintf("Task %s paused", taskID))
+	s.persistState(task)
+	return nil
+}
+
+// ResumeTask lets a paused task continue and puts held emails back on the queue.
+func (s *EmailService) ResumeTask(taskID string) error {
+	task, ok := s.GetTaskStatus(taskID)
+	if !ok {
+		return s.forwardControl(taskID, "resume")
+	}
+	task.mu.Lock()
+	if task.state != TaskPaused {
+		task.mu.Unlock()
+		return ErrTaskNotPaused
+	}
+	task.state = TaskRunning
+	held := task.held
+	task.held = nil
+	task.cond.Broadcast()
+	task.mu.Unlock()
+
+	s.logger.Log(fmt.Sprintf("Task %s resumed with %d held emails", taskID, len(held)))
+	s.persistState(task)
+	go func() { // The queue may be full; don't keep the caller waiting
+		for _, email := range held {
+			s.enqueue(email)
+		}
+	}()
+	return nil
+}
+
+// CancelTask stops a task for good. Every email not yet sent ends up "cancelled".
+func (s *EmailService) CancelTask(taskID string) error {
+	task, ok := s.GetTaskStatus(taskID)
+	if !ok {
+		return s.forwardControl(taskID, "cancel")
+	}
+	task.mu.Lock()
+	if task.state == TaskCancelled || task.state == TaskCompleted {
+		task.mu.Unlock()
+		return ErrTaskFinished
+	}
+	task.state = TaskCancelled
+	close(task.cancelled)
+	held := task.held
+	task.held = nil
+	task.cond.Broadcast()
+	task.mu.Unlock()
+
+	s.logger.Log(fmt.Sprintf("Task %s cancelled", taskID))
+	s.persistState(task)
+	for _, email := range held {
+		s.cancelEmail(task, email.ID)
+	}
+	return nil
+}
+
+// forwardControl hands the request to whichever replica runs the task. It
+// only checks the stored state, so the change shows up once that replica acts.
+func (s *EmailService) forwardControl(taskID, action string) error {
+	if s.Store == nil {
+		return ErrTaskNotFound
+	}
+	snapshot, err := s.Store.LoadTask(taskID)
+	if err != nil {
+		return ErrTaskNotFound
+	}
+	switch {
+	case !snapshot.InProgress:
+		return ErrTaskFinished
+	case action == "pause" && snapshot.State != TaskRunning:
+		return ErrTaskNotRunning
+	case action == "resume" && snapshot.State != TaskPaused:
+		return ErrTaskNotPaused
+	}
+	return s.Store.PublishControl(taskID, action)
+}
+
+func (s *EmailService) cancelEmail(task *BulkTask, id string) {
+	s.recordStatus(task, EmailStatus{ID: id, Status: StatusCancelled, Time: time.Now()})
+}
@@ -0,0 +1,78 @@
+package email
+
+import (
+	"fmt"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"library-api/logger"
+)
+
+func newTestService(workers int, send sendFunc) *EmailService {
+	if send == nil {
+		send = func(string, smtp.Auth, string, []string, []byte) error { return nil }
+	}
+	return newEmailService("127.0.0.1", "25", "library@example.com", "", workers, logger.NewAsyncLogger(), send, 0)
+}
+
+func recipients(n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("member%d@example.com", i)
+	}
+	return list
+}
+
+func waitDone(t *testing.T, task *BulkTask) {
+	select {
+	case <-task.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("task did not finish")
+	}
+}
+
+func TestCancelTask_MarksUnsentEmailsCancelled(t *testing.T) {
+	release := make(chan struct{})
+	s := newTestService(1, func(string, smtp.Auth, string, []string, []byte) error {
+		<-release // Hold the worker on its first email
+		return nil
+	})
+	taskID := s.SendBulk(recipients(50), "Subject", "Body")
+	task, _ := s.GetTaskStatus(taskID)
+
+	assert.NoError(t, s.PauseTask(taskID))
+	assert.ErrorIs(t, s.PauseTask(taskID), ErrTaskNotRunning)
+	assert.NoError(t, s.CancelTask(taskID))
+	close(release)
+	waitDone(t, task)
+
+	cancelled := 0
+	for _, status := range task.Statuses() {
+		assert.Contains(t, []string{StatusCompleted, StatusCancelled}, status.Status)
+		if status.Status == StatusCancelled {
+			cancelled++
+		}
+	}
+	assert.GreaterOrEqual(t, cancelled, 49)
+	assert.Equal(t, 50, task.Completed())
+	assert.Equal(t, TaskCancelled, task.CurrentState())
+	assert.ErrorIs(t, s.ResumeTask(taskID), ErrTaskNotPaused)
+}
+
+func TestResumeTask_FinishesAllEmails(t *testing.T) {
+	s := newTestService(2, nil)
+	taskID := s.SendBulk(recipients(5), "Subject", "Body")
+	task, _ := s.GetTaskStatus(taskID)
+
+	if err := s.PauseTask(taskID); err == nil {
+		assert.NoError(t, s.ResumeTask(taskID))
+	}
+	waitDone(t, task)
+
+	assert.Equal(t, 5, task.Completed())
+	assert.Equal(t, TaskCompleted, task.CurrentState())
+	assert.ErrorIs(t, s.CancelTask(taskID), ErrTaskFinished)
+	assert.ErrorIs(t, s.PauseTask("missing"), ErrTaskNotFound)
+}
@@ -6,14 +6,17 @@ import (
     "net/smtp"
     "sync"
     "time"
+    "library-api/broadcast"
     "library-api/logger"
 )
 
 type Email struct {
-    To      string
-    Subject string
-    Body    string
-    ID      string
+    To       string
+    Subject  string
+    Body     string // Plain-text part
+    HTMLBody string // Optional HTML part, sent as multipart/alternative
+    ID       string
+    TaskID   string // Set for emails that belong to a bulk task
 }
 
 type EmailStatus struct {
@@ -22,126 +25,320 @@ type EmailStatus struct {
     Time   time.Time
 }
 
-type BulkTask struct {
-    ID         string
-    Emails     map[string]string
-    Total      int
-    Completed  int
-    Statuses   sync.Map
-    InProgress bool
-    Updates    chan EmailStatus // Add channel for real-time updates
-}
+type sendFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
 
 type EmailService struct {
-    queue    chan Email
-    wg       sync.WaitGroup
-    smtpHost string
-    smtpPort string
-    smtpUser string
-    smtpPass string
-    logger   *logger.AsyncLogger
-    tasks    sync.Map
+    queue     chan Email
+    wg        sync.WaitGroup
+    smtpHost  string
+    smtpPort  string
+    smtpUser  string
+    smtpPass  string
+    logger    *logger.AsyncLogger
+    tasks     sync.Map
+    Templates TemplateStore // Where template lookups go; defaults to the built-in set
+    Store     TaskStore     // Optional; shares task state with other replicas, see UseTaskStore
+    Hub       *broadcast.Hub // Fans task events out to stream subscribers
+    Retention time.Duration // How long finished tasks stay in memory
+    // OnProgress, if set, gets a summary of a task at most once a second
+    // while it runs and once when it finishes, in order, from the task's
+    // publisher goroutine.
+    OnProgress func(TaskSnapshot)
+    stop      chan struct{}
+    sending   sync.RWMutex // Held by enqueue so Shutdown never closes the queue under a send
+    send      sendFunc
+    throttle  time.Duration // Pause between two sends of one worker
 }
 
 func NewEmailService(smtpHost, smtpPort, smtpUser, smtpPass string, workers int, logger *logger.AsyncLogger) *EmailService {
+    return newEmailService(smtpHost, smtpPort, smtpUser, smtpPass, workers, logger, smtp.SendMail, 100*time.Millisecond)
+}
+
+func newEmailService(smtpHost, smtpPort, smtpUser, smtpPass string, workers int, logger *logger.AsyncLogger, send sendFunc, throttle time.Duration) *EmailService {
     service := &EmailService{
-        queue:    make(chan Email, 1000),
-        smtpHost: smtpHost,
-        smtpPort: smtpPort,
-        smtpUser: smtpUser,
-        smtpPass: smtpPass,
-        logger:   logger,
+        queue:     make(chan Email, 1000),
+        smtpHost:  smtpHost,
+        smtpPort:  smtpPort,
+        smtpUser:  smtpUser,
+        smtpPass:  smtpPass,
+        logger:    logger,
+        Templates: NewDefaultTemplateStore(),
+        Retention: 24 * time.Hour,
+        Hub:       broadcast.NewHub(512, 256),
+        stop:      make(chan struct{}),
+        send:      send,
+        throttle:  throttle,
     }
     for i := 0; i < workers; i++ {
         service.wg.Add(1)
         go service.worker()
     }
+    go service.janitor(time.Minute)
     return service
 }
 
+// staleTaskAfter is how long a running task can go without a heartbeat
+// before it is taken for interrupted. Heartbeats come from the janitor.
+const staleTaskAfter = 5 * time.Minute
+
+// UseTaskStore persists tasks to store and starts listening for pause, resume
+// and cancel requests sent by other replicas. Tasks left running by a
+// replica that stopped are marked interrupted, now and by the janitor.
+func (s *EmailService) UseTaskStore(store TaskStore) {
+    s.Store = store
+    go s.interruptStale()
+    s.Hub.WithSource(s.storeSource)
+    ctx, cancel := context.WithCancel(context.Background())
+    go func() {
+        <-s.stop
+        cancel()
+    }()
+    go func() {
+        for control := range store.SubscribeControl(ctx) {
+            if _, ok := s.GetTaskStatus(control.TaskID); !ok {
+                continue // Not ours
+            }
+            var err error
+            switch control.Action {
+            case "pause":
+                err = s.PauseTask(control.TaskID)
+            case "resume":
+                err = s.ResumeTask(control.TaskID)
+            case "cancel":
+                err = s.CancelTask(control.TaskID)
+            }
+            if err != nil {
+                s.logger.Log(fmt.Sprintf("Task %s: remote %s failed: %v", control.TaskID, control.Action, err))
+            }
+        }
+    }()
+}
+
+// janitor drops finished tasks from memory once they are older than Retention.
+// With a task store they stay readable from Redis until the keys expire, and
+// the janitor also heartbeats the tasks running here and interrupts stale
+// ones left by other replicas.
+func (s *EmailService) janitor(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-s.stop:
+            return
+        case now := <-ticker.C:
+            s.tasks.Range(func(key, value interface{}) bool {
+                task := value.(*BulkTask)
+                if task.expired(now, s.Retention) {
+                    s.tasks.Delete(key)
+                    s.Hub.Remove(key.(string))
+                } else if s.Store != nil && task.InProgress() {
+                    if err := s.Store.Heartbeat(task.ID); err != nil {
+                        s.logger.Log(fmt.Sprintf("Failed to heartbeat task %s: %v", task.ID, err))
+                    }
+                }
+                return true
+            })
+            if s.Store != nil {
+                s.interruptStale()
+            }
+        }
+    }
+}
+
+func (s *EmailService) interruptStale() {
+    ids, err := s.Store.InterruptStale(staleTaskAfter)
+    if err != nil {
+        s.logger.Log(fmt.Sprintf("Failed to check for interrupted tasks: %v", err))
+    }
+    for _, id := range ids {
+        s.logger.Log(fmt.Sprintf("Task %s was interrupted: its replica stopped before it finished", id))
+    }
+}
+
 func (s *EmailService) worker() {
     defer s.wg.Done()
     auth := smtp.PlainAuth("", s.smtpUser, s.smtpPass, s.smtpHost)
     addr := fmt.Sprintf("%s:%s", s.smtpHost, s.smtpPort)
 
     for email := range s.queue {
-        msg := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", email.To, email.Subject, email.Body))
-        err := smtp.SendMail(addr, auth, s.smtpUser, []string{email.To}, msg)
+        task, inTask := s.GetTaskStatus(email.TaskID)
+        if inTask {
+            switch task.admit(email) {
+            case TaskPaused:
+                continue
+            case TaskCancelled:
+                s.cancelEmail(task, email.ID)
+                continue
+            }
+        }
+        msg, err := buildMessage(s.smtpUser, email, time.Now())
+        if err == nil {
+            err = s.send(addr, auth, s.smtpUser, []string{email.To}, msg)
+        }
         status := EmailStatus{ID: email.ID, Time: time.Now()}
         if err != nil {
             s.logger.Log(fmt.Sprintf("Failed to send email to %s: %v", email.To, err))
-            status.Status = "failed"
+            status.Status = StatusFailed
         } else {
             s.logger.Log(fmt.Sprintf("Email sent to %s", email.To))
-            status.Status = "completed"
+            status.Status = StatusCompleted
         }
-        s.logger.Log(fmt.Sprintf("Updating status for %s to %s", email.ID, status.Status))
-        s.updateTaskStatus(email.ID, status)
-        time.Sleep(100 * time.Millisecond)
-    }
-}
-
-func (s *EmailService) updateTaskStatus(emailID string, status EmailStatus) {
-    s.tasks.Range(func(key, value interface{}) bool {
-        task := value.(*BulkTask)
-        if _, exists := task.Emails[status.ID]; exists {
-            task.Statuses.Store(emailID, status)
-            task.Updates <- status // Send real-time update
-            if status.Status == "completed" || status.Status == "failed" {
-                task.Completed++
-                s.logger.Log(fmt.Sprintf("Task %s: Completed %d/%d", task.ID, task.Completed, task.Total))
-                if task.Completed == task.Total {
-                    task.InProgress = false
-                    s.logger.Log(fmt.Sprintf("Task %s fully completed", task.ID))
-                    close(task.Updates) // Close channel when done
-                }
-            }
+        if inTask {
+            s.recordStatus(task, status)
+        }
+        if s.throttle > 0 {
+            time.Sleep(s.throttle)
         }
-        return true
+    }
+}
+
+// recordStatus moves a recipient forward and mirrors the change to the task
+// store. Statuses that would move a recipient backwards are ignored.
+func (s *EmailService) recordStatus(task *BulkTask, status EmailStatus) {
+    task.advance(status, func(events []TaskEvent, final bool) {
+        s.queueEvents(task, events, final)
     })
 }
 
 func (s *EmailService) Send(to, subject, body, id string) {
-    email := Email{To: to, Subject: subject, Body: body, ID: id}
+    s.enqueue(Email{To: to, Subject: subject, Body: body, ID: id})
+}
+
+// enqueue waits for room on the queue, so a bulk task of any size goes out
+// whole at the pace of the workers. A task's email is cancelled instead if
+// the task is cancelled meanwhile; a paused task's emails are held by the
+// workers. Emails still waiting when the service stops fail.
+func (s *EmailService) enqueue(email Email) {
+    task, inTask := s.GetTaskStatus(email.TaskID)
+    var cancelled <-chan struct{}
+    if inTask {
+        cancelled = task.cancelled
+    }
+    s.sending.RLock()
+    defer s.sending.RUnlock()
     select {
-    case s.queue <- email:
+    case <-s.stop:
     default:
-        s.logger.Log(fmt.Sprintf("Email queue full, dropping email to %s", to))
-        s.updateTaskStatus(id, EmailStatus{ID: id, Status: "failed", Time: time.Now()})
+        select {
+        case s.queue <- email:
+            return
+        case <-cancelled:
+            s.cancelEmail(task, email.ID)
+            return
+        case <-s.stop:
+        }
+    }
+    s.logger.Log(fmt.Sprintf("Email service stopped, dropping email to %s", email.To))
+    if inTask {
+        s.recordStatus(task, EmailStatus{ID: email.ID, Status: StatusFailed, Time: time.Now()})
+    }
+}
+
+// Render looks up a template by name and fills it in with data.
+func (s *EmailService) Render(name string, data map[string]interface{}) (*Rendered, error) {
+    tmpl, err := s.Templates.GetTemplate(name)
+    if err != nil {
+        return nil, err
+    }
+    return tmpl.Render(data)
+}
+
+// SendTemplate renders the named template and queues it for delivery.
+func (s *EmailService) SendTemplate(to, name string, data map[string]interface{}, id string) error {
+    rendered, err := s.Render(name, data)
+    if err != nil {
+        return err
     }
+    s.enqueue(Email{To: to, Subject: rendered.Subject, Body: rendered.Text, HTMLBody: rendered.HTML, ID: id})
+    return nil
 }
 
+// SendBulk sends a plain announcement through the "announcement" template.
 func (s *EmailService) SendBulk(recipients []string, subject, body string) string {
+    taskID, err := s.SendBulkTemplate(recipients, "announcement", subject, map[string]interface{}{"Body": body})
+    if err != nil {
+        s.logger.Log(fmt.Sprintf("Failed to render announcement: %v", err))
+    }
+    return taskID
+}
+
+// SendBulkTemplate renders the template once per recipient, with the
+// recipient's address available as {{.Email}}. A non-empty subject replaces
+// the template's own and is also available as {{.Subject}}.
+func (s *EmailService) SendBulkTemplate(recipients []string, name, subject string, data map[string]interface{}) (string, error) {
+    tmpl, err := s.Templates.GetTemplate(name)
+    if err != nil {
+        return "", err
+    }
+    if subject != "" {
+        data = withValue(data, "Subject", subject)
+        tmpl.Subject = subject
+    }
+    // Render once up front so a broken template fails the request instead of every email.
+    compiled, err := tmpl.Compile()
+    if err != nil {
+        return "", err
+    }
+    if _, err := compiled.Render(withValue(data, "Email", "")); err != nil {
+        return "", err
+    }
+
     taskID := fmt.Sprintf("task_%d", time.Now().UnixNano())
+    // Index by email ID; duplicate addresses are only sent once
     ids := make(map[string]string)
+    seen := make(map[string]bool)
+    var order []string
     for i, to := range recipients {
+        if seen[to] {
+            continue
+        }
+        seen[to] = true
         id := fmt.Sprintf("email_%d_%s", i, to)
-        ids[to] = id
+        ids[id] = to
+        order = append(order, id)
     }
 
-    task := &BulkTask{
-        ID:         taskID,
-        Emails:     ids,
-        Total:      len(recipients),
-        Completed:  0,
-        InProgress: true,
-        Updates:    make(chan EmailStatus, len(recipients)), // Buffer for updates
-    }
+    task := newBulkTask(taskID, ids)
     s.tasks.Store(taskID, task)
     s.logger.Log(fmt.Sprintf("Created task %s with %d emails", taskID, task.Total))
+    s.persistCreated(task)
+    go s.runPublisher(task)
 
     go func() {
-        for to, id := range ids {
-            s.Send(to, subject, body, id)
-            task.Statuses.Store(id, EmailStatus{ID: id, Status: "in_progress", Time: time.Now()})
-            task.Updates <- EmailStatus{ID: id, Status: "in_progress", Time: time.Now()}
+        for _, id := range order {
+            to := ids[id]
+            if !task.waitRunning() {
+                s.cancelEmail(task, id)
+                continue
+            }
+            rendered, err := compiled.Render(withValue(data, "Email", to))
+            if err != nil {
+                s.logger.Log(fmt.Sprintf("Failed to render %s for %s: %v", name, to, err))
+                s.recordStatus(task, EmailStatus{ID: id, Status: StatusFailed, Time: time.Now()})
+                continue
+            }
+            // Mark in progress before queueing so a fast worker can't be overtaken
+            s.recordStatus(task, EmailStatus{ID: id, Status: StatusInProgress, Time: time.Now()})
+            s.enqueue(Email{To: to, Subject: rendered.Subject, Body: rendered.Text, HTMLBody: rendered.HTML, ID: id, TaskID: taskID})
         }
     }()
 
-    return taskID
+    return taskID, nil
+}
+
+func withValue(data map[string]interface{}, key string, value interface{}) map[string]interface{} {
+    merged := make(map[string]interface{}, len(data)+1)
+    for k, v := range data {
+        merged[k] = v
+    }
+    merged[key] = value
+    return merged
 }
 
 func (s *EmailService) GetTaskStatus(taskID string) (*BulkTask, bool) {
+    if taskID == "" {
+        return nil, false
+    }
     task, ok := s.tasks.Load(taskID)
     if !ok {
         return nil, false
@@ -150,7 +347,10 @@ func (s *EmailService) GetTaskStatus(taskID string) (*BulkTask, bool) {
 }
 
 func (s *EmailService) Shutdown(ctx context.Context) {
+    close(s.stop)
+    s.sending.Lock()
     close(s.queue)
+    s.sending.Unlock()
     done := make(chan struct{})
     go func() {
         s.wg.Wait()
@@ -0,0 +1,201 @@
+package email
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Recipient statuses. A recipient only ever moves forward:
+// queued -> in_progress -> completed, failed or cancelled.
+const (
+	StatusQueued     = "queued"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusCancelled  = "cancelled"
+)
+
+func statusRank(status string) int {
+	switch status {
+	case StatusQueued:
+		return 0
+	case StatusInProgress:
+		return 1
+	}
+	return 2
+}
+
+func isFinal(status string) bool {
+	return statusRank(status) == 2
+}
+
+// BulkTask tracks one bulk send. ID, Total and Recipients never change after
+// creation; everything else is read through methods that take care of locking.
+type BulkTask struct {
+	ID         string
+	Total      int
+	Recipients map[string]string // Email ID -> address
+
+	completed atomic.Int64
+	done      chan struct{}
+	doneOnce  sync.Once
+	cancelled chan struct{} // Closed by CancelTask
+
+	mu         sync.Mutex
+	cond       *sync.Cond // Signalled when the state leaves "paused"
+	state      string
+	statuses   map[string]EmailStatus
+	held       []Email // Dequeued while paused, re-queued on resume
+	finishedAt time.Time
+	seq        uint64    // ID of the last event, for SSE resume
+	progressAt time.Time // Last OnProgress call
+	// Updates wait here, in seq order, for the task's publisher, which
+	// does the store I/O without holding mu
+	pending []taskUpdate
+	wake    chan struct{}
+}
+
+func newBulkTask(id string, recipients map[string]string) *BulkTask {
+	now := time.Now()
+	task := &BulkTask{
+		ID:         id,
+		Total:      len(recipients),
+		Recipients: recipients,
+		done:       make(chan struct{}),
+		cancelled:  make(chan struct{}),
+		state:      TaskRunning,
+		statuses:   make(map[string]EmailStatus, len(recipients)),
+		wake:       make(chan struct{}, 1),
+	}
+	task.cond = sync.NewCond(&task.mu)
+	for id := range recipients {
+		task.statuses[id] = EmailStatus{ID: id, Status: StatusQueued, Time: now}
+	}
+	if task.Total == 0 {
+		task.finish(now)
+	}
+	return task
+}
+
+// Completed is the number of recipients in a final status.
+func (t *BulkTask) Completed() int {
+	return int(t.completed.Load())
+}
+
+// Done is closed once every recipient has reached a final status.
+func (t *BulkTask) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *BulkTask) InProgress() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// CurrentState returns running, paused, cancelled or completed.
+func (t *BulkTask) CurrentState() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Statuses returns a copy of every recipient's current status.
+func (t *BulkTask) Statuses() []EmailStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	statuses := make([]EmailStatus, 0, len(t.statuses))
+	for _, status := range t.statuses {
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// advance applies status if it moves the recipient forward and reports whether
+// it did. onApply gets the resulting events, numbered in order, and runs under
+// the task lock so observers see them in that order. The last final status
+// finishes the task and adds a Final event.
+func (t *BulkTask) advance(status EmailStatus, onApply func(events []TaskEvent, final bool)) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.Recipients[status.ID]; !ok {
+		return false
+	}
+	if current, ok := t.statuses[status.ID]; ok && statusRank(status.Status) <= statusRank(current.Status) {
+		return false
+	}
+	t.statuses[status.ID] = status
+	t.seq++
+	events := []TaskEvent{{Seq: t.seq, Status: t.recipientStatus(status)}}
+
+	final := isFinal(status.Status)
+	if final && t.completed.Add(1) == int64(t.Total) {
+		t.finish(status.Time)
+		t.seq++
+		events = append(events, TaskEvent{Seq: t.seq, Final: t.summaryLocked()})
+	}
+	if onApply != nil {
+		onApply(events, final)
+	}
+	return true
+}
+
+// queueLocked hands an update to the task's publisher. mu must be held, so
+// updates queue in the order their events were numbered.
+func (t *BulkTask) queueLocked(update taskUpdate) {
+	t.pending = append(t.pending, update)
+	select {
+	case t.wake <- struct{}{}:
+	default: // Already woken
+	}
+}
+
+// takeUpdates empties the publisher's queue.
+func (t *BulkTask) takeUpdates() []taskUpdate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	updates := t.pending
+	t.pending = nil
+	return updates
+}
+
+// finish must be called with mu held, or before the task is shared.
+func (t *BulkTask) finish(at time.Time) {
+	if t.state == TaskRunning || t.state == TaskPaused {
+		t.state = TaskCompleted
+	}
+	t.finishedAt = at
+	t.cond.Broadcast()
+	t.doneOnce.Do(func() { close(t.done) })
+}
+
+// waitRunning blocks while the task is paused and reports whether it may go on.
+func (t *BulkTask) waitRunning() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.state == TaskPaused {
+		t.cond.Wait()
+	}
+	return t.state == TaskRunning
+}
+
+// admit is checked by workers for each dequeued email and returns the task
+// state. Paused tasks keep the email aside until they resume.
+func (t *BulkTask) admit(email Email) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state == TaskPaused {
+		t.held = append(t.held, email)
+	}
+	return t.state
+}
+
+func (t *BulkTask) expired(now time.Time, retention time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.finishedAt.IsZero() && now.Sub(t.finishedAt) > retention
+}
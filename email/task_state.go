@@ -0,0 +1,204 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"library-api/broadcast"
+)
+
+// Snapshot returns the task from memory if this replica runs it, otherwise
+// from the task store.
+func (s *EmailService) Snapshot(taskID string) (*TaskSnapshot, bool) {
+	if task, ok := s.GetTaskStatus(taskID); ok {
+		return task.snapshot(), true
+	}
+	if s.Store == nil {
+		return nil, false
+	}
+	snapshot, err := s.Store.LoadTask(taskID)
+	if err != nil {
+		if err != errTaskNotStored {
+			s.logger.Log(fmt.Sprintf("Failed to load task %s: %v", taskID, err))
+		}
+		return nil, false
+	}
+	return snapshot, true
+}
+
+// Subscribe joins the task's event stream on this replica. See broadcast.Hub.Subscribe
+// for replay and complete.
+func (s *EmailService) Subscribe(taskID string, lastEventID uint64) (*broadcast.Subscription, []broadcast.Event, bool) {
+	return s.Hub.Subscribe(taskID, lastEventID)
+}
+
+// storeSource feeds the hub from the task store, so every replica streams the
+// same events with the same IDs.
+func (s *EmailService) storeSource(ctx context.Context, taskID string, publish func(broadcast.Event), ready func()) {
+	events, err := s.Store.Subscribe(ctx, taskID)
+	ready()
+	if err != nil {
+		s.logger.Log(fmt.Sprintf("Failed to subscribe to task %s: %v", taskID, err))
+		return
+	}
+	for event := range events {
+		publish(event.hubEvent())
+	}
+}
+
+// hubEvent is what SSE clients receive: the recipient status, or the task
+// summary on the last event.
+func (e TaskEvent) hubEvent() broadcast.Event {
+	if e.Final != nil {
+		data, _ := json.Marshal(e.Final)
+		return broadcast.Event{ID: e.Seq, Type: "final", Data: data}
+	}
+	data, _ := json.Marshal(e.Status)
+	return broadcast.Event{ID: e.Seq, Type: "status", Data: data}
+}
+
+func (t *BulkTask) recipientStatus(status EmailStatus) *RecipientStatus {
+	return &RecipientStatus{Email: t.Recipients[status.ID], ID: status.ID, Status: status.Status, Time: status.Time}
+}
+
+// summaryLocked is the snapshot without per-recipient statuses. mu must be held.
+func (t *BulkTask) summaryLocked() *TaskSnapshot {
+	return &TaskSnapshot{
+		ID:         t.ID,
+		Total:      t.Total,
+		Completed:  t.Completed(),
+		InProgress: t.InProgress(),
+		State:      t.state,
+		Seq:        t.seq,
+	}
+}
+
+func (t *BulkTask) snapshot() *TaskSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snapshot := t.summaryLocked()
+	for _, status := range t.statuses {
+		snapshot.Emails = append(snapshot.Emails, *t.recipientStatus(status))
+	}
+	return snapshot
+}
+
+// The persist helpers mirror local changes to the task store and publish
+// them. Store errors are logged; the local task stays authoritative.
+
+func (s *EmailService) persistCreated(task *BulkTask) {
+	if s.Store == nil {
+		return
+	}
+	snapshot := task.snapshot()
+	if err := s.Store.CreateTask(snapshot); err != nil {
+		s.logger.Log(fmt.Sprintf("Failed to store task %s: %v", task.ID, err))
+	}
+}
+
+// taskUpdate is a change of a task, copied under the task lock and
+// published after it: the events it produced, or only a new state.
+type taskUpdate struct {
+	events       []TaskEvent
+	final        bool   // The recipient reached a final status
+	state        string // The task's state at the time
+	inProgress   bool
+	stateChanged bool          // Store state and inProgress
+	progress     *TaskSnapshot // Due for OnProgress
+}
+
+// queueEvents runs under the task lock, from recordStatus, and only copies
+// what the publisher needs.
+func (s *EmailService) queueEvents(task *BulkTask, events []TaskEvent, final bool) {
+	finished := len(events) > 1
+	task.queueLocked(taskUpdate{
+		events:       events,
+		final:        final,
+		state:        task.state,
+		inProgress:   task.InProgress(),
+		stateChanged: finished,
+		progress:     s.progressLocked(task, finished),
+	})
+}
+
+// progressLocked throttles OnProgress so a task with thousands of
+// recipients doesn't send thousands of notifications. mu must be held.
+func (s *EmailService) progressLocked(task *BulkTask, finished bool) *TaskSnapshot {
+	if s.OnProgress == nil {
+		return nil
+	}
+	now := time.Now()
+	if !finished && now.Sub(task.progressAt) < time.Second {
+		return nil
+	}
+	task.progressAt = now
+	return task.summaryLocked()
+}
+
+// runPublisher publishes the task's updates in order until the task is
+// done and every update is out. Without a store the events go straight to
+// the local hub; with one they go through Redis and come back to every
+// replica's hub, this one included.
+func (s *EmailService) runPublisher(task *BulkTask) {
+	for {
+		select {
+		case <-task.wake:
+		case <-task.Done():
+		}
+		updates := task.takeUpdates()
+		for _, update := range updates {
+			s.publishUpdate(task, update)
+		}
+		if len(updates) == 0 && !task.InProgress() {
+			return
+		}
+	}
+}
+
+func (s *EmailService) publishUpdate(task *BulkTask, update taskUpdate) {
+	if len(update.events) > 1 {
+		s.logger.Log(fmt.Sprintf("Task %s fully completed (%s)", task.ID, update.state))
+	}
+	if update.progress != nil {
+		s.OnProgress(*update.progress)
+	}
+	if s.Store == nil {
+		for _, event := range update.events {
+			s.Hub.Publish(task.ID, event.hubEvent())
+		}
+		return
+	}
+	if len(update.events) > 0 {
+		status := update.events[0].Status
+		if err := s.Store.SaveStatus(task.ID, *status, update.final); err != nil {
+			s.logger.Log(fmt.Sprintf("Failed to store status for %s: %v", status.ID, err))
+		}
+	}
+	if update.stateChanged {
+		s.saveState(task.ID, update.state, update.inProgress)
+	}
+	for _, event := range update.events {
+		if err := s.Store.Publish(task.ID, event); err != nil {
+			s.logger.Log(fmt.Sprintf("Failed to publish event %d of task %s: %v", event.Seq, task.ID, err))
+		}
+	}
+}
+
+// persistState queues the task's new state behind the updates before it,
+// so it can't be overwritten by an older one.
+func (s *EmailService) persistState(task *BulkTask) {
+	if s.Store == nil {
+		return
+	}
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	task.queueLocked(taskUpdate{state: task.state, inProgress: task.InProgress(), stateChanged: true})
+}
+
+func (s *EmailService) saveState(taskID, state string, inProgress bool) {
+	if err := s.Store.SetState(taskID, state, inProgress); err != nil {
+		s.logger.Log(fmt.Sprintf("Failed to store state for task %s: %v", taskID, err))
+	}
+}
@@ -0,0 +1,293 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"library-api/cache"
+)
+
+// TaskSnapshot is a point-in-time copy of a bulk task, as served by the
+// status endpoints and stored in Redis.
+type TaskSnapshot struct {
+	ID         string            `json:"task_id"`
+	Total      int               `json:"total"`
+	Completed  int               `json:"completed"`
+	InProgress bool              `json:"in_progress"`
+	State      string            `json:"state"`
+	Seq        uint64            `json:"seq"` // ID of the last event reflected here
+	Emails     []RecipientStatus `json:"emails,omitempty"`
+}
+
+type RecipientStatus struct {
+	Email  string    `json:"email"`
+	ID     string    `json:"id"`
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+// TaskEvent is published for every status change. Seq numbers a task's
+// events from 1. Final is only set on the last event of a task.
+type TaskEvent struct {
+	Seq    uint64           `json:"seq"`
+	Status *RecipientStatus `json:"status,omitempty"`
+	Final  *TaskSnapshot    `json:"final,omitempty"`
+}
+
+// TaskControl asks the replica running a task to pause, resume or cancel it.
+type TaskControl struct {
+	TaskID string `json:"task_id"`
+	Action string `json:"action"` // pause, resume or cancel
+}
+
+// TaskStore shares bulk task state between replicas and across restarts.
+type TaskStore interface {
+	CreateTask(snapshot *TaskSnapshot) error
+	SaveStatus(taskID string, status RecipientStatus, final bool) error
+	SetState(taskID, state string, inProgress bool) error
+	LoadTask(taskID string) (*TaskSnapshot, error)
+	Publish(taskID string, event TaskEvent) error
+	Subscribe(ctx context.Context, taskID string) (<-chan TaskEvent, error)
+	PublishControl(taskID, action string) error
+	SubscribeControl(ctx context.Context) <-chan TaskControl
+	// Heartbeat marks a task as still being run by its replica
+	Heartbeat(taskID string) error
+	// InterruptStale finishes the running tasks nobody has heartbeated for
+	// staleAfter, as interrupted, and returns their IDs
+	InterruptStale(staleAfter time.Duration) ([]string, error)
+}
+
+var errTaskNotStored = errors.New("task not in store")
+
+// RedisTaskStore keeps each task in two hashes: bulk_task:{id} for the
+// counters and state, bulk_task:{id}:emails for per-recipient statuses.
+// Keys expire after TTL while the task runs and after Retention once it is done.
+type RedisTaskStore struct {
+	Client    *redis.Client
+	TTL       time.Duration
+	Retention time.Duration
+}
+
+func NewRedisTaskStore(c *cache.Cache, ttl, retention time.Duration) *RedisTaskStore {
+	return &RedisTaskStore{Client: c.Client, TTL: ttl, Retention: retention}
+}
+
+const controlChannel = "bulk_task:control"
+
+func taskKey(id string) string        { return "bulk_task:" + id }
+func emailsKey(id string) string      { return "bulk_task:" + id + ":emails" }
+func updatesChannel(id string) string { return "bulk_task:" + id + ":updates" }
+
+func (s *RedisTaskStore) CreateTask(snapshot *TaskSnapshot) error {
+	ctx := context.Background()
+	pipe := s.Client.TxPipeline()
+	pipe.HSet(ctx, taskKey(snapshot.ID), map[string]interface{}{
+		"total":        snapshot.Total,
+		"completed":    snapshot.Completed,
+		"state":        snapshot.State,
+		"in_progress":  snapshot.InProgress,
+		"seq":          snapshot.Seq,
+		"created_at":   time.Now().Format(time.RFC3339),
+		"heartbeat_at": time.Now().Unix(),
+	})
+	if len(snapshot.Emails) > 0 {
+		fields := make(map[string]interface{}, len(snapshot.Emails))
+		for _, status := range snapshot.Emails {
+			data, _ := json.Marshal(status)
+			fields[status.ID] = data
+		}
+		pipe.HSet(ctx, emailsKey(snapshot.ID), fields)
+	}
+	pipe.Expire(ctx, taskKey(snapshot.ID), s.TTL)
+	pipe.Expire(ctx, emailsKey(snapshot.ID), s.TTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SaveStatus stores a recipient's status. final statuses also bump the
+// completed counter so every replica sees the same progress.
+func (s *RedisTaskStore) SaveStatus(taskID string, status RecipientStatus, final bool) error {
+	ctx := context.Background()
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	pipe := s.Client.TxPipeline()
+	pipe.HSet(ctx, emailsKey(taskID), status.ID, data)
+	if final {
+		pipe.HIncrBy(ctx, taskKey(taskID), "completed", 1)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisTaskStore) SetState(taskID, state string, inProgress bool) error {
+	ctx := context.Background()
+	pipe := s.Client.TxPipeline()
+	pipe.HSet(ctx, taskKey(taskID), "state", state, "in_progress", inProgress)
+	if !inProgress {
+		// Finished tasks only stay around for the retention period
+		pipe.Expire(ctx, taskKey(taskID), s.Retention)
+		pipe.Expire(ctx, emailsKey(taskID), s.Retention)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisTaskStore) LoadTask(taskID string) (*TaskSnapshot, error) {
+	ctx := context.Background()
+	// Read both hashes in one transaction so seq matches the statuses
+	pipe := s.Client.TxPipeline()
+	fieldsCmd := pipe.HGetAll(ctx, taskKey(taskID))
+	statusesCmd := pipe.HGetAll(ctx, emailsKey(taskID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	fields := fieldsCmd.Val()
+	if len(fields) == 0 {
+		return nil, errTaskNotStored
+	}
+	snapshot := &TaskSnapshot{ID: taskID, State: fields["state"]}
+	snapshot.Total, _ = strconv.Atoi(fields["total"])
+	snapshot.Completed, _ = strconv.Atoi(fields["completed"])
+	snapshot.InProgress, _ = strconv.ParseBool(fields["in_progress"])
+	snapshot.Seq, _ = strconv.ParseUint(fields["seq"], 10, 64)
+
+	for _, data := range statusesCmd.Val() {
+		var status RecipientStatus
+		if json.Unmarshal([]byte(data), &status) == nil {
+			snapshot.Emails = append(snapshot.Emails, status)
+		}
+	}
+	return snapshot, nil
+}
+
+// Publish records the event's seq on the task and sends it to subscribers.
+func (s *RedisTaskStore) Publish(taskID string, event TaskEvent) error {
+	ctx := context.Background()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	pipe := s.Client.TxPipeline()
+	pipe.HSet(ctx, taskKey(taskID), "seq", event.Seq)
+	pipe.Publish(ctx, updatesChannel(taskID), data)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Subscribe delivers the task's events until ctx is cancelled.
+func (s *RedisTaskStore) Subscribe(ctx context.Context, taskID string) (<-chan TaskEvent, error) {
+	sub := s.Client.Subscribe(ctx, updatesChannel(taskID))
+	// Wait for the subscription to be confirmed so no event published after this returns is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	events := make(chan TaskEvent, 64)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var event TaskEvent
+				if json.Unmarshal([]byte(msg.Payload), &event) != nil {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (s *RedisTaskStore) PublishControl(taskID, action string) error {
+	data, _ := json.Marshal(TaskControl{TaskID: taskID, Action: action})
+	return s.Client.Publish(context.Background(), controlChannel, data).Err()
+}
+
+func (s *RedisTaskStore) SubscribeControl(ctx context.Context) <-chan TaskControl {
+	sub := s.Client.Subscribe(ctx, controlChannel)
+	controls := make(chan TaskControl)
+	go func() {
+		defer close(controls)
+		defer sub.Close()
+		for msg := range sub.Channel() {
+			var control TaskControl
+			if json.Unmarshal([]byte(msg.Payload), &control) != nil {
+				continue
+			}
+			select {
+			case controls <- control:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		sub.Close()
+	}()
+	return controls
+}
+
+func (s *RedisTaskStore) Heartbeat(taskID string) error {
+	return s.Client.HSet(context.Background(), taskKey(taskID), "heartbeat_at", time.Now().Unix()).Err()
+}
+
+// InterruptStale looks for tasks left running by a replica that crashed or
+// was restarted. Each one is marked interrupted and gets a final event, so
+// streams watching it end.
+func (s *RedisTaskStore) InterruptStale(staleAfter time.Duration) ([]string, error) {
+	ctx := context.Background()
+	cutoff := time.Now().Add(-staleAfter).Unix()
+	var interrupted []string
+	iter := s.Client.Scan(ctx, 0, "bulk_task:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		id := strings.TrimPrefix(key, "bulk_task:")
+		if strings.Contains(id, ":") {
+			continue // The emails hash, a channel or the control channel
+		}
+		fields, err := s.Client.HMGet(ctx, key, "in_progress", "heartbeat_at").Result()
+		if err != nil {
+			return interrupted, err
+		}
+		inProgress, _ := strconv.ParseBool(fmt.Sprint(fields[0]))
+		heartbeat, _ := strconv.ParseInt(fmt.Sprint(fields[1]), 10, 64)
+		if !inProgress || heartbeat > cutoff {
+			continue
+		}
+		snapshot, err := s.LoadTask(id)
+		if err != nil {
+			return interrupted, err
+		}
+		if err := s.SetState(id, TaskInterrupted, false); err != nil {
+			return interrupted, err
+		}
+		snapshot.Emails = nil
+		snapshot.State, snapshot.InProgress, snapshot.Seq = TaskInterrupted, false, snapshot.Seq+1
+		if err := s.Publish(id, TaskEvent{Seq: snapshot.Seq, Final: snapshot}); err != nil {
+			return interrupted, err
+		}
+		interrupted = append(interrupted, id)
+	}
+	return interrupted, iter.Err()
+}
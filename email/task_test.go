@@ -0,0 +1,149 @@
+package email
+
+import (
+	"errors"
+	"net/smtp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"library-api/broadcast"
+)
+
+// Run with -race: thousands of recipients, more than the queue holds, go
+// through ten throttled workers while readers poll the task.
+func TestBulkTask_ThousandsOfRecipients(t *testing.T) {
+	var sent atomic.Int64
+	var reached sync.Map
+	s := newTestService(10, func(_ string, _ smtp.Auth, _ string, to []string, _ []byte) error {
+		reached.Store(to[0], true)
+		if sent.Add(1)%7 == 0 {
+			return errors.New("mailbox unavailable")
+		}
+		return nil
+	})
+	s.throttle = time.Millisecond
+	const n = 3000
+	taskID := s.SendBulk(recipients(n), "Subject", "Body")
+	task, _ := s.GetTaskStatus(taskID)
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(time.Millisecond):
+					snapshot := task.snapshot()
+					assert.LessOrEqual(t, snapshot.Completed, n)
+				}
+			}
+		}()
+	}
+
+	waitDone(t, task)
+	close(stop)
+	readers.Wait()
+
+	assert.Equal(t, n, task.Completed())
+	assert.Equal(t, int64(n), sent.Load(), "every recipient reaches the sender, none is dropped")
+	for _, to := range recipients(n) {
+		_, ok := reached.Load(to)
+		assert.True(t, ok, "%s was never sent", to)
+	}
+	assert.False(t, task.InProgress())
+	assert.Equal(t, TaskCompleted, task.CurrentState())
+	statuses := task.Statuses()
+	assert.Len(t, statuses, n)
+	for _, status := range statuses {
+		assert.True(t, isFinal(status.Status), "status %s of %s", status.Status, status.ID)
+		assert.NotEmpty(t, task.Recipients[status.ID])
+	}
+}
+
+func TestBulkTask_StatusesOnlyMoveForward(t *testing.T) {
+	task := newBulkTask("task", map[string]string{"email_0": "a@example.com"})
+	now := time.Now()
+
+	assert.True(t, task.advance(EmailStatus{ID: "email_0", Status: StatusCompleted, Time: now}, nil))
+	assert.False(t, task.advance(EmailStatus{ID: "email_0", Status: StatusInProgress, Time: now}, nil))
+	assert.False(t, task.advance(EmailStatus{ID: "email_0", Status: StatusFailed, Time: now}, nil))
+	assert.False(t, task.advance(EmailStatus{ID: "unknown", Status: StatusFailed, Time: now}, nil))
+
+	assert.Equal(t, StatusCompleted, task.Statuses()[0].Status)
+	assert.Equal(t, 1, task.Completed())
+	assert.False(t, task.InProgress())
+}
+
+func TestBulkTask_ConcurrentFinalStatusesCountOnce(t *testing.T) {
+	ids := make(map[string]string)
+	for _, to := range recipients(500) {
+		ids[to] = to
+	}
+	task := newBulkTask("task", ids)
+
+	var wg sync.WaitGroup
+	for _, status := range []string{StatusCompleted, StatusFailed, StatusCancelled} {
+		wg.Add(1)
+		go func(status string) {
+			defer wg.Done()
+			for id := range ids {
+				task.advance(EmailStatus{ID: id, Status: status, Time: time.Now()}, nil)
+			}
+		}(status)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 500, task.Completed())
+	assert.False(t, task.InProgress())
+}
+
+func TestSendBulk_DuplicateAndEmptyRecipients(t *testing.T) {
+	s := newTestService(2, nil)
+
+	task, _ := s.GetTaskStatus(s.SendBulk([]string{"a@example.com", "a@example.com", "b@example.com"}, "S", "B"))
+	waitDone(t, task)
+	assert.Equal(t, 2, task.Total)
+	assert.Equal(t, 2, task.Completed())
+
+	empty, _ := s.GetTaskStatus(s.SendBulk(nil, "S", "B"))
+	waitDone(t, empty)
+	assert.Equal(t, TaskCompleted, empty.CurrentState())
+}
+
+func TestSubscribe_MultipleSubscribersSeeEveryEvent(t *testing.T) {
+	s := newTestService(0, nil) // No workers: nothing moves until we say so
+	taskID := s.SendBulk(recipients(3), "Subject", "Body")
+	task, _ := s.GetTaskStatus(taskID)
+
+	a, _, _ := s.Subscribe(taskID, 0)
+	b, _, _ := s.Subscribe(taskID, 0)
+	for id := range task.Recipients {
+		s.recordStatus(task, EmailStatus{ID: id, Status: StatusCompleted, Time: time.Now()})
+	}
+	waitDone(t, task)
+
+	for _, sub := range [](<-chan broadcast.Event){a.C, b.C} {
+		var last broadcast.Event
+		for event := range sub {
+			assert.Greater(t, event.ID, last.ID)
+			last = event
+			if event.Type == "final" {
+				break
+			}
+		}
+		assert.Equal(t, "final", last.Type)
+		assert.Equal(t, task.snapshot().Seq, last.ID)
+	}
+
+	// A late subscriber resuming from the middle gets the rest replayed
+	_, replay, complete := s.Subscribe(taskID, 2)
+	assert.True(t, complete)
+	assert.Equal(t, uint64(3), replay[0].ID)
+}
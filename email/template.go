@@ -0,0 +1,229 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("email template not found")
+	// ErrInvalidTemplate wraps parse and render errors, which are the
+	// template author's to fix.
+	ErrInvalidTemplate = errors.New("invalid email template")
+)
+
+// Template is the source of a single email. Subject and Text are rendered with
+// text/template, HTML with html/template so variables are escaped.
+type Template struct {
+	Name      string   `json:"name"`
+	Subject   string   `json:"subject"`
+	HTML      string   `json:"html"`
+	Text      string   `json:"text"`
+	Variables []string `json:"variables"` // Variables the template expects, used for previews
+}
+
+// Rendered is a template filled in with data, ready to be sent.
+type Rendered struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// TemplateStore looks templates up by name.
+type TemplateStore interface {
+	GetTemplate(name string) (*Template, error)
+}
+
+// FileTemplateStore reads templates from a directory laid out as
+// <name>.subject, <name>.html and <name>.txt. Missing parts are left empty.
+type FileTemplateStore struct {
+	Dir string
+}
+
+func NewFileTemplateStore(dir string) *FileTemplateStore {
+	return &FileTemplateStore{Dir: dir}
+}
+
+func (s *FileTemplateStore) GetTemplate(name string) (*Template, error) {
+	if s.Dir == "" || strings.ContainsAny(name, `/\`) {
+		return nil, ErrTemplateNotFound
+	}
+	tmpl := &Template{Name: name}
+	found := false
+	for ext, dest := range map[string]*string{".subject": &tmpl.Subject, ".html": &tmpl.HTML, ".txt": &tmpl.Text} {
+		data, err := os.ReadFile(filepath.Join(s.Dir, name+ext))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		*dest = strings.TrimSpace(string(data))
+		found = true
+	}
+	if !found {
+		return nil, ErrTemplateNotFound
+	}
+	return tmpl, nil
+}
+
+// ChainTemplateStore tries each store in order and returns the first match,
+// so templates saved in the database override files, which override defaults.
+type ChainTemplateStore []TemplateStore
+
+func (c ChainTemplateStore) GetTemplate(name string) (*Template, error) {
+	for _, store := range c {
+		tmpl, err := store.GetTemplate(name)
+		if err == nil {
+			return tmpl, nil
+		}
+		if !errors.Is(err, ErrTemplateNotFound) {
+			return nil, err
+		}
+	}
+	return nil, ErrTemplateNotFound
+}
+
+// DefaultTemplates are compiled in so the service works without any files or rows.
+var DefaultTemplates = map[string]*Template{
+	"welcome": {
+		Name:      "welcome",
+		Subject:   "Welcome to the Library!",
+		HTML:      `<p>Hi {{.Username}},</p><p>Welcome to our library system!</p>`,
+		Text:      "Hi {{.Username}},\n\nWelcome to our library system!",
+		Variables: []string{"Username"},
+	},
+	"overdue": {
+		Name:      "overdue",
+		Subject:   "Overdue: {{.Title}}",
+		HTML:      `<p>Hi {{.Username}},</p><p><strong>{{.Title}}</strong> was due on {{.DueDate}}. Please return or renew it.</p>`,
+		Text:      "Hi {{.Username}},\n\n{{.Title}} was due on {{.DueDate}}. Please return or renew it.",
+		Variables: []string{"Username", "Title", "DueDate"},
+	},
+	"hold_ready": {
+		Name:      "hold_ready",
+		Subject:   "Your hold is ready: {{.Title}}",
+		HTML:      `<p>Hi {{.Username}},</p><p><strong>{{.Title}}</strong> is waiting for you at the desk until {{.PickupBy}}.</p>`,
+		Text:      "Hi {{.Username}},\n\n{{.Title}} is waiting for you at the desk until {{.PickupBy}}.",
+		Variables: []string{"Username", "Title", "PickupBy"},
+	},
+	"announcement": {
+		Name:      "announcement",
+		Subject:   "{{.Subject}}",
+		HTML:      `<p>{{.Body}}</p>`,
+		Text:      "{{.Body}}",
+		Variables: []string{"Subject", "Body"},
+	},
+}
+
+type defaultTemplateStore struct{}
+
+func (defaultTemplateStore) GetTemplate(name string) (*Template, error) {
+	tmpl, ok := DefaultTemplates[name]
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+	copied := *tmpl
+	return &copied, nil
+}
+
+// NewDefaultTemplateStore returns the store backed by DefaultTemplates.
+func NewDefaultTemplateStore() TemplateStore {
+	return defaultTemplateStore{}
+}
+
+// Compiled is a parsed template, for rendering many times, e.g. once per
+// bulk recipient.
+type Compiled struct {
+	name    string
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+func (t *Template) Compile() (*Compiled, error) {
+	c := &Compiled{name: t.Name}
+	var err error
+	if c.subject, err = parseText(t.Name+".subject", t.Subject); err != nil {
+		return nil, err
+	}
+	if c.text, err = parseText(t.Name+".txt", t.Text); err != nil {
+		return nil, err
+	}
+	if t.HTML != "" {
+		c.html, err = htmltemplate.New(t.Name + ".html").Option("missingkey=error").Parse(t.HTML)
+		if err != nil {
+			return nil, fmt.Errorf("%w: parse %s html: %v", ErrInvalidTemplate, t.Name, err)
+		}
+	}
+	return c, nil
+}
+
+// Render fills in all parts of the template. Missing variables are an error
+// rather than rendering "<no value>" into a member's inbox.
+func (t *Template) Render(data map[string]interface{}) (*Rendered, error) {
+	c, err := t.Compile()
+	if err != nil {
+		return nil, err
+	}
+	return c.Render(data)
+}
+
+func (c *Compiled) Render(data map[string]interface{}) (*Rendered, error) {
+	subject, err := execText(c.subject, data)
+	if err != nil {
+		return nil, err
+	}
+	text, err := execText(c.text, data)
+	if err != nil {
+		return nil, err
+	}
+	var html bytes.Buffer
+	if c.html != nil {
+		if err := c.html.Execute(&html, data); err != nil {
+			return nil, fmt.Errorf("%w: render %s html: %v", ErrInvalidTemplate, c.name, err)
+		}
+	}
+	return &Rendered{Subject: strings.TrimSpace(subject), HTML: html.String(), Text: text}, nil
+}
+
+// Preview renders the template with sample values for any declared variable
+// not present in data, so editors can see the layout before saving.
+func (t *Template) Preview(data map[string]interface{}) (*Rendered, error) {
+	sample := make(map[string]interface{}, len(t.Variables)+len(data))
+	for _, v := range t.Variables {
+		sample[v] = "{{" + v + "}}"
+	}
+	for k, v := range data {
+		sample[k] = v
+	}
+	return t.Render(sample)
+}
+
+func parseText(name, src string) (*texttemplate.Template, error) {
+	if src == "" {
+		return nil, nil
+	}
+	t, err := texttemplate.New(name).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse %s: %v", ErrInvalidTemplate, name, err)
+	}
+	return t, nil
+}
+
+func execText(t *texttemplate.Template, data map[string]interface{}) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%w: render %s: %v", ErrInvalidTemplate, t.Name(), err)
+	}
+	return buf.String(), nil
+}
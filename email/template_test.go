@@ -0,0 +1,49 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate_RenderEscapesHTML(t *testing.T) {
+	tmpl := DefaultTemplates["welcome"]
+
+	rendered, err := tmpl.Render(map[string]interface{}{"Username": "<b>bob</b>"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Welcome to the Library!", rendered.Subject)
+	assert.Contains(t, rendered.HTML, "&lt;b&gt;bob&lt;/b&gt;")
+	assert.Contains(t, rendered.Text, "<b>bob</b>")
+}
+
+func TestTemplate_RenderMissingVariable(t *testing.T) {
+	_, err := DefaultTemplates["overdue"].Render(map[string]interface{}{"Username": "bob"})
+	assert.Error(t, err)
+}
+
+func TestTemplate_PreviewFillsPlaceholders(t *testing.T) {
+	rendered, err := DefaultTemplates["hold_ready"].Preview(map[string]interface{}{"Title": "Dune"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Your hold is ready: Dune", rendered.Subject)
+	assert.Contains(t, rendered.Text, "{{Username}}")
+}
+
+func TestBuildMessage_Multipart(t *testing.T) {
+	msg, err := buildMessage("library@example.com", Email{
+		To:       "bob@example.com",
+		Subject:  "Héllo",
+		Body:     "plain",
+		HTMLBody: "<p>html</p>",
+	}, time.Now())
+	assert.NoError(t, err)
+
+	s := string(msg)
+	assert.Contains(t, s, "MIME-Version: 1.0\r\n")
+	assert.Contains(t, s, "Content-Type: multipart/alternative; boundary=")
+	assert.Contains(t, s, "Message-ID: <")
+	assert.Contains(t, s, "@example.com>")
+	assert.Contains(t, s, "Subject: =?utf-8?q?H=C3=A9llo?=")
+	assert.Less(t, strings.Index(s, "text/plain"), strings.Index(s, "text/html"))
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"library-api/logger"
+	"library-api/models"
+)
+
+// MaxAttempts is how often an event is tried before it is marked failed.
+const MaxAttempts = 10
+
+// Handler reacts to an event. Events are delivered at least once, so
+// handlers must cope with seeing one again after a crash or a retry.
+type Handler func(ctx context.Context, event Event) error
+
+// Store is the outbox table.
+type Store interface {
+	FindDue(now time.Time, limit int) ([]models.OutboxEvent, error)
+	Claim(event *models.OutboxEvent, until time.Time) (bool, error)
+	Save(event *models.OutboxEvent) error
+	DeleteProcessedBefore(t time.Time) error
+}
+
+type handler struct {
+	name   string
+	types  map[string]bool // Empty for sinks, which get every event
+	handle Handler
+}
+
+// Dispatcher reads committed events from the outbox and hands them to
+// handlers in order. A handler that fails is retried with backoff; the ones
+// that succeeded are remembered and not called again for that event.
+type Dispatcher struct {
+	Store     Store
+	Logger    *logger.AsyncLogger
+	Retention time.Duration // How long processed events are kept
+	handlers  []handler
+}
+
+func NewDispatcher(store Store, logger *logger.AsyncLogger) *Dispatcher {
+	return &Dispatcher{Store: store, Logger: logger, Retention: 7 * 24 * time.Hour}
+}
+
+// Handle registers a handler for the given event types, or for every event
+// if none are given. name must be unique and stable across releases, as it
+// is stored with the events the handler has processed.
+func (d *Dispatcher) Handle(name string, h Handler, types ...string) {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	d.handlers = append(d.handlers, handler{name: name, types: set, handle: h})
+}
+
+// Run dispatches due events every interval until ctx is cancelled. Several
+// replicas can run it; each event is claimed before it is handled.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.Dispatch(ctx)
+			if now.Sub(lastCleanup) > time.Hour {
+				lastCleanup = now
+				if err := d.Store.DeleteProcessedBefore(now.Add(-d.Retention)); err != nil {
+					d.Logger.Log(fmt.Sprintf("Failed to clean up outbox: %v", err))
+				}
+			}
+		}
+	}
+}
+
+// Dispatch handles the events that are due now.
+func (d *Dispatcher) Dispatch(ctx context.Context) {
+	due, err := d.Store.FindDue(time.Now(), 100)
+	if err != nil {
+		d.Logger.Log(fmt.Sprintf("Failed to load outbox events: %v", err))
+		return
+	}
+	for i := range due {
+		claimed, err := d.Store.Claim(&due[i], time.Now().Add(time.Minute))
+		if err != nil || !claimed {
+			continue
+		}
+		d.process(ctx, &due[i])
+	}
+}
+
+func (d *Dispatcher) process(ctx context.Context, row *models.OutboxEvent) {
+	event := Event{ID: row.ID, Type: row.Type, Data: []byte(row.Payload), OccurredAt: row.CreatedAt}
+	handled := splitNames(row.HandledBy)
+	var failures []string
+	for _, h := range d.handlers {
+		if (len(h.types) > 0 && !h.types[row.Type]) || contains(handled, h.name) {
+			continue
+		}
+		if err := h.handle(ctx, event); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", h.name, err))
+			continue
+		}
+		handled = append(handled, h.name)
+	}
+
+	now := time.Now()
+	row.Attempts++
+	row.HandledBy = strings.Join(handled, ",")
+	row.LastError = strings.Join(failures, "; ")
+	switch {
+	case len(failures) == 0:
+		row.Status = models.OutboxProcessed
+		row.ProcessedAt = &now
+	case row.Attempts >= MaxAttempts:
+		row.Status = models.OutboxFailed
+		d.Logger.Log(fmt.Sprintf("Giving up on event %d (%s): %s", row.ID, row.Type, row.LastError))
+	default:
+		row.NextAttemptAt = now.Add(Backoff(row.Attempts))
+	}
+	if err := d.Store.Save(row); err != nil {
+		d.Logger.Log(fmt.Sprintf("Failed to update outbox event %d: %v", row.ID, err))
+	}
+}
+
+// Backoff is the wait after the given number of failed attempts: 5s, 10s,
+// 20s, ... up to 10m.
+func Backoff(attempts int) time.Duration {
+	wait := 5 * time.Second
+	for i := 1; i < attempts && wait < 10*time.Minute; i++ {
+		wait *= 2
+	}
+	if wait > 10*time.Minute {
+		wait = 10 * time.Minute
+	}
+	return wait
+}
+
+func splitNames(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"library-api/logger"
+	"library-api/models"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	events []models.OutboxEvent
+}
+
+func (s *memoryStore) add(t *testing.T, eventType string, data interface{}) {
+	event, err := New(eventType, data)
+	require.NoError(t, err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.ID = uint(len(s.events) + 1)
+	s.events = append(s.events, *event)
+}
+
+func (s *memoryStore) FindDue(now time.Time, limit int) ([]models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []models.OutboxEvent
+	for _, e := range s.events {
+		if e.Status == models.OutboxPending && !e.NextAttemptAt.After(now) {
+			due = append(due, e)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) Claim(event *models.OutboxEvent, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := &s.events[event.ID-1]
+	if !stored.NextAttemptAt.Equal(event.NextAttemptAt) {
+		return false, nil
+	}
+	stored.NextAttemptAt = until
+	event.NextAttemptAt = until
+	return true, nil
+}
+
+func (s *memoryStore) Save(event *models.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[event.ID-1] = *event
+	return nil
+}
+
+func (s *memoryStore) DeleteProcessedBefore(time.Time) error { return nil }
+
+func (s *memoryStore) get(id uint) models.OutboxEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events[id-1]
+}
+
+// makeDue pretends the backoff has passed.
+func (s *memoryStore) makeDue(id uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[id-1].NextAttemptAt = time.Now()
+}
+
+func TestDispatcher_RoutesByTypeAndSinksGetEverything(t *testing.T) {
+	store := &memoryStore{}
+	d := NewDispatcher(store, logger.NewAsyncLogger())
+	var books, sink []string
+	d.Handle("books", func(ctx context.Context, e Event) error {
+		books = append(books, e.Type)
+		return nil
+	}, BookCreated, BookDeleted)
+	d.Handle("sink", func(ctx context.Context, e Event) error {
+		sink = append(sink, e.Type)
+		return nil
+	})
+
+	store.add(t, BookCreated, models.Book{Title: "Dune"})
+	store.add(t, UserRegistered, UserRegisteredData{UserID: 1})
+	store.add(t, BookDeleted, BookDeletedData{ID: 3})
+	d.Dispatch(context.Background())
+
+	assert.Equal(t, []string{BookCreated, BookDeleted}, books)
+	assert.Equal(t, []string{BookCreated, UserRegistered, BookDeleted}, sink)
+	for id := uint(1); id <= 3; id++ {
+		assert.Equal(t, models.OutboxProcessed, store.get(id).Status)
+	}
+}
+
+func TestDispatcher_RetriesOnlyTheFailedHandler(t *testing.T) {
+	store := &memoryStore{}
+	d := NewDispatcher(store, logger.NewAsyncLogger())
+	calls := map[string]int{}
+	d.Handle("ok", func(ctx context.Context, e Event) error {
+		calls["ok"]++
+		return nil
+	})
+	d.Handle("flaky", func(ctx context.Context, e Event) error {
+		calls["flaky"]++
+		if calls["flaky"] == 1 {
+			return errors.New("smtp down")
+		}
+		return nil
+	})
+
+	store.add(t, UserRegistered, UserRegisteredData{UserID: 1})
+	d.Dispatch(context.Background())
+	event := store.get(1)
+	assert.Equal(t, models.OutboxPending, event.Status)
+	assert.Equal(t, "ok", event.HandledBy)
+	assert.Contains(t, event.LastError, "smtp down")
+	assert.True(t, event.NextAttemptAt.After(time.Now()))
+
+	d.Dispatch(context.Background()) // Not due yet
+	assert.Equal(t, 1, calls["flaky"])
+
+	store.makeDue(1)
+	d.Dispatch(context.Background())
+	assert.Equal(t, map[string]int{"ok": 1, "flaky": 2}, calls)
+	assert.Equal(t, models.OutboxProcessed, store.get(1).Status)
+}
+
+func TestDispatcher_GivesUpAfterMaxAttempts(t *testing.T) {
+	store := &memoryStore{}
+	d := NewDispatcher(store, logger.NewAsyncLogger())
+	d.Handle("broken", func(ctx context.Context, e Event) error {
+		return errors.New("nope")
+	})
+
+	store.add(t, BookCreated, models.Book{})
+	for i := 0; i < MaxAttempts; i++ {
+		store.makeDue(1)
+		d.Dispatch(context.Background())
+	}
+	event := store.get(1)
+	assert.Equal(t, models.OutboxFailed, event.Status)
+	assert.Equal(t, MaxAttempts, event.Attempts)
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"library-api/models"
+)
+
+// Domain event types.
+const (
+	UserRegistered = "user.registered"
+	BookCreated    = "book.created"
+	BookUpdated    = "book.updated"
+	BookDeleted    = "book.deleted"  // Soft-deleted; it can be restored
+	BookRestored   = "book.restored" // Carries the models.Book
+	BookPurged     = "book.purged"   // Deleted for good
+	BooksImported  = "book.imported" // One per batch of an import
+	AuthorUpdated  = "author.updated"
+	AuthorsMerged  = "author.merged"
+	SubjectUpdated = "subject.updated"
+	SubjectDeleted = "subject.deleted"
+	TagUpdated     = "tag.updated"
+	TagDeleted     = "tag.deleted"
+	EditionsAdded  = "work.editions_added"
+	WorkDeleted    = "work.deleted"
+	SeriesDeleted  = "series.deleted"
+	CoverReplaced  = "book.cover_replaced" // The old cover's files can go
+	ReviewCreated  = "review.created"
+	ReviewUpdated  = "review.updated" // Edited, hidden or shown again
+	ReviewDeleted  = "review.deleted"
+	UserPurged     = "user.purged" // With their reviews, so ratings changed
+
+	CollectionUpdated = "collection.updated" // Its details or books changed
+	CollectionDeleted = "collection.deleted"
+
+	LoanCreated  = "loan.created"
+	LoanReturned = "loan.returned"
+	LoanOverdue  = "loan.overdue" // Once per loan, when it passes its due date
+)
+
+// Event is an outbox event as handlers see it.
+type Event struct {
+	ID         uint
+	Type       string
+	Data       json.RawMessage
+	OccurredAt time.Time
+}
+
+// Decode unmarshals the event's data into v.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// UserRegisteredData leaves out the password hash on purpose; event data
+// ends up in places like webhook receivers.
+type UserRegisteredData struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type BookDeletedData struct {
+	ID uint `json:"id"`
+}
+
+// BookPurgedData names the stored files of the purged book's cover, if
+// any, so they can be deleted.
+type BookPurgedData struct {
+	ID       uint   `json:"id"`
+	CoverKey string `json:"cover_key,omitempty"`
+}
+
+type UserPurgedData struct {
+	ID uint `json:"id"`
+}
+
+type BooksImportedData struct {
+	JobID uint `json:"job_id"`
+	Books int  `json:"books"` // Books written by this batch
+}
+
+// AuthorsMergedData names the authors whose credits moved to TargetID.
+type AuthorsMergedData struct {
+	TargetID  uint   `json:"target_id"`
+	SourceIDs []uint `json:"source_ids"`
+}
+
+// EditionsAddedData names the books that became editions of WorkID.
+type EditionsAddedData struct {
+	WorkID  uint   `json:"work_id"`
+	BookIDs []uint `json:"book_ids"`
+}
+
+// CoverReplacedData names the stored files of a cover that was replaced or
+// removed.
+type CoverReplacedData struct {
+	BookID uint   `json:"book_id"`
+	Key    string `json:"key"`
+}
+
+// LoanCreatedData is a book checked out to a member.
+type LoanCreatedData struct {
+	LoanID uint      `json:"loan_id"`
+	BookID uint      `json:"book_id"`
+	UserID uint      `json:"user_id"`
+	DueAt  time.Time `json:"due_at"`
+}
+
+// LoanReturnedData is a loan closed by the book coming back.
+type LoanReturnedData struct {
+	LoanID     uint      `json:"loan_id"`
+	BookID     uint      `json:"book_id"`
+	UserID     uint      `json:"user_id"`
+	ReturnedAt time.Time `json:"returned_at"`
+}
+
+type LoanOverdueData struct {
+	LoanID uint      `json:"loan_id"`
+	BookID uint      `json:"book_id"`
+	UserID uint      `json:"user_id"`
+	DueAt  time.Time `json:"due_at"`
+}
+
+// New encodes data into an outbox row, due for dispatch straight away.
+// BookCreated and BookUpdated carry the models.Book.
+func New(eventType string, data interface{}) (*models.OutboxEvent, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OutboxEvent{
+		Type:          eventType,
+		Payload:       string(payload),
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}, nil
+}
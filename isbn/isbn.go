@@ -0,0 +1,90 @@
+// Package isbn validates ISBN-10 and ISBN-13 numbers and converts between
+// them. ISBN-13 is the canonical form.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalid = errors.New("not a valid ISBN-10 or ISBN-13")
+
+// Normalize checks s, an ISBN-10 or ISBN-13 with or without hyphens and
+// spaces, and returns it as a bare ISBN-13.
+func Normalize(s string) (string, error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s)))
+	switch len(digits) {
+	case 10:
+		if !valid10(digits) {
+			return "", ErrInvalid
+		}
+		body := "978" + digits[:9]
+		return body + string(checkDigit13(body)), nil
+	case 13:
+		if !valid13(digits) {
+			return "", ErrInvalid
+		}
+		return digits, nil
+	}
+	return "", ErrInvalid
+}
+
+// To10 returns the ISBN-10 form of a valid ISBN-13. Only 978 numbers have
+// one.
+func To10(isbn13 string) (string, bool) {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+	body := isbn13[3:12]
+	return body + string(checkDigit10(body)), true
+}
+
+func valid10(s string) bool {
+	for i := 0; i < 9; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s[9] == checkDigit10(s[:9])
+}
+
+func valid13(s string) bool {
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	// Bookland prefixes; anything else is an EAN but not an ISBN
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return false
+	}
+	return s[12] == checkDigit13(s[:12])
+}
+
+// checkDigit10 weights the nine digits 10 down to 2; the check digit makes
+// the sum a multiple of 11, with X standing for 10.
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 weights the twelve digits alternately 1 and 3; the check
+// digit makes the sum a multiple of 10.
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(body[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,46 @@
+package isbn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	valid := map[string]string{
+		"0-306-40615-2":     "9780306406157",
+		"0306406152":        "9780306406157",
+		"978-0-306-40615-7": "9780306406157",
+		" 978 0306406157 ":  "9780306406157",
+		"0-8044-2957-X":     "9780804429573",
+		"080442957x":        "9780804429573",
+		"979-10-90636-07-1": "9791090636071",
+	}
+	for in, want := range valid {
+		got, err := Normalize(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{
+		"",
+		"0-306-40615-3",     // Bad ISBN-10 check digit
+		"978-0-306-40615-8", // Bad ISBN-13 check digit
+		"4006381333931",     // Valid EAN-13, not an ISBN
+		"03064061X2",        // X only allowed as the check digit
+		"97803064061",
+		"abcdefghij",
+	} {
+		_, err := Normalize(in)
+		assert.ErrorIs(t, err, ErrInvalid, in)
+	}
+}
+
+func TestTo10(t *testing.T) {
+	isbn10, ok := To10("9780804429573")
+	assert.True(t, ok)
+	assert.Equal(t, "080442957X", isbn10)
+
+	_, ok = To10("9791090636071")
+	assert.False(t, ok)
+}
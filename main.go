@@ -4,16 +4,24 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"library-api/apperror"
 	"library-api/cache"
 	"library-api/config"
 	"library-api/controllers"
 	"library-api/database"
 	"library-api/email"
+	"library-api/events"
 	"library-api/logger"
+	"library-api/metadata"
+	"library-api/middleware"
 	"library-api/models"
+	"library-api/notify"
 	"library-api/repositories"
 	"library-api/routes"
 	"library-api/services"
+	"library-api/storage"
+	"library-api/webhook"
+	"time"
 )
 
 var Logger *logger.AsyncLogger
@@ -22,22 +30,131 @@ func main() {
 	cfg := config.LoadConfig()
 	Logger = logger.NewAsyncLogger()
 	defer Logger.Close()
+	apperror.Logger = Logger
 
 	database.InitDB(cfg, Logger)
-	database.DB.AutoMigrate(&models.User{}, &models.Book{})
+	database.DB.AutoMigrate(&models.User{}, &models.Book{}, &models.EmailTemplate{}, &models.Campaign{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.OutboxEvent{}, &models.ImportJob{}, &models.ImportRowError{}, &models.Author{}, &models.Publisher{}, &models.BookAuthor{}, &models.Subject{}, &models.Tag{}, &models.BookSubject{}, &models.BookTag{}, &models.Work{}, &models.Series{}, &models.Review{}, &models.Loan{}, &models.Hold{}, &models.Collection{}, &models.CollectionItem{})
 
 	redisCache := cache.NewCache(cfg.RedisAddr)
 	emailService := email.NewEmailService(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, 10, Logger) // Pass Logger
 	defer emailService.Shutdown(context.Background())
+	emailService.Retention = cfg.TaskRetention
+	emailService.UseTaskStore(email.NewRedisTaskStore(redisCache, 7*24*time.Hour, cfg.TaskRetention))
+
+	notifier := notify.NewNotifier(Logger)
+	if err := notifier.UseRedis(context.Background(), redisCache); err != nil {
+		Logger.Log("Notifications stay on this replica, Redis subscribe failed: " + err.Error())
+	}
+	emailService.OnProgress = func(snapshot email.TaskSnapshot) {
+		notifier.NotifyStaff(notify.TopicBulkTasks, notify.EventBulkTaskProgress, snapshot)
+	}
 
 	userRepo := repositories.NewUserRepository(database.DB)
 	bookRepo := repositories.NewBookRepository(database.DB)
+	templateRepo := repositories.NewEmailTemplateRepository(database.DB)
+	campaignRepo := repositories.NewCampaignRepository(database.DB)
+	webhookRepo := repositories.NewWebhookRepository(database.DB)
+	// Templates saved through the API win over files, which win over the built-ins
+	emailService.Templates = email.ChainTemplateStore{
+		templateRepo,
+		email.NewFileTemplateStore(cfg.EmailTemplateDir),
+		email.NewDefaultTemplateStore(),
+	}
 	userService := services.NewUserService(userRepo, emailService)
+	middleware.UserExists = userRepo.Exists
 	bookService := services.NewBookService(bookRepo, redisCache)
+	bookService.Notifier = notifier
+	bookService.Authors = repositories.NewAuthorRepository(database.DB)
+	bookService.Publishers = repositories.NewPublisherRepository(database.DB)
+	bookService.Taxonomy = repositories.NewTaxonomyRepository(database.DB)
+	bookService.Works = repositories.NewWorkRepository(database.DB)
+	bookService.Series = repositories.NewSeriesRepository(database.DB)
+	switch cfg.MetadataProvider {
+	case "openlibrary":
+		openLibrary := metadata.NewOpenLibrary(10 * time.Second)
+		if cfg.OpenLibraryURL != "" {
+			openLibrary.BaseURL = cfg.OpenLibraryURL
+		}
+		bookService.Metadata = metadata.NewCached(openLibrary, redisCache)
+	case "fixtures":
+		fixtures, err := metadata.LoadFixtures(cfg.MetadataFixtures)
+		if err != nil {
+			log.Fatalf("Loading metadata fixtures: %v", err)
+		}
+		bookService.Metadata = fixtures
+	}
+	bookService.AutoEnrich = cfg.AutoEnrich
+	var coverStorage storage.Storage
+	switch cfg.CoverStorage {
+	case "s3":
+		coverStorage = storage.NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+	default:
+		coverStorage = storage.NewLocal(cfg.CoverDir)
+	}
+	coverService := services.NewCoverService(bookRepo, coverStorage)
+	collectionService := services.NewCollectionService(repositories.NewCollectionRepository(database.DB), bookRepo, redisCache)
+	recommendationService := services.NewRecommendationService(repositories.NewRecommendationRepository(database.DB), bookRepo, redisCache, Logger)
+	go recommendationService.RunRebuilder(context.Background(), cfg.RecommendationsRebuild)
+	trashService := services.NewTrashService(bookRepo, userRepo, coverService, Logger)
+	go trashService.RunPurger(context.Background(), time.Hour, cfg.TrashRetention)
+	loanRepo := repositories.NewLoanRepository(database.DB)
+	loanService := services.NewLoanService(loanRepo, userRepo, cfg.LoanPeriod, Logger)
+	loanService.Notifier = notifier
+	go loanService.RunDueChecker(context.Background(), time.Minute)
+	holdService := services.NewHoldService(repositories.NewHoldRepository(database.DB), bookService.Works, bookRepo)
+	holdService.Notifier = notifier
+	// Members hear a day ahead that a loan is coming due
+	go notify.NewReminders(loanRepo, notifier, 24*time.Hour).Run(context.Background(), time.Minute)
+	webhookService := services.NewWebhookService(webhookRepo, webhook.NewSender(10*time.Second), Logger)
+	go webhookService.RunDispatcher(context.Background(), 5*time.Second)
+
+	// Side effects of writes run from the outbox once the write has committed
+	dispatcher := events.NewDispatcher(repositories.NewOutboxRepository(database.DB), Logger)
+	bookService.RegisterHandlers(dispatcher)
+	userService.RegisterHandlers(dispatcher)
+	webhookService.RegisterHandlers(dispatcher)
+	coverService.RegisterHandlers(dispatcher)
+	collectionService.RegisterHandlers(dispatcher)
+	loanService.RegisterHandlers(dispatcher)
+	holdService.RegisterHandlers(dispatcher)
+	go dispatcher.Run(context.Background(), time.Second)
+	// Books from before authors, publishers and subjects were tracked get linked by name
+	go func() {
+		if _, err := bookService.LinkBooks(context.Background()); err != nil {
+			Logger.Log("Linking books by name failed: " + err.Error())
+		}
+	}()
+	importService := services.NewImportService(repositories.NewImportRepository(database.DB), bookRepo, Logger)
+	importService.Notifier = notifier
+	go importService.RunJanitor(context.Background(), time.Minute, 10*time.Minute)
+	templateService := services.NewEmailTemplateService(templateRepo, emailService)
+	campaignService := services.NewCampaignService(campaignRepo, userRepo, emailService, Logger)
+	go campaignService.RunScheduler(context.Background(), 30*time.Second)
 	userCtrl := controllers.NewUserController(userService)
 	bookCtrl := controllers.NewBookController(bookService)
+	templateCtrl := controllers.NewEmailTemplateController(templateService)
+	campaignCtrl := controllers.NewCampaignController(campaignService)
+	notificationCtrl := controllers.NewNotificationController(notifier)
+	webhookCtrl := controllers.NewWebhookController(webhookService)
+	importCtrl := controllers.NewImportController(importService)
+	authorCtrl := controllers.NewAuthorController(services.NewAuthorService(bookService.Authors, bookService))
+	publisherCtrl := controllers.NewPublisherController(services.NewPublisherService(bookService.Publishers, bookService))
+	taxonomyCtrl := controllers.NewTaxonomyController(services.NewTaxonomyService(bookService.Taxonomy))
+	workCtrl := controllers.NewWorkController(services.NewWorkService(bookService.Works, bookService))
+	seriesCtrl := controllers.NewSeriesController(services.NewSeriesService(bookService.Series))
+	coverCtrl := controllers.NewCoverController(coverService)
+	collectionCtrl := controllers.NewCollectionController(collectionService)
+	recommendationCtrl := controllers.NewRecommendationController(recommendationService)
+	trashCtrl := controllers.NewTrashController(trashService)
+	loanCtrl := controllers.NewLoanController(loanService)
+	holdCtrl := controllers.NewHoldController(holdService)
+	reviewCtrl := controllers.NewReviewController(services.NewReviewService(repositories.NewReviewRepository(database.DB), bookRepo, loanRepo))
+	if cfg.CoverMaxBytes > 0 {
+		coverCtrl.MaxBytes = cfg.CoverMaxBytes
+	}
 
-	router := routes.SetupRouter(userCtrl, bookCtrl)
+	idempotency := middleware.NewIdempotency(redisCache, cfg.IdempotencyTTL)
+	router := routes.SetupRouter(userCtrl, bookCtrl, templateCtrl, campaignCtrl, notificationCtrl, webhookCtrl, importCtrl, authorCtrl, publisherCtrl, taxonomyCtrl, workCtrl, seriesCtrl, coverCtrl, reviewCtrl, collectionCtrl, recommendationCtrl, trashCtrl, loanCtrl, holdCtrl, idempotency)
 	Logger.Log("Server started on :8080")
 	log.Fatal(http.ListenAndServe(":8080", router))
 }
\ No newline at end of file
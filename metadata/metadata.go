@@ -0,0 +1,86 @@
+// Package metadata looks up bibliographic details for an ISBN from an
+// external provider, so librarians don't have to type them in.
+package metadata
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound means the provider has no record for the ISBN.
+	ErrNotFound = errors.New("no metadata for this ISBN")
+	// ErrUnavailable means the provider couldn't be asked, e.g. it timed out.
+	ErrUnavailable = errors.New("metadata provider unavailable")
+)
+
+// Metadata is what a provider knows about an edition. Fields it doesn't
+// know are left empty.
+type Metadata struct {
+	ISBN13        string   `json:"isbn13"`
+	Title         string   `json:"title,omitempty"`
+	Authors       []string `json:"authors,omitempty"`
+	Publisher     string   `json:"publisher,omitempty"`
+	PublishedYear int      `json:"published_year,omitempty"`
+	PageCount     int      `json:"page_count,omitempty"`
+	Subjects      []string `json:"subjects,omitempty"`
+	Language      string   `json:"language,omitempty"` // Code, e.g. eng
+	Description   string   `json:"description,omitempty"`
+	CoverURL      string   `json:"cover_url,omitempty"`
+	Source        string   `json:"source"` // Provider name
+}
+
+// Provider looks up an ISBN-13. It returns ErrNotFound for unknown ISBNs
+// and wraps ErrUnavailable when the lookup itself failed.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, isbn13 string) (*Metadata, error)
+}
+
+// Store is the part of cache.Cache that Cached needs.
+type Store interface {
+	Get(key string, dest interface{}) error
+	Set(key string, value interface{}, ttl time.Duration) error
+}
+
+// Cached remembers a provider's answers, including "not found" for a
+// shorter time, so repeated lookups don't hit the provider.
+type Cached struct {
+	Provider    Provider
+	Store       Store
+	TTL         time.Duration
+	NotFoundTTL time.Duration
+}
+
+func NewCached(provider Provider, store Store) *Cached {
+	return &Cached{Provider: provider, Store: store, TTL: 7 * 24 * time.Hour, NotFoundTTL: 24 * time.Hour}
+}
+
+type cachedLookup struct {
+	Found    bool      `json:"found"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+func (c *Cached) Name() string { return c.Provider.Name() }
+
+func (c *Cached) Lookup(ctx context.Context, isbn13 string) (*Metadata, error) {
+	key := "metadata:" + c.Provider.Name() + ":" + isbn13
+	var hit cachedLookup
+	if err := c.Store.Get(key, &hit); err == nil {
+		if !hit.Found {
+			return nil, ErrNotFound
+		}
+		return hit.Metadata, nil
+	}
+
+	md, err := c.Provider.Lookup(ctx, isbn13)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.Store.Set(key, cachedLookup{}, c.NotFoundTTL)
+	case err == nil:
+		c.Store.Set(key, cachedLookup{Found: true, Metadata: md}, c.TTL)
+	}
+	// Failures aren't cached; the next lookup tries again
+	return md, err
+}
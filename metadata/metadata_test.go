@@ -0,0 +1,151 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const olResponse = `{"ISBN:9780441013593": {
+	"bib_key": "ISBN:9780441013593",
+	"thumbnail_url": "https://covers.openlibrary.org/b/id/12345-S.jpg",
+	"details": {
+		"title": "Dune",
+		"publishers": ["Ace Books", "Berkley"],
+		"publish_date": "August 2005",
+		"number_of_pages": 528,
+		"subjects": ["Science fiction", "Arrakis (Imaginary place)"],
+		"description": {"type": "/type/text", "value": " Set on the desert planet Arrakis. "},
+		"covers": [12345],
+		"languages": [{"key": "/languages/eng"}],
+		"authors": [{"key": "/authors/OL79034A", "name": "Frank Herbert"}]
+	}
+}}`
+
+func TestOpenLibrary(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		switch r.URL.Query().Get("bibkeys") {
+		case "ISBN:9780441013593":
+			w.Write([]byte(olResponse))
+		case "ISBN:9780000000002":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	ol := NewOpenLibrary(time.Second)
+	ol.BaseURL, ol.CoverURL = srv.URL, "https://covers.example"
+
+	md, err := ol.Lookup(context.Background(), "9780441013593")
+	require.NoError(t, err)
+	assert.Contains(t, query, "jscmd=details")
+	assert.Equal(t, &Metadata{
+		ISBN13:        "9780441013593",
+		Title:         "Dune",
+		Authors:       []string{"Frank Herbert"},
+		Publisher:     "Ace Books",
+		PublishedYear: 2005,
+		PageCount:     528,
+		Subjects:      []string{"Science fiction", "Arrakis (Imaginary place)"},
+		Language:      "eng",
+		Description:   "Set on the desert planet Arrakis.",
+		CoverURL:      "https://covers.example/b/id/12345-L.jpg",
+		Source:        "openlibrary",
+	}, md)
+
+	_, err = ol.Lookup(context.Background(), "9780306406157")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = ol.Lookup(context.Background(), "9780000000002")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestDescriptionAndYear(t *testing.T) {
+	assert.Equal(t, "Plain", description(json.RawMessage(`"Plain"`)))
+	assert.Equal(t, "", description(nil))
+	assert.Equal(t, 1990, year("1990-03-01"))
+	assert.Equal(t, 0, year("n.d."))
+}
+
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memoryStore) Get(key string, dest interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[key]
+	if !ok {
+		return errors.New("miss")
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (m *memoryStore) Set(key string, value interface{}, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key], _ = json.Marshal(value)
+	return nil
+}
+
+type countingProvider struct {
+	Provider
+	calls int
+	err   error
+}
+
+func (c *countingProvider) Lookup(ctx context.Context, isbn13 string) (*Metadata, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.Provider.Lookup(ctx, isbn13)
+}
+
+func TestCached(t *testing.T) {
+	inner := &countingProvider{Provider: NewFixtures(Metadata{ISBN13: "9780441013593", Title: "Dune"})}
+	cached := NewCached(inner, &memoryStore{data: map[string][]byte{}})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		md, err := cached.Lookup(ctx, "9780441013593")
+		require.NoError(t, err)
+		assert.Equal(t, "Dune", md.Title)
+		_, err = cached.Lookup(ctx, "9780306406157")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, 2, inner.calls, "hits and misses are both cached")
+
+	// Failures are not
+	inner.err = ErrUnavailable
+	for i := 0; i < 2; i++ {
+		_, err := cached.Lookup(ctx, "9780804429573")
+		assert.ErrorIs(t, err, ErrUnavailable)
+	}
+	assert.Equal(t, 4, inner.calls)
+}
+
+func TestLoadFixtures(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "9780441013593.json"), []byte(`{"title": "Dune", "page_count": 528}`), 0o644))
+
+	f, err := LoadFixtures(dir)
+	require.NoError(t, err)
+	md, err := f.Lookup(context.Background(), "9780441013593")
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{ISBN13: "9780441013593", Title: "Dune", PageCount: 528, Source: "fixtures"}, *md)
+}
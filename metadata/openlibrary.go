@@ -0,0 +1,127 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenLibrary reads the Open Library Books API
+// (https://openlibrary.org/dev/docs/api/books) with jscmd=details, which
+// returns the edition record including its description in one request.
+type OpenLibrary struct {
+	BaseURL   string // https://openlibrary.org, or a mirror speaking the same API
+	CoverURL  string // https://covers.openlibrary.org
+	Client    *http.Client
+	UserAgent string
+}
+
+func NewOpenLibrary(timeout time.Duration) *OpenLibrary {
+	return &OpenLibrary{
+		BaseURL:   "https://openlibrary.org",
+		CoverURL:  "https://covers.openlibrary.org",
+		Client:    &http.Client{Timeout: timeout},
+		UserAgent: "library-api/1.0",
+	}
+}
+
+func (o *OpenLibrary) Name() string { return "openlibrary" }
+
+// olDetails is the part of a jscmd=details response that's used.
+type olDetails struct {
+	ThumbnailURL string `json:"thumbnail_url"`
+	Details      struct {
+		Title       string          `json:"title"`
+		Subtitle    string          `json:"subtitle"`
+		Publishers  []string        `json:"publishers"`
+		PublishDate string          `json:"publish_date"`
+		Pages       int             `json:"number_of_pages"`
+		Subjects    []string        `json:"subjects"`
+		Description json.RawMessage `json:"description"` // A string or {"type": ..., "value": ...}
+		Covers      []int           `json:"covers"`
+		Languages   []struct {
+			Key string `json:"key"` // e.g. /languages/eng
+		} `json:"languages"`
+		Authors []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+	} `json:"details"`
+}
+
+func (o *OpenLibrary) Lookup(ctx context.Context, isbn13 string) (*Metadata, error) {
+	key := "ISBN:" + isbn13
+	query := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"details"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.BaseURL+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", o.UserAgent)
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: open library answered %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	// Unknown ISBNs get an empty object rather than a 404
+	var body map[string]olDetails
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: bad response: %v", ErrUnavailable, err)
+	}
+	record, ok := body[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	d := record.Details
+	md := &Metadata{
+		ISBN13:        isbn13,
+		Title:         strings.TrimSpace(strings.TrimSuffix(d.Title+": "+d.Subtitle, ": ")),
+		PublishedYear: year(d.PublishDate),
+		PageCount:     d.Pages,
+		Subjects:      d.Subjects,
+		Description:   description(d.Description),
+		Source:        o.Name(),
+	}
+	for _, a := range d.Authors {
+		md.Authors = append(md.Authors, a.Name)
+	}
+	if len(d.Languages) > 0 {
+		md.Language = strings.TrimPrefix(d.Languages[0].Key, "/languages/")
+	}
+	if len(d.Publishers) > 0 {
+		md.Publisher = d.Publishers[0]
+	}
+	if len(d.Covers) > 0 && d.Covers[0] > 0 {
+		md.CoverURL = fmt.Sprintf("%s/b/id/%d-L.jpg", o.CoverURL, d.Covers[0])
+	}
+	return md, nil
+}
+
+var yearPattern = regexp.MustCompile(`\b(1[0-9]{3}|20[0-9]{2})\b`)
+
+// year pulls the year out of free-form dates like "March 1990" or "1990-03-01".
+func year(date string) int {
+	y, _ := strconv.Atoi(yearPattern.FindString(date))
+	return y
+}
+
+func description(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return strings.TrimSpace(text)
+	}
+	var typed struct {
+		Value string `json:"value"`
+	}
+	json.Unmarshal(raw, &typed)
+	return strings.TrimSpace(typed.Value)
+}
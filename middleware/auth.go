@@ -1,18 +1,41 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"strings"
 	"github.com/dgrijalva/jwt-go"
+	"library-api/apperror"
 )
 
 var jwtKey = []byte(os.Getenv("JWT_SECRET"))
 
+type contextKey string
+
+const claimsKey contextKey = "claims"
+
+// UserExists, when set, tells whether a token's user still exists, so the
+// tokens of deleted and purged users stop working straight away rather than
+// when they expire.
+var UserExists func(userID uint) (bool, error)
+
+// Claims is the authenticated caller, taken from the JWT.
+type Claims struct {
+	UserID   uint
+	Username string
+	Role     string
+}
+
 func Authenticate(next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("Authorization")
+		if tokenString == "" && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			// Browsers can't set headers on WebSocket requests
+			tokenString = r.URL.Query().Get("access_token")
+		}
 		if tokenString == "" {
-			http.Error(w, "Missing token", http.StatusUnauthorized)
+			apperror.Write(w, r, apperror.Unauthorized(apperror.CodeUnauthorized, "Missing token"))
 			return
 		}
 		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
@@ -22,9 +45,63 @@ func Authenticate(next func(http.ResponseWriter, *http.Request)) func(http.Respo
 			return jwtKey, nil
 		})
 		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			apperror.Write(w, r, apperror.Unauthorized(apperror.CodeInvalidToken, "Invalid or expired token"))
+			return
+		}
+		mapClaims, _ := token.Claims.(jwt.MapClaims)
+		claims := &Claims{Role: "member"}
+		claims.Username, _ = mapClaims["username"].(string)
+		if id, ok := mapClaims["user_id"].(float64); ok {
+			claims.UserID = uint(id)
+		}
+		if role, ok := mapClaims["role"].(string); ok && role != "" {
+			claims.Role = role
+		}
+		if UserExists != nil {
+			exists, err := UserExists(claims.UserID)
+			if err != nil {
+				apperror.Write(w, r, err)
+				return
+			}
+			if !exists {
+				apperror.Write(w, r, apperror.Unauthorized(apperror.CodeInvalidToken, "The account no longer exists"))
+				return
+			}
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsKey, claims)))
+	}
+}
+
+// OptionalAuthenticate authenticates requests that carry a token and lets
+// the others through anonymously, for public routes that show signed-in
+// callers more.
+func OptionalAuthenticate(next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	authenticated := Authenticate(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
 			return
 		}
-		next(w, r)
+		authenticated(w, r)
 	}
-}
\ No newline at end of file
+}
+
+// RequireRole authenticates the request and then only lets the given roles through.
+func RequireRole(next func(http.ResponseWriter, *http.Request), roles ...string) func(http.ResponseWriter, *http.Request) {
+	return Authenticate(func(w http.ResponseWriter, r *http.Request) {
+		claims := CurrentClaims(r)
+		for _, role := range roles {
+			if claims != nil && claims.Role == role {
+				next(w, r)
+				return
+			}
+		}
+		apperror.Write(w, r, apperror.Forbidden("Your role can't access this resource"))
+	})
+}
+
+// CurrentClaims returns the caller set by Authenticate, or nil on public routes.
+func CurrentClaims(r *http.Request) *Claims {
+	claims, _ := r.Context().Value(claimsKey).(*Claims)
+	return claims
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate_RejectsTokensOfDeletedUsers(t *testing.T) {
+	jwtKey = []byte("test-secret")
+	deleted := map[uint]bool{7: true}
+	UserExists = func(userID uint) (bool, error) { return !deleted[userID], nil }
+	t.Cleanup(func() { UserExists = nil })
+
+	handler := Authenticate(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	call := func(userID uint) *httptest.ResponseRecorder {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": userID, "role": "member"}).SignedString(jwtKey)
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, "/users/me/loans", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNoContent, call(3).Code)
+	w := call(7)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_token")
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"library-api/apperror"
+	"library-api/validate"
+)
+
+// MaxIdempotencyKeyLength bounds the Idempotency-Key header.
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyStore is the part of cache.Cache that Idempotency needs. Get
+// returns redis.Nil for a missing key.
+type IdempotencyStore interface {
+	SetNX(key string, value interface{}, ttl time.Duration) (bool, error)
+	Set(key string, value interface{}, ttl time.Duration) error
+	Get(key string, dest interface{}) error
+	DeleteIfEqual(key string, value interface{}) (bool, error)
+}
+
+// Idempotency makes POST handlers safe to retry. The first request with a
+// given Idempotency-Key runs the handler and stores its response for TTL;
+// retries with the same key and body get the stored response back instead
+// of running the handler again.
+type Idempotency struct {
+	Store IdempotencyStore
+	TTL   time.Duration // How long completed responses are kept
+	// LockTTL bounds how long a request can hold a key, so a crashed
+	// instance doesn't block retries for the whole TTL.
+	LockTTL time.Duration
+	// Wait is how long a duplicate waits for the first request to finish
+	// before it gets a 409; Poll is how often it checks.
+	Wait time.Duration
+	Poll time.Duration
+}
+
+func NewIdempotency(store IdempotencyStore, ttl time.Duration) *Idempotency {
+	return &Idempotency{Store: store, TTL: ttl, LockTTL: time.Minute, Wait: 5 * time.Second, Poll: 100 * time.Millisecond}
+}
+
+// idempotencyRecord is what's stored under a key. Status is 0 while the
+// first request is still running; Token then tells which request holds
+// the key, so one whose lock expired can't release another's.
+type idempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Token       string      `json:"token,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Wrap applies idempotency to next. Requests without the header pass
+// straight through. Keys are scoped to the caller, so wrap inside
+// Authenticate or RequireRole.
+func (i *Idempotency) Wrap(next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > MaxIdempotencyKeyLength {
+			apperror.Write(w, r, apperror.BadRequest(fmt.Sprintf("Idempotency-Key must not be longer than %d characters", MaxIdempotencyKeyLength)))
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, validate.MaxBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apperror.Write(w, r, apperror.New(http.StatusRequestEntityTooLarge, apperror.CodeBodyTooLarge,
+				fmt.Sprintf("Request body must not be larger than %d bytes", validate.MaxBodyBytes)))
+			return
+		}
+		if err != nil {
+			apperror.Write(w, r, apperror.BadRequest("Request body could not be read"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var userID uint
+		if claims := CurrentClaims(r); claims != nil {
+			userID = claims.UserID
+		}
+		storeKey := fmt.Sprintf("idempotency:%d:%s", userID, key)
+		fingerprint := requestFingerprint(r, body)
+
+		lock := idempotencyRecord{Fingerprint: fingerprint, Token: newLockToken()}
+		record, err := i.acquire(r, storeKey, lock)
+		if err != nil {
+			apperror.Write(w, r, err)
+			return
+		}
+		if record != nil {
+			replay(w, record)
+			return
+		}
+
+		rec := &bufferedResponse{header: make(http.Header)}
+		defer func() {
+			// Don't keep the key locked if the handler panics
+			if p := recover(); p != nil {
+				i.release(storeKey, lock)
+				panic(p)
+			}
+		}()
+		next(rec, r)
+
+		if rec.status >= http.StatusInternalServerError {
+			// Failures that aren't the client's fault may be retried for real
+			i.release(storeKey, lock)
+		} else {
+			done := idempotencyRecord{Fingerprint: fingerprint, Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+			if err := i.Store.Set(storeKey, done, i.TTL); err != nil {
+				logIdempotencyError("store", storeKey, err)
+			}
+		}
+		rec.writeTo(w)
+	}
+}
+
+// acquire either locks storeKey for this request, returning nil, or
+// returns the completed response of an earlier request with the same key.
+func (i *Idempotency) acquire(r *http.Request, storeKey string, lock idempotencyRecord) (*idempotencyRecord, error) {
+	fingerprint := lock.Fingerprint
+	deadline := time.Now().Add(i.Wait)
+	for {
+		ok, err := i.Store.SetNX(storeKey, lock, i.LockTTL)
+		if err != nil {
+			return nil, apperror.Internal(fmt.Errorf("idempotency lock: %w", err))
+		}
+		if ok {
+			return nil, nil
+		}
+		var existing idempotencyRecord
+		err = i.Store.Get(storeKey, &existing)
+		switch {
+		case errors.Is(err, redis.Nil):
+			continue // Released or expired in between; try to take it
+		case err != nil:
+			return nil, apperror.Internal(fmt.Errorf("idempotency lookup: %w", err))
+		case existing.Fingerprint != fingerprint:
+			return nil, apperror.New(http.StatusUnprocessableEntity, "idempotency_key_reused",
+				"This Idempotency-Key was already used for a different request")
+		case existing.Status != 0:
+			return &existing, nil
+		}
+		if !time.Now().Before(deadline) {
+			return nil, apperror.Conflict("idempotency_key_in_use",
+				"A request with this Idempotency-Key is still being processed; retry later")
+		}
+		select {
+		case <-time.After(i.Poll):
+		case <-r.Context().Done():
+			return nil, apperror.Conflict("idempotency_key_in_use", "A request with this Idempotency-Key is still being processed")
+		}
+	}
+}
+
+// release frees storeKey if this request still holds it. After LockTTL
+// another request may have taken the key, and that one keeps it.
+func (i *Idempotency) release(storeKey string, lock idempotencyRecord) {
+	if _, err := i.Store.DeleteIfEqual(storeKey, lock); err != nil {
+		logIdempotencyError("release", storeKey, err)
+	}
+}
+
+func newLockToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestFingerprint identifies what was asked for, so a key can't be
+// reused for a different request.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, record *idempotencyRecord) {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+}
+
+func logIdempotencyError(action, key string, err error) {
+	if apperror.Logger != nil {
+		apperror.Logger.Log(fmt.Sprintf("idempotency: %s %s: %v", action, key, err))
+	}
+}
+
+// bufferedResponse holds a handler's response until it has been stored.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
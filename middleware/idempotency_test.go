@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"library-api/validate"
+)
+
+// memoryStore is an IdempotencyStore without Redis; it ignores TTLs.
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemoryStore() *memoryStore { return &memoryStore{data: map[string][]byte{}} }
+
+func (m *memoryStore) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[key]; ok {
+		return false, nil
+	}
+	m.data[key], _ = json.Marshal(value)
+	return true, nil
+}
+
+func (m *memoryStore) Set(key string, value interface{}, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key], _ = json.Marshal(value)
+	return nil
+}
+
+func (m *memoryStore) Get(key string, dest interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[key]
+	if !ok {
+		return redis.Nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (m *memoryStore) DeleteIfEqual(key string, value interface{}) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, _ := json.Marshal(value)
+	if string(m.data[key]) != string(data) {
+		return false, nil
+	}
+	delete(m.data, key)
+	return true, nil
+}
+
+func post(handler func(http.ResponseWriter, *http.Request), key, body string, userID uint) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), claimsKey, &Claims{UserID: userID}))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	var calls int32
+	handler := NewIdempotency(newMemoryStore(), time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"call": n, "body": string(body)})
+	})
+
+	first := post(handler, "k1", `{"title":"Dune"}`, 1)
+	second := post(handler, "k1", `{"title":"Dune"}`, 1)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	// Keys belong to one user, and requests without a key always run
+	post(handler, "k1", `{"title":"Dune"}`, 2)
+	post(handler, "", `{"title":"Dune"}`, 1)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyRejectsDifferentPayload(t *testing.T) {
+	handler := NewIdempotency(newMemoryStore(), time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	post(handler, "k1", `{"title":"Dune"}`, 1)
+	w := post(handler, "k1", `{"title":"Emma"}`, 1)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency_key_reused")
+}
+
+func TestIdempotencyReleasesKeyOnServerError(t *testing.T) {
+	var calls int32
+	handler := NewIdempotency(newMemoryStore(), time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	assert.Equal(t, http.StatusInternalServerError, post(handler, "k1", `{}`, 1).Code)
+	assert.Equal(t, http.StatusCreated, post(handler, "k1", `{}`, 1).Code)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyKeepsKeyTakenOverAfterLockExpired(t *testing.T) {
+	store := newMemoryStore()
+	handler := NewIdempotency(store, time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		// This request's lock expired and a retry took the key meanwhile
+		store.Set("idempotency:1:k1", idempotencyRecord{Fingerprint: "retry", Token: "other"}, time.Minute)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	assert.Equal(t, http.StatusInternalServerError, post(handler, "k1", `{}`, 1).Code)
+
+	var held idempotencyRecord
+	require.NoError(t, store.Get("idempotency:1:k1", &held))
+	assert.Equal(t, "other", held.Token)
+}
+
+func TestIdempotencyRejectsOversizedBody(t *testing.T) {
+	var calls int32
+	handler := NewIdempotency(newMemoryStore(), time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	})
+	w := post(handler, "k1", `"`+strings.Repeat("a", validate.MaxBodyBytes)+`"`, 1)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "body_too_large")
+	assert.Zero(t, atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyConcurrentDuplicate(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var calls int32
+	idem := NewIdempotency(newMemoryStore(), time.Hour)
+	idem.Poll = 5 * time.Millisecond
+	handler := idem.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done"))
+	})
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- post(handler, "k1", `{}`, 1) }()
+	<-started
+
+	// A duplicate that gives up before the first finishes gets a 409
+	idem.Wait = 20 * time.Millisecond
+	w := post(handler, "k1", `{}`, 1)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency_key_in_use")
+
+	// One that waits long enough gets the stored response
+	idem.Wait = 5 * time.Second
+	waiting := make(chan *httptest.ResponseRecorder)
+	go func() { waiting <- post(handler, "k1", `{}`, 1) }()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	require.Equal(t, http.StatusCreated, (<-first).Code)
+	w = <-waiting
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "done", w.Body.String())
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
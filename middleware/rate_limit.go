@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"golang.org/x/time/rate"
+	"library-api/apperror"
 )
 //limit (the maximum number of requests allowed per second)
 //burst (the maximum number of requests that can be made at once, for example, 20 requests in a burst).
@@ -12,7 +13,7 @@ func RateLimit(limit float64, burst int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if !limiter.Allow() {
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				apperror.Write(w, r, apperror.New(http.StatusTooManyRequests, apperror.CodeRateLimited, "Too many requests"))
 				return
 			}
 			next.ServeHTTP(w, r)
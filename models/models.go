@@ -1,16 +1,366 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User roles. Staff and admins can run campaigns and manage the catalog.
+const (
+	RoleMember = "member"
+	RoleStaff  = "staff"
+	RoleAdmin  = "admin"
+)
 
 type User struct {
 	gorm.Model
 	Username string `json:"username" gorm:"uniqueIndex"` // Indexed for fast lookup
 	Password string `json:"password"`
 	Email string  `json:"email"` 
+	Role          string     `json:"role" gorm:"size:20;default:member;index"`
+	EmailVerified bool       `json:"email_verified"`
+	LastLoginAt   *time.Time `json:"last_login_at"`
 }
 
 type Book struct {
 	gorm.Model
 	Title  string `json:"title" gorm:"index"`  // Indexed for searches
 	Author string `json:"author" gorm:"index"` // Indexed for searches
-}
\ No newline at end of file
+	// ISBN13 is the canonical identifier; ISBN10 is derived from it for
+	// 978 numbers. Both are nil for books without an ISBN.
+	ISBN13 *string `json:"isbn13,omitempty" gorm:"size:13;uniqueIndex"`
+	ISBN10 *string `json:"isbn10,omitempty" gorm:"size:10"`
+	// Bibliographic details, typed in or filled by metadata enrichment
+	Publisher     string     `json:"publisher,omitempty" gorm:"size:255"`
+	PublishedYear int        `json:"published_year,omitempty"`
+	PageCount     int        `json:"page_count,omitempty"`
+	Subjects      []string   `json:"subjects,omitempty" gorm:"serializer:json;type:text"`
+	Tags          []string   `json:"tags,omitempty" gorm:"serializer:json;type:text"`
+	Language      string     `json:"language,omitempty" gorm:"size:35;index"` // Language code, e.g. en or eng
+	Description   string     `json:"description,omitempty" gorm:"type:text"`
+	CoverURL      string     `json:"cover_url,omitempty" gorm:"size:2048"`
+	EnrichedAt    *time.Time `json:"enriched_at,omitempty"` // Last metadata enrichment
+	// An uploaded cover is stored under CoverKey and served by
+	// GET /books/{id}/cover; CoverURL is an external one, e.g. from enrichment
+	CoverKey       string     `json:"-" gorm:"size:255"`
+	CoverType      string     `json:"-" gorm:"size:50"`
+	CoverUpdatedAt *time.Time `json:"cover_updated_at,omitempty"`
+	// The average and number of ratings of the visible reviews, kept up to
+	// date as reviews change
+	RatingAverage float64 `json:"rating_average" gorm:"not null;default:0;index"`
+	RatingCount   int     `json:"rating_count" gorm:"not null;default:0"`
+	// Version is bumped on every update and backs the book's ETag
+	Version uint `json:"version" gorm:"not null;default:1"`
+	// Author, Publisher, Subjects and Tags above are display names kept in
+	// step with these
+	PublisherID  *uint         `json:"publisher_id,omitempty" gorm:"index"`
+	WorkID       *uint         `json:"work_id,omitempty" gorm:"index"` // The work this is an edition of
+	SeriesID     *uint         `json:"series_id,omitempty" gorm:"index"`
+	SeriesNumber *float64      `json:"series_number,omitempty"` // Volume in the series; 2.5 for a novella between 2 and 3
+	Contributors []BookAuthor  `json:"contributors,omitempty" gorm:"foreignKey:BookID"`
+	SubjectLinks []BookSubject `json:"-" gorm:"foreignKey:BookID"`
+	TagLinks     []BookTag     `json:"-" gorm:"foreignKey:BookID"`
+}
+
+// Contributor roles on a book.
+const (
+	ContributorAuthor     = "author"
+	ContributorEditor     = "editor"
+	ContributorTranslator = "translator"
+)
+
+// Author is a person credited on books. Names aren't unique: two people can
+// share one, and one person can be entered twice until the duplicates are
+// merged.
+type Author struct {
+	gorm.Model
+	Name string `json:"name" gorm:"size:255;index"`
+	// MergedIntoID points a merged-away (deleted) author at the survivor
+	MergedIntoID *uint `json:"merged_into_id,omitempty" gorm:"index"`
+}
+
+type Publisher struct {
+	gorm.Model
+	Name string `json:"name" gorm:"size:255;uniqueIndex"`
+}
+
+// Work groups the editions and translations of one work, each a Book.
+type Work struct {
+	gorm.Model
+	Title       string `json:"title" gorm:"size:255;index"`
+	Description string `json:"description,omitempty" gorm:"type:text"`
+}
+
+// Series orders books by volume number. Several editions of a volume share
+// its number.
+type Series struct {
+	gorm.Model
+	Title       string `json:"title" gorm:"size:255;index"`
+	Description string `json:"description,omitempty" gorm:"type:text"`
+}
+
+// Review is a member's 1 to 5 star rating of a book, with optional text;
+// one per member and book. Hidden reviews are kept for moderators but left
+// out of listings and of the book's rating.
+type Review struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	BookID       uint       `json:"book_id" gorm:"uniqueIndex:idx_reviews_book_user,priority:1"`
+	UserID       uint       `json:"user_id" gorm:"uniqueIndex:idx_reviews_book_user,priority:2;index"`
+	Username     string     `json:"username" gorm:"->;-:migration"` // Joined from users when read
+	Rating       int        `json:"rating"`
+	Text         string     `json:"text,omitempty" gorm:"type:text"`
+	Hidden       bool       `json:"hidden" gorm:"not null;default:false"`
+	HiddenReason string     `json:"hidden_reason,omitempty" gorm:"size:500"`
+	HiddenBy     *uint      `json:"hidden_by,omitempty"`
+	HiddenAt     *time.Time `json:"hidden_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Loan is a book lent to a member, opened by checkout and closed by its
+// return; ReturnedAt stays nil while the book is out.
+type Loan struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	BookID     uint       `json:"book_id" gorm:"index"`
+	UserID     uint       `json:"user_id" gorm:"index:idx_loans_user_returned,priority:1"`
+	BorrowedAt time.Time  `json:"borrowed_at"`
+	DueAt      time.Time  `json:"due_at"`
+	ReturnedAt *time.Time `json:"returned_at,omitempty" gorm:"index:idx_loans_user_returned,priority:2"`
+	RemindedAt *time.Time `json:"reminded_at,omitempty"` // When the member was sent loan.due_soon
+	OverdueAt  *time.Time `json:"overdue_at,omitempty"`  // When loan.overdue was recorded for it
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Hold statuses. A waiting hold is filled by the first edition of its work
+// that is free, which is then set aside for the member until they borrow it
+// or the hold is cancelled.
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"     // BookID is set aside for the member
+	HoldFulfilled = "fulfilled" // The member borrowed BookID
+	HoldCancelled = "cancelled"
+)
+
+// Hold is a member's place in the queue for a work; any edition fills it.
+type Hold struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	WorkID    uint       `json:"work_id" gorm:"index:idx_holds_work_status,priority:1"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	Status    string     `json:"status" gorm:"size:20;not null;index:idx_holds_work_status,priority:2"`
+	BookID    *uint      `json:"book_id,omitempty" gorm:"index"` // The edition that filled it
+	ReadyAt   *time.Time `json:"ready_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Collection visibilities.
+const (
+	VisibilityPrivate  = "private"  // Only the owner sees it
+	VisibilityUnlisted = "unlisted" // Anyone with the share link, but not listed
+	VisibilityPublic   = "public"   // Listed for everyone
+)
+
+// Collection is an ordered list of books kept by a user: a member's "to
+// read" list, or a curated one such as "Staff picks, October".
+type Collection struct {
+	gorm.Model
+	OwnerID     uint   `json:"owner_id" gorm:"index"`
+	Title       string `json:"title" gorm:"size:255"`
+	Description string `json:"description,omitempty" gorm:"type:text"`
+	Visibility  string `json:"visibility" gorm:"size:20;index;default:private"`
+	// ShareToken names the collection in share links, which IDs are too
+	// easy to guess for
+	ShareToken string           `json:"share_token" gorm:"size:32;uniqueIndex"`
+	BookCount  int              `json:"book_count" gorm:"->;-:migration"` // Counted on reads
+	Items      []CollectionItem `json:"items,omitempty" gorm:"foreignKey:CollectionID"`
+}
+
+// CollectionItem places a book in a collection. Positions run from 0.
+type CollectionItem struct {
+	CollectionID uint      `json:"-" gorm:"primaryKey"`
+	BookID       uint      `json:"book_id" gorm:"primaryKey;index"`
+	Position     int       `json:"position"`
+	AddedAt      time.Time `json:"added_at" gorm:"autoCreateTime"`
+	Book         *Book     `json:"book,omitempty"`
+}
+
+// Subject kinds. Subjects and genres are separate trees.
+const (
+	SubjectKindSubject = "subject"
+	SubjectKindGenre   = "genre"
+)
+
+// Subject is a heading in a subject or genre tree, e.g. Fiction > Science
+// fiction > Cyberpunk. Children have their parent's kind.
+type Subject struct {
+	gorm.Model
+	Name     string `json:"name" gorm:"size:255;index"`
+	Kind     string `json:"kind" gorm:"size:20;default:subject;index"`
+	ParentID *uint  `json:"parent_id,omitempty" gorm:"index"`
+	// Path holds the IDs from the root down, e.g. /1/5/9/, so a subtree
+	// is everything whose path starts with its root's
+	Path string `json:"-" gorm:"size:255;index"`
+}
+
+// Tag is a free-form label. Names are stored in lower case.
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:100;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BookSubject struct {
+	BookID    uint `gorm:"primaryKey"`
+	SubjectID uint `gorm:"primaryKey;index"`
+}
+
+type BookTag struct {
+	BookID uint `gorm:"primaryKey"`
+	TagID  uint `gorm:"primaryKey;index"`
+}
+
+// BookAuthor credits an author on a book in a role. The same author can
+// hold several roles on one book, e.g. author and editor.
+type BookAuthor struct {
+	BookID   uint    `json:"-" gorm:"primaryKey"`
+	AuthorID uint    `json:"author_id" gorm:"primaryKey;index"`
+	Role     string  `json:"role" gorm:"primaryKey;size:20"`
+	Position int     `json:"position"` // Order of credit on the book
+	Author   *Author `json:"author,omitempty" gorm:"foreignKey:AuthorID"`
+}
+// EmailTemplate overrides a file or built-in email template of the same name.
+type EmailTemplate struct {
+	gorm.Model
+	Name      string `json:"name" gorm:"uniqueIndex;size:100"`
+	Subject   string `json:"subject"`
+	HTML      string `json:"html" gorm:"type:text"`
+	Text      string `json:"text" gorm:"type:text"`
+	Variables string `json:"variables"` // Comma-separated variable names
+}
+
+// Campaign statuses
+const (
+	CampaignScheduled = "scheduled"
+	CampaignSending   = "sending"
+	CampaignSent      = "sent"
+	CampaignFailed    = "failed"
+	CampaignCancelled = "cancelled"
+)
+
+// CampaignAudience selects recipients. Empty fields don't filter.
+type CampaignAudience struct {
+	Role           string     `json:"role,omitempty" validate:"oneof=member|staff|admin"`
+	Verified       *bool      `json:"verified,omitempty"`
+	HasActiveLoans *bool      `json:"has_active_loans,omitempty"` // Has, or has not, a book out
+	InactiveSince  *time.Time `json:"inactive_since,omitempty"`   // No login since this time
+}
+
+// Campaign is a bulk email, kept after sending for auditing.
+type Campaign struct {
+	gorm.Model
+	Name           string           `json:"name"`
+	Subject        string           `json:"subject"`
+	Template       string           `json:"template" gorm:"size:100"`
+	Body           string           `json:"body" gorm:"type:text"` // Custom content, available as {{.Body}}
+	Audience       CampaignAudience `json:"audience" gorm:"embedded;embeddedPrefix:audience_"`
+	ScheduledAt    *time.Time       `json:"scheduled_at"`
+	Status         string           `json:"status" gorm:"size:20;index"`
+	TaskID         string           `json:"task_id"`
+	RecipientCount int              `json:"recipient_count"`
+	CreatedBy      string           `json:"created_by"`
+	SentAt         *time.Time       `json:"sent_at"`
+	Error          string           `json:"error,omitempty"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // Out of attempts
+)
+
+// Webhook is a subscription: events listed in Events are POSTed to URL,
+// signed with Secret.
+type Webhook struct {
+	gorm.Model
+	URL       string `json:"url"`
+	Events    string `json:"events"` // Comma-separated event types
+	Secret    string `json:"-"`
+	Active    bool   `json:"active" gorm:"default:true"`
+	CreatedBy string `json:"created_by"`
+}
+
+// WebhookDelivery is one event for one webhook. The pending rows are the
+// delivery queue; the rest are the webhook's delivery log.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"index"`
+	Event          string     `json:"event" gorm:"size:50"`
+	Payload        string     `json:"payload" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"size:20;index:idx_delivery_due,priority:1"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_delivery_due,priority:2"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty" gorm:"type:text"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	RedeliveryOf   *uint      `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Outbox event statuses
+const (
+	OutboxPending   = "pending"
+	OutboxProcessed = "processed"
+	OutboxFailed    = "failed" // Out of attempts
+)
+
+// OutboxEvent is a domain event, written in the same transaction as the
+// change it describes and handed to handlers by the dispatcher afterwards.
+type OutboxEvent struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Type          string     `json:"type" gorm:"size:50"`
+	Payload       string     `json:"payload" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"size:20;default:pending;index:idx_outbox_due,priority:1"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_outbox_due,priority:2"`
+	Attempts      int        `json:"attempts"`
+	HandledBy     string     `json:"handled_by" gorm:"type:text"` // Comma-separated handlers that succeeded
+	LastError     string     `json:"last_error,omitempty" gorm:"type:text"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Import job states.
+const (
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportJob tracks a catalog import running in the background. The counts
+// are updated after every batch, so they show progress while it runs.
+type ImportJob struct {
+	gorm.Model
+	Format     string     `json:"format" gorm:"size:10"`
+	DryRun     bool       `json:"dry_run"`
+	Status     string     `json:"status" gorm:"size:20;index"`
+	Rows       int        `json:"rows"` // Rows read so far, valid or not
+	Created    int        `json:"created"`
+	Updated    int        `json:"updated"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty" gorm:"type:text"` // Why the whole job stopped
+	CreatedBy  uint       `json:"created_by"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportRowError is one problem with one row of an import; a row with
+// several invalid fields has several.
+type ImportRowError struct {
+	ID      uint   `json:"-" gorm:"primaryKey"`
+	JobID   uint   `json:"-" gorm:"index:idx_import_row_errors_job,priority:1"`
+	Line    int    `json:"line" gorm:"index:idx_import_row_errors_job,priority:2"`
+	Field   string `json:"field,omitempty" gorm:"size:50"`
+	Code    string `json:"code" gorm:"size:50"`
+	Message string `json:"message"`
+}
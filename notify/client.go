@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"library-api/broadcast"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = 30 * time.Second
+	maxMessageSize = 4096
+	sendBufferSize = 64
+)
+
+// clientMessage is what clients send:
+// {"action": "subscribe", "topics": ["catalog", "bulk_tasks"]}
+type clientMessage struct {
+	Action string   `json:"action"`
+	Topics []string `json:"topics"`
+}
+
+// reply acknowledges a clientMessage.
+type reply struct {
+	Type   string   `json:"type"` // subscribed, unsubscribed or error
+	Topics []string `json:"topics,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+type client struct {
+	notifier *Notifier
+	conn     *websocket.Conn
+	userID   uint
+	role     string
+	send     chan []byte
+
+	mu     sync.Mutex
+	subs   map[string]*broadcast.Subscription // By topic
+	closed bool
+	done   chan struct{}
+}
+
+// Serve runs a client connection until it closes. Clients that can't keep
+// up are disconnected with close code 1013 (try again later) instead of
+// holding up everyone else.
+func (n *Notifier) Serve(conn *websocket.Conn, userID uint, role string) {
+	c := &client{
+		notifier: n,
+		conn:     conn,
+		userID:   userID,
+		role:     role,
+		send:     make(chan []byte, sendBufferSize),
+		subs:     make(map[string]*broadcast.Subscription),
+		done:     make(chan struct{}),
+	}
+	go c.writePump()
+	c.readPump()
+}
+
+func (c *client) readPump() {
+	defer c.close(websocket.CloseNormalClosure, "")
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.reply(reply{Type: "error", Error: "invalid message"})
+			continue
+		}
+		switch msg.Action {
+		case "subscribe":
+			c.subscribe(msg.Topics)
+		case "unsubscribe":
+			c.unsubscribe(msg.Topics)
+		default:
+			c.reply(reply{Type: "error", Error: "unknown action"})
+		}
+	}
+}
+
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+func (c *client) subscribe(topics []string) {
+	var added []string
+	for _, topic := range topics {
+		channel, ok := channelFor(topic, c.userID, c.role)
+		if !ok {
+			c.reply(reply{Type: "error", Topics: []string{topic}, Error: "not allowed to subscribe to this topic"})
+			continue
+		}
+		c.mu.Lock()
+		if _, ok := c.subs[topic]; ok || c.closed {
+			c.mu.Unlock()
+			continue
+		}
+		sub, _, _ := c.notifier.hub.Subscribe(channel, 0)
+		c.subs[topic] = sub
+		c.mu.Unlock()
+		go c.forward(topic, sub)
+		added = append(added, topic)
+	}
+	if len(added) > 0 {
+		c.reply(reply{Type: "subscribed", Topics: added})
+	}
+}
+
+func (c *client) unsubscribe(topics []string) {
+	var removed []string
+	c.mu.Lock()
+	for _, topic := range topics {
+		if sub, ok := c.subs[topic]; ok {
+			delete(c.subs, topic)
+			sub.Close()
+			removed = append(removed, topic)
+		}
+	}
+	c.mu.Unlock()
+	c.reply(reply{Type: "unsubscribed", Topics: removed})
+}
+
+// forward copies a topic's notifications to the client. The hub closes the
+// subscription when its buffer overflows, which also means the client is too slow.
+func (c *client) forward(topic string, sub *broadcast.Subscription) {
+	for event := range sub.C {
+		c.enqueue(event.Data)
+	}
+	c.mu.Lock()
+	dropped := c.subs[topic] == sub
+	c.mu.Unlock()
+	if dropped {
+		c.close(websocket.CloseTryAgainLater, "too slow")
+	}
+}
+
+func (c *client) reply(r reply) {
+	data, _ := json.Marshal(r)
+	c.enqueue(data)
+}
+
+func (c *client) enqueue(msg []byte) {
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	default:
+		c.close(websocket.CloseTryAgainLater, "too slow")
+	}
+}
+
+// close tells the client why, leaves every topic and closes the connection.
+// The read and write pumps notice and return.
+func (c *client) close(code int, reason string) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	subs := c.subs
+	c.subs = make(map[string]*broadcast.Subscription)
+	close(c.done)
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+	c.conn.Close()
+}
@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"library-api/broadcast"
+	"library-api/cache"
+	"library-api/logger"
+	"library-api/models"
+)
+
+// Topics a client can subscribe to over the WebSocket.
+const (
+	TopicAccount   = "account"    // The member's own holds, loans and fines
+	TopicCatalog   = "catalog"    // Books created, updated or deleted (staff)
+	TopicBulkTasks = "bulk_tasks" // Bulk email and import progress (staff)
+)
+
+// Notification types.
+const (
+	EventHoldReady        = "hold.ready"
+	EventDueSoon          = "loan.due_soon"
+	EventOverdue          = "loan.overdue"
+	EventFine             = "fine.assessed"
+	EventBookCreated      = "book.created"
+	EventBookUpdated      = "book.updated"
+	EventBookDeleted      = "book.deleted"
+	EventBulkTaskProgress = "bulk_task.progress"
+	EventImportProgress   = "import_job.progress"
+)
+
+// Notification is what clients receive.
+type Notification struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+	Time  time.Time       `json:"time"`
+}
+
+// HoldData is the data of hold.ready: the edition set aside for the hold.
+type HoldData struct {
+	HoldID uint `json:"hold_id"`
+	WorkID uint `json:"work_id"`
+	BookID uint `json:"book_id"`
+}
+
+// envelope carries a notification between replicas. Channel is the hub
+// topic: the public topic, or user:{id} for account notifications.
+type envelope struct {
+	Channel      string       `json:"channel"`
+	Notification Notification `json:"notification"`
+}
+
+const redisChannel = "notifications"
+
+// Notifier delivers notifications to connected WebSocket clients. With
+// UseRedis every replica's clients get them, whichever replica sent them.
+// A nil Notifier drops everything, so services can treat it as optional.
+type Notifier struct {
+	hub    *broadcast.Hub
+	client *redis.Client
+	logger *logger.AsyncLogger
+
+	mu  sync.Mutex
+	seq uint64
+}
+
+func NewNotifier(logger *logger.AsyncLogger) *Notifier {
+	// No history: a notification nobody is connected for is simply missed
+	return &Notifier{hub: broadcast.NewHub(0, 64), logger: logger}
+}
+
+// UseRedis relays notifications through Redis pub/sub until ctx is cancelled.
+func (n *Notifier) UseRedis(ctx context.Context, c *cache.Cache) error {
+	sub := c.Client.Subscribe(ctx, redisChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return err
+	}
+	n.client = c.Client
+	go func() {
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var env envelope
+				if json.Unmarshal([]byte(msg.Payload), &env) == nil {
+					n.deliver(env)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// NotifyUser sends an account notification to one member.
+func (n *Notifier) NotifyUser(userID uint, eventType string, data interface{}) {
+	n.publish(userChannel(userID), TopicAccount, eventType, data)
+}
+
+// NotifyStaff sends a notification on a staff topic.
+func (n *Notifier) NotifyStaff(topic, eventType string, data interface{}) {
+	n.publish(topic, topic, eventType, data)
+}
+
+func (n *Notifier) publish(channel, topic, eventType string, data interface{}) {
+	if n == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		n.log(fmt.Sprintf("Failed to encode %s notification: %v", eventType, err))
+		return
+	}
+	env := envelope{Channel: channel, Notification: Notification{Topic: topic, Type: eventType, Data: payload, Time: time.Now()}}
+	if n.client == nil {
+		n.deliver(env)
+		return
+	}
+	msg, _ := json.Marshal(env)
+	if err := n.client.Publish(context.Background(), redisChannel, msg).Err(); err != nil {
+		n.log(fmt.Sprintf("Failed to publish %s notification: %v", eventType, err))
+	}
+}
+
+func (n *Notifier) deliver(env envelope) {
+	data, err := json.Marshal(env.Notification)
+	if err != nil {
+		return
+	}
+	// The hub wants increasing IDs per topic; one counter under a lock keeps them in order
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.seq++
+	n.hub.Publish(env.Channel, broadcast.Event{ID: n.seq, Type: env.Notification.Type, Data: data})
+}
+
+func (n *Notifier) log(msg string) {
+	if n.logger != nil {
+		n.logger.Log(msg)
+	}
+}
+
+// channelFor maps a topic a client asked for to its hub topic, if the
+// client may see it.
+func channelFor(topic string, userID uint, role string) (string, bool) {
+	switch topic {
+	case TopicAccount:
+		return userChannel(userID), userID != 0
+	case TopicCatalog, TopicBulkTasks:
+		return topic, role == models.RoleStaff || role == models.RoleAdmin
+	}
+	return "", false
+}
+
+func userChannel(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T, n *Notifier, userID uint, role string) *websocket.Conn {
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		n.Serve(conn, userID, role)
+	}))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func read(t *testing.T, conn *websocket.Conn, v interface{}) {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, v))
+}
+
+func TestNotifier_StaffGetCatalogEvents(t *testing.T) {
+	n := NewNotifier(nil)
+	conn := dial(t, n, 1, "staff")
+
+	require.NoError(t, conn.WriteJSON(clientMessage{Action: "subscribe", Topics: []string{TopicCatalog}}))
+	var ack reply
+	read(t, conn, &ack)
+	assert.Equal(t, reply{Type: "subscribed", Topics: []string{TopicCatalog}}, ack)
+
+	n.NotifyStaff(TopicCatalog, EventBookCreated, map[string]string{"title": "Dune"})
+	n.NotifyStaff(TopicBulkTasks, EventBulkTaskProgress, map[string]int{"completed": 1}) // Not subscribed
+	n.NotifyStaff(TopicCatalog, EventBookDeleted, map[string]uint{"id": 7})
+
+	var got Notification
+	read(t, conn, &got)
+	assert.Equal(t, EventBookCreated, got.Type)
+	assert.JSONEq(t, `{"title":"Dune"}`, string(got.Data))
+	read(t, conn, &got)
+	assert.Equal(t, EventBookDeleted, got.Type)
+}
+
+func TestNotifier_MembersOnlySeeTheirOwnAccount(t *testing.T) {
+	n := NewNotifier(nil)
+	conn := dial(t, n, 42, "member")
+
+	require.NoError(t, conn.WriteJSON(clientMessage{Action: "subscribe", Topics: []string{TopicCatalog, TopicAccount}}))
+	var r reply
+	read(t, conn, &r)
+	assert.Equal(t, "error", r.Type)
+	assert.Equal(t, []string{TopicCatalog}, r.Topics)
+	var ack reply
+	read(t, conn, &ack)
+	assert.Equal(t, reply{Type: "subscribed", Topics: []string{TopicAccount}}, ack)
+
+	n.NotifyUser(7, EventFine, map[string]int{"amount": 100})
+	n.NotifyUser(42, EventHoldReady, map[string]string{"title": "Dune"})
+
+	var got Notification
+	read(t, conn, &got)
+	assert.Equal(t, TopicAccount, got.Topic)
+	assert.Equal(t, EventHoldReady, got.Type)
+}
+
+func TestNotifier_DropsSlowClients(t *testing.T) {
+	n := NewNotifier(nil)
+	conn := dial(t, n, 1, "admin")
+	require.NoError(t, conn.WriteJSON(clientMessage{Action: "subscribe", Topics: []string{TopicCatalog}}))
+	var ack reply
+	read(t, conn, &ack)
+
+	// Never read: the socket buffers fill up, then ours and the hub's
+	payload := strings.Repeat("x", 64*1024)
+	for i := 0; i < 1000 && n.hub.Subscribers(TopicCatalog) > 0; i++ {
+		n.NotifyStaff(TopicCatalog, EventBookUpdated, payload)
+		time.Sleep(time.Millisecond)
+	}
+	assert.Zero(t, n.hub.Subscribers(TopicCatalog))
+}
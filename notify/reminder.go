@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"library-api/models"
+)
+
+// DueLoans finds open loans coming due and records that their member was
+// reminded. repositories.LoanRepository is one.
+type DueLoans interface {
+	FindDueSoon(now, until time.Time, limit int) ([]models.Loan, error)
+	MarkReminded(loan *models.Loan, at time.Time) (bool, error)
+}
+
+// LoanData is the data of loan.due_soon and loan.overdue notifications.
+type LoanData struct {
+	LoanID uint      `json:"loan_id"`
+	BookID uint      `json:"book_id"`
+	DueAt  time.Time `json:"due_at"`
+}
+
+// Reminders sends each member loan.due_soon once for every loan of theirs
+// that falls due within Within. A loan is marked reminded before the
+// notification goes out, so replicas never remind twice; a member who isn't
+// connected misses it, like any other notification.
+type Reminders struct {
+	Loans    DueLoans
+	Notifier *Notifier
+	Within   time.Duration
+}
+
+func NewReminders(loans DueLoans, notifier *Notifier, within time.Duration) *Reminders {
+	return &Reminders{Loans: loans, Notifier: notifier, Within: within}
+}
+
+// Run sends reminders every interval until ctx is cancelled.
+func (r *Reminders) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Send(time.Now()); err != nil {
+				r.Notifier.log(fmt.Sprintf("Sending due date reminders failed: %v", err))
+			}
+		}
+	}
+}
+
+// Send reminds the members of every loan due between now and now+Within
+// that they haven't been reminded of.
+func (r *Reminders) Send(now time.Time) error {
+	const batch = 100
+	for {
+		loans, err := r.Loans.FindDueSoon(now, now.Add(r.Within), batch)
+		if err != nil || len(loans) == 0 {
+			return err
+		}
+		for i := range loans {
+			loan := &loans[i]
+			marked, err := r.Loans.MarkReminded(loan, now)
+			if err != nil {
+				return err
+			}
+			if marked {
+				r.Notifier.NotifyUser(loan.UserID, EventDueSoon, LoanData{LoanID: loan.ID, BookID: loan.BookID, DueAt: loan.DueAt})
+			}
+		}
+		if len(loans) < batch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"library-api/models"
+)
+
+type memoryLoans struct {
+	mu    sync.Mutex
+	loans []models.Loan
+}
+
+func (m *memoryLoans) FindDueSoon(now, until time.Time, limit int) ([]models.Loan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []models.Loan
+	for _, loan := range m.loans {
+		if loan.ReturnedAt == nil && loan.RemindedAt == nil && !loan.DueAt.Before(now) && loan.DueAt.Before(until) && len(due) < limit {
+			due = append(due, loan)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryLoans) MarkReminded(loan *models.Loan, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.loans {
+		if m.loans[i].ID == loan.ID && m.loans[i].RemindedAt == nil {
+			m.loans[i].RemindedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestReminders_MemberIsRemindedOnceOverTheSocket(t *testing.T) {
+	n := NewNotifier(nil)
+	conn := dial(t, n, 42, "member")
+	require.NoError(t, conn.WriteJSON(clientMessage{Action: "subscribe", Topics: []string{TopicAccount}}))
+	var ack reply
+	read(t, conn, &ack)
+	require.Equal(t, "subscribed", ack.Type)
+
+	now := time.Now()
+	returned := now.Add(-time.Hour)
+	loans := &memoryLoans{loans: []models.Loan{
+		{ID: 1, BookID: 10, UserID: 42, DueAt: now.Add(-time.Hour)},                       // Already overdue
+		{ID: 2, BookID: 11, UserID: 42, DueAt: now.Add(5 * 24 * time.Hour)},               // Not due for days
+		{ID: 3, BookID: 12, UserID: 42, DueAt: now.Add(time.Hour), ReturnedAt: &returned}, // Back already
+		{ID: 4, BookID: 13, UserID: 7, DueAt: now.Add(time.Hour)},                         // Someone else's
+		{ID: 5, BookID: 14, UserID: 42, DueAt: now.Add(12 * time.Hour)},                   // Due soon
+	}}
+	reminders := NewReminders(loans, n, 24*time.Hour)
+	require.NoError(t, reminders.Send(now))
+	require.NoError(t, reminders.Send(now.Add(time.Minute)))
+	n.NotifyUser(42, EventFine, map[string]int{"amount": 100}) // Marks the end of the reminders
+
+	var got Notification
+	read(t, conn, &got)
+	assert.Equal(t, TopicAccount, got.Topic)
+	assert.Equal(t, EventDueSoon, got.Type)
+	var data LoanData
+	require.NoError(t, json.Unmarshal(got.Data, &data))
+	assert.Equal(t, uint(5), data.LoanID)
+	assert.Equal(t, uint(14), data.BookID)
+
+	read(t, conn, &got)
+	assert.Equal(t, EventFine, got.Type, "the loan is only reminded of once")
+	assert.NotNil(t, loans.loans[3].RemindedAt, "the other member's loan is reminded too")
+}
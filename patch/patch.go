@@ -0,0 +1,337 @@
+// Package patch applies JSON Merge Patch (RFC 7386) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	// ErrMalformed means the patch itself isn't valid JSON of the right shape.
+	ErrMalformed = errors.New("malformed patch")
+	// ErrInvalid means an operation can't be applied, e.g. its path doesn't exist.
+	ErrInvalid = errors.New("patch cannot be applied")
+	// ErrTestFailed means a "test" operation didn't match.
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// Merge applies a JSON Merge Patch to doc: objects are merged recursively,
+// null removes a member and anything else replaces the target.
+func Merge(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergeValue(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
+
+// Apply applies a JSON Patch, a list of add, remove, replace, move, copy and
+// test operations, to doc. Operations apply in order and all or nothing.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	var ops []map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: a JSON Patch is an array of operations", ErrMalformed)
+	}
+	for i, raw := range ops {
+		if target, err = applyOp(target, raw); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOp(doc interface{}, raw map[string]json.RawMessage) (interface{}, error) {
+	var op, path, from string
+	if err := stringField(raw, "op", &op, true); err != nil {
+		return nil, err
+	}
+	if err := stringField(raw, "path", &path, true); err != nil {
+		return nil, err
+	}
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	value, hasValue := raw["value"]
+
+	switch op {
+	case "add", "replace", "test":
+		if !hasValue {
+			return nil, fmt.Errorf("%w: %q needs a value", ErrMalformed, op)
+		}
+		v, err := decode(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		switch op {
+		case "add":
+			return add(doc, tokens, v)
+		case "replace":
+			if doc, err = remove(doc, tokens); err != nil {
+				return nil, err
+			}
+			return add(doc, tokens, v)
+		default:
+			current, err := get(doc, tokens)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, v) {
+				return nil, fmt.Errorf("%w: %s", ErrTestFailed, path)
+			}
+			return doc, nil
+		}
+	case "remove":
+		return remove(doc, tokens)
+	case "move", "copy":
+		if err := stringField(raw, "from", &from, true); err != nil {
+			return nil, err
+		}
+		fromTokens, err := parsePointer(from)
+		if err != nil {
+			return nil, err
+		}
+		v, err := get(doc, fromTokens)
+		if err != nil {
+			return nil, err
+		}
+		if op == "copy" {
+			return add(doc, tokens, deepCopy(v))
+		}
+		if path != from && strings.HasPrefix(path, from+"/") {
+			return nil, fmt.Errorf("%w: can't move %s into itself", ErrInvalid, from)
+		}
+		if doc, err = remove(doc, fromTokens); err != nil {
+			return nil, err
+		}
+		return add(doc, tokens, v)
+	}
+	return nil, fmt.Errorf("%w: unknown op %q", ErrMalformed, op)
+}
+
+func stringField(raw map[string]json.RawMessage, name string, dst *string, required bool) error {
+	value, ok := raw[name]
+	if !ok {
+		if required {
+			return fmt.Errorf("%w: missing %q", ErrMalformed, name)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(value, dst); err != nil {
+		return fmt.Errorf("%w: %q must be a string", ErrMalformed, name)
+	}
+	return nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrMalformed, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := index(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, token)
+		}
+	}
+	return doc, nil
+}
+
+// edit walks to the parent of the last token and replaces it with what
+// change returns, rebuilding the containers on the way back up.
+func edit(doc interface{}, tokens []string, change func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return change(doc, tokens[0])
+	}
+	child, err := get(doc, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = edit(child, tokens[1:], change)
+	if err != nil {
+		return nil, err
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[tokens[0]] = child
+	case []interface{}:
+		i, _ := index(tokens[0], len(node)-1)
+		node[i] = child
+	}
+	return doc, nil
+}
+
+func add(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return edit(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			i := len(node)
+			if key != "-" {
+				var err error
+				if i, err = index(key, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("%w: can't add to a scalar", ErrInvalid)
+	})
+}
+
+func remove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: can't remove the whole document", ErrInvalid)
+	}
+	return edit(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[key]; !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, key)
+			}
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			i, err := index(key, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, key)
+	})
+}
+
+// index parses an array index between 0 and max.
+func index(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: bad array index %q", ErrInvalid, token)
+	}
+	return i, nil
+}
+
+// equal compares decoded JSON values, treating numbers by value so 1 and 1.0 match.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	}
+	return a == b
+}
+
+func deepCopy(v interface{}) interface{} {
+	data, _ := json.Marshal(v)
+	out, _ := decode(data)
+	return out
+}
+
+// decode keeps numbers as json.Number so large integers survive a round trip.
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return v, nil
+}
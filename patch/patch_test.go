@@ -0,0 +1,85 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	// The example from RFC 7386, section 3
+	doc := `{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`
+	p := `{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`
+	out, err := Merge([]byte(doc), []byte(p))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"title":"Hello!","author":{"givenName":"John"},"tags":["example"],"content":"This will be unchanged","phoneNumber":"+01-123-456-7890"}`, string(out))
+
+	out, err = Merge([]byte(`{"a":"b"}`), []byte(`["c"]`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `["c"]`, string(out))
+
+	_, err = Merge([]byte(`{}`), []byte(`{"a":`))
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"test then replace", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"replace","path":"/baz","value":"x"}]`, `{"baz":"x"}`},
+		{"number equality", `{"n":1}`, `[{"op":"test","path":"/n","value":1.0}]`, `{"n":1}`},
+		{"null value", `{"a":1}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`},
+		{"escaped pointer", `{"a/b":1,"m~n":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/m~0n"}]`, `{}`},
+		{"replace root", `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name, patch string
+		want        error
+	}{
+		{"not an array", `{"op":"add"}`, ErrMalformed},
+		{"unknown op", `[{"op":"frob","path":"/a"}]`, ErrMalformed},
+		{"missing value", `[{"op":"add","path":"/a"}]`, ErrMalformed},
+		{"bad pointer", `[{"op":"remove","path":"a"}]`, ErrMalformed},
+		{"missing member", `[{"op":"remove","path":"/nope"}]`, ErrInvalid},
+		{"replace missing", `[{"op":"replace","path":"/nope","value":1}]`, ErrInvalid},
+		{"index out of range", `[{"op":"add","path":"/list/5","value":1}]`, ErrInvalid},
+		{"leading zero index", `[{"op":"remove","path":"/list/01"}]`, ErrInvalid},
+		{"missing parent", `[{"op":"add","path":"/x/y","value":1}]`, ErrInvalid},
+		{"move into child", `[{"op":"move","from":"/obj","path":"/obj/inner"}]`, ErrInvalid},
+		{"test mismatch", `[{"op":"test","path":"/a","value":"2"}]`, ErrTestFailed},
+	}
+	doc := []byte(`{"a":1,"list":[1,2],"obj":{}}`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply(doc, []byte(tt.patch))
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestApplyIsAllOrNothing(t *testing.T) {
+	doc := []byte(`{"a":1}`)
+	_, err := Apply(doc, []byte(`[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`))
+	assert.ErrorIs(t, err, ErrTestFailed)
+	assert.JSONEq(t, `{"a":1}`, string(doc))
+}
@@ -0,0 +1,102 @@
+// Package recommend computes item-to-item similarity from reading
+// histories: two books are similar when the same members read both
+// ("people who read this also read").
+package recommend
+
+import (
+	"math"
+	"sort"
+)
+
+// Scored is a book and how strongly it is recommended.
+type Scored struct {
+	BookID uint    `json:"book_id"`
+	Score  float64 `json:"score"`
+}
+
+// Similar computes, for every book in histories (user ID to the books the
+// user read), up to topK other books read by the same users. Scores are
+// the cosine similarity of the books' sets of readers, between 0 and 1, so
+// popular books don't crowd out everything else.
+func Similar(histories map[uint][]uint, topK int) map[uint][]Scored {
+	readers := map[uint]float64{}
+	together := map[uint]map[uint]float64{}
+	for _, books := range histories {
+		books = unique(books)
+		for i, a := range books {
+			readers[a]++
+			for _, b := range books[i+1:] {
+				add(together, a, b)
+				add(together, b, a)
+			}
+		}
+	}
+
+	model := make(map[uint][]Scored, len(together))
+	for a, others := range together {
+		list := make([]Scored, 0, len(others))
+		for b, count := range others {
+			list = append(list, Scored{BookID: b, Score: count / math.Sqrt(readers[a]*readers[b])})
+		}
+		Sort(list)
+		if len(list) > topK {
+			list = list[:topK]
+		}
+		model[a] = list
+	}
+	return model
+}
+
+// Combine adds up the scores of books found in several lists, such as the
+// similar books of each book a member read, leaving out the excluded
+// books, and returns the best limit books.
+func Combine(lists [][]Scored, exclude map[uint]bool, limit int) []Scored {
+	scores := map[uint]float64{}
+	for _, list := range lists {
+		for _, s := range list {
+			if !exclude[s.BookID] {
+				scores[s.BookID] += s.Score
+			}
+		}
+	}
+	combined := make([]Scored, 0, len(scores))
+	for id, score := range scores {
+		if score > 0 {
+			combined = append(combined, Scored{BookID: id, Score: score})
+		}
+	}
+	Sort(combined)
+	if len(combined) > limit {
+		combined = combined[:limit]
+	}
+	return combined
+}
+
+// Sort orders best first, ties by book ID so results are stable.
+func Sort(list []Scored) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].BookID < list[j].BookID
+	})
+}
+
+func add(together map[uint]map[uint]float64, a, b uint) {
+	if together[a] == nil {
+		together[a] = map[uint]float64{}
+	}
+	together[a][b]++
+}
+
+func unique(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	out := ids[:0:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
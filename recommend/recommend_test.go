@@ -0,0 +1,44 @@
+package recommend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimilar(t *testing.T) {
+	model := Similar(map[uint][]uint{
+		1: {10, 20, 30},
+		2: {10, 20},
+		3: {10, 40},
+		4: {50},
+		5: {20, 20}, // Read twice counts once
+	}, 10)
+
+	require.Len(t, model[10], 3)
+	// 10 and 20 share two of three readers each: 2 / sqrt(3*3)
+	assert.Equal(t, uint(20), model[10][0].BookID)
+	assert.InDelta(t, 2.0/3.0, model[10][0].Score, 1e-9)
+	// 30 and 40 share one reader with 10 and have no other: 1 / sqrt(3*1)
+	assert.Equal(t, []uint{30, 40}, []uint{model[10][1].BookID, model[10][2].BookID})
+	assert.InDelta(t, model[10][1].Score, model[10][2].Score, 1e-9)
+
+	assert.Equal(t, []Scored{{BookID: 10, Score: 1 / 1.7320508075688772}}, model[40])
+	assert.NotContains(t, model, uint(50), "nothing was read with it")
+}
+
+func TestSimilarKeepsTopK(t *testing.T) {
+	model := Similar(map[uint][]uint{1: {1, 2, 3, 4}, 2: {1, 2, 3}, 3: {1, 2}}, 2)
+	assert.Equal(t, []uint{2, 3}, []uint{model[1][0].BookID, model[1][1].BookID})
+	assert.Len(t, model[1], 2)
+}
+
+func TestCombine(t *testing.T) {
+	combined := Combine([][]Scored{
+		{{BookID: 1, Score: 0.5}, {BookID: 2, Score: 0.4}, {BookID: 3, Score: 0.9}},
+		{{BookID: 2, Score: 0.4}, {BookID: 4, Score: 0.1}},
+	}, map[uint]bool{3: true}, 2)
+
+	assert.Equal(t, []Scored{{BookID: 2, Score: 0.8}, {BookID: 1, Score: 0.5}}, combined)
+}
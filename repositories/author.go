@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+type AuthorRepository struct {
+	DB *gorm.DB
+}
+
+func NewAuthorRepository(db *gorm.DB) *AuthorRepository {
+	return &AuthorRepository{DB: db}
+}
+
+func (r *AuthorRepository) Create(author *models.Author) error {
+	return r.DB.Create(author).Error
+}
+
+func (r *AuthorRepository) FindByID(id uint) (*models.Author, error) {
+	var author models.Author
+	err := r.DB.First(&author, id).Error
+	return &author, err
+}
+
+// FindByIDs returns the authors that exist among ids, in no set order.
+func (r *AuthorRepository) FindByIDs(ids []uint) ([]models.Author, error) {
+	var authors []models.Author
+	err := r.DB.Where("id IN ?", ids).Find(&authors).Error
+	return authors, err
+}
+
+// FindAll lists authors by name; query, if set, matches part of the name.
+func (r *AuthorRepository) FindAll(query string, limit, offset int) ([]models.Author, error) {
+	db := r.DB
+	if query != "" {
+		db = db.Where("name LIKE ?", "%"+escapeLike(query)+"%")
+	}
+	var authors []models.Author
+	err := db.Order("name, id").Limit(limit).Offset(offset).Find(&authors).Error
+	return authors, err
+}
+
+// FindOrCreate returns the oldest author with this name, comparing as the
+// column's collation does (case-insensitively on MySQL's default), and
+// creates one if there is none.
+func (r *AuthorRepository) FindOrCreate(name string) (*models.Author, error) {
+	var author models.Author
+	err := r.DB.Where("name = ?", name).Order("id").First(&author).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		author = models.Author{Name: name}
+		err = r.DB.Create(&author).Error
+	}
+	return &author, err
+}
+
+// FindMerged returns a deleted author that was merged into another, so
+// old links can be sent on to the survivor.
+func (r *AuthorRepository) FindMerged(id uint) (*models.Author, error) {
+	var author models.Author
+	err := r.DB.Unscoped().Where("merged_into_id IS NOT NULL").First(&author, id).Error
+	return &author, err
+}
+
+// Rename changes an author's name and the author names shown on their books.
+func (r *AuthorRepository) Rename(author *models.Author, name string, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		if err := tx.Model(author).Update("name", name).Error; err != nil {
+			return err
+		}
+		author.Name = name
+		var bookIDs []uint
+		if err := tx.Model(&models.BookAuthor{}).Where("author_id = ?", author.ID).
+			Distinct().Pluck("book_id", &bookIDs).Error; err != nil {
+			return err
+		}
+		return refreshAuthorNames(tx, bookIDs)
+	})
+}
+
+// Merge moves every credit of the source authors to the target and
+// deletes the sources, leaving MergedIntoID behind. A credit the target
+// already has in the same role is kept once.
+func (r *AuthorRepository) Merge(targetID uint, sourceIDs []uint, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		var bookIDs []uint
+		if err := tx.Model(&models.BookAuthor{}).Where("author_id IN ?", sourceIDs).
+			Distinct().Pluck("book_id", &bookIDs).Error; err != nil {
+			return err
+		}
+		// IGNORE skips rows that would duplicate a credit of the target;
+		// those are deleted with the rest of the sources' credits below
+		if err := tx.Exec("UPDATE IGNORE book_authors SET author_id = ? WHERE author_id IN ?", targetID, sourceIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("author_id IN ?", sourceIDs).Delete(&models.BookAuthor{}).Error; err != nil {
+			return err
+		}
+		// Authors merged into a source earlier now lead to the target too
+		if err := tx.Unscoped().Model(&models.Author{}).Where("id IN ? OR merged_into_id IN ?", sourceIDs, sourceIDs).
+			Update("merged_into_id", targetID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Author{}, sourceIDs).Error; err != nil {
+			return err
+		}
+		return refreshAuthorNames(tx, bookIDs)
+	})
+}
+
+// refreshAuthorNames recomputes the author name of each book from its
+// credits and bumps the book's version, since its representation changed.
+func refreshAuthorNames(tx *gorm.DB, bookIDs []uint) error {
+	for _, id := range bookIDs {
+		var credits []models.BookAuthor
+		if err := tx.Preload("Author").Where("book_id = ?", id).Order("position").Find(&credits).Error; err != nil {
+			return err
+		}
+		err := tx.Unscoped().Model(&models.Book{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+			"author":  CreditedName(credits),
+			"version": gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreditedName is the author name shown for a book with these credits: its
+// authors in order, or everyone credited if it has no author, such as an
+// anthology with only an editor. Credits must have Author loaded.
+func CreditedName(credits []models.BookAuthor) string {
+	var authors, everyone []string
+	for _, credit := range credits {
+		if credit.Author == nil {
+			continue
+		}
+		everyone = append(everyone, credit.Author.Name)
+		if credit.Role == models.ContributorAuthor {
+			authors = append(authors, credit.Author.Name)
+		}
+	}
+	if len(authors) == 0 {
+		authors = everyone
+	}
+	return strings.Join(authors, ", ")
+}
@@ -1,7 +1,13 @@
 package repositories
 
 import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
     "gorm.io/gorm"
+    "gorm.io/gorm/clause"
     "library-api/models"
 	"library-api/logger"
 	
@@ -9,6 +15,10 @@ import (
 
 var Logger *logger.AsyncLogger
 
+// ErrVersionConflict is returned by versioned writes when the row has moved
+// on since the caller read it.
+var ErrVersionConflict = errors.New("row was changed by another request")
+
 type BookRepository struct {
     DB *gorm.DB
 }
@@ -17,26 +27,559 @@ func NewBookRepository(db *gorm.DB) *BookRepository {
     return &BookRepository{DB: db}
 }
 
-func (r *BookRepository) Create(book *models.Book) error {
-    return r.DB.Create(book).Error
+// Create, Update and Delete write the given outbox events in the same
+// transaction. Create and Update also save book.Contributors, replacing the
+// book's credits, and the subject and tag links when they aren't nil.
+// prepare, if not nil, runs first in the transaction to find or create the
+// authors, subjects and tags those point at, so a failed write creates
+// none of them.
+func (r *BookRepository) Create(book *models.Book, prepare func(tx *gorm.DB) error, events ...EventFunc) error {
+    return withEvents(r.DB, events, func(tx *gorm.DB) error {
+        if prepare != nil {
+            if err := prepare(tx); err != nil {
+                return err
+            }
+        }
+        if err := tx.Omit(clause.Associations).Create(book).Error; err != nil {
+            return err
+        }
+        if err := saveContributors(tx, book); err != nil {
+            return err
+        }
+        return saveTaxonomy(tx, book)
+    })
+}
+
+func saveContributors(tx *gorm.DB, book *models.Book) error {
+    if err := tx.Where("book_id = ?", book.ID).Delete(&models.BookAuthor{}).Error; err != nil {
+        return err
+    }
+    if len(book.Contributors) == 0 {
+        return nil
+    }
+    for i := range book.Contributors {
+        book.Contributors[i].BookID = book.ID
+    }
+    return tx.Omit("Author").Create(&book.Contributors).Error
+}
+
+func saveTaxonomy(tx *gorm.DB, book *models.Book) error {
+    if book.SubjectLinks != nil {
+        if err := tx.Where("book_id = ?", book.ID).Delete(&models.BookSubject{}).Error; err != nil {
+            return err
+        }
+        for i := range book.SubjectLinks {
+            book.SubjectLinks[i].BookID = book.ID
+        }
+        if len(book.SubjectLinks) > 0 {
+            if err := tx.Create(&book.SubjectLinks).Error; err != nil {
+                return err
+            }
+        }
+    }
+    if book.TagLinks != nil {
+        if err := tx.Where("book_id = ?", book.ID).Delete(&models.BookTag{}).Error; err != nil {
+            return err
+        }
+        for i := range book.TagLinks {
+            book.TagLinks[i].BookID = book.ID
+        }
+        if len(book.TagLinks) > 0 {
+            return tx.Create(&book.TagLinks).Error
+        }
+    }
+    return nil
+}
+
+// BookFilter narrows listings and exports. Empty fields don't filter.
+type BookFilter struct {
+    Title       string // Substring of the title
+    Author      string // Substring of the author
+    AuthorID    uint   // Credited author
+    Role        string // Role of AuthorID; any role if empty
+    PublisherID uint
+    SubjectID   uint   // Linked to the subject or any subject below it
+    Tag         string // Tag name
+    Language    string
+    WorkID      uint   // Editions of the work
+    SeriesID    uint
+    Available   *bool  // true: not out on loan; false: on loan
+    Sort        string // Order of FindAll: SortRating, SortRatingCount or by ID
+}
+
+// Listing orders besides the default, by ID.
+const (
+    SortRating      = "rating"       // Best rated first
+    SortRatingCount = "rating_count" // Most rated first
+)
+
+// order is the ORDER BY of a listing.
+func (f BookFilter) order() string {
+    switch f.Sort {
+    case SortRating:
+        return "rating_average DESC, rating_count DESC, id"
+    case SortRatingCount:
+        return "rating_count DESC, rating_average DESC, id"
+    }
+    return "id"
+}
+
+func (f BookFilter) apply(db *gorm.DB) *gorm.DB {
+    if f.Title != "" {
+        db = db.Where("title LIKE ?", "%"+escapeLike(f.Title)+"%")
+    }
+    if f.Author != "" {
+        db = db.Where("author LIKE ?", "%"+escapeLike(f.Author)+"%")
+    }
+    if f.AuthorID != 0 {
+        credits := db.Session(&gorm.Session{NewDB: true}).Model(&models.BookAuthor{}).
+            Select("book_id").Where("author_id = ?", f.AuthorID)
+        if f.Role != "" {
+            credits = credits.Where("role = ?", f.Role)
+        }
+        db = db.Where("books.id IN (?)", credits)
+    }
+    if f.PublisherID != 0 {
+        db = db.Where("publisher_id = ?", f.PublisherID)
+    }
+    if f.SubjectID != 0 {
+        db = db.Where(`books.id IN (SELECT book_subjects.book_id FROM book_subjects
+            JOIN subjects ON subjects.id = book_subjects.subject_id AND subjects.deleted_at IS NULL
+            JOIN subjects AS root ON subjects.path LIKE CONCAT(root.path, '%')
+            WHERE root.id = ?)`, f.SubjectID)
+    }
+    if f.Tag != "" {
+        db = db.Where(`books.id IN (SELECT book_tags.book_id FROM book_tags
+            JOIN tags ON tags.id = book_tags.tag_id WHERE tags.name = ?)`, NormalizeTag(f.Tag))
+    }
+    if f.Language != "" {
+        db = db.Where("language = ?", f.Language)
+    }
+    if f.WorkID != 0 {
+        db = db.Where("work_id = ?", f.WorkID)
+    }
+    if f.SeriesID != 0 {
+        db = db.Where("series_id = ?", f.SeriesID)
+    }
+    if f.Available != nil {
+        onLoan := "EXISTS (SELECT 1 FROM loans WHERE loans.book_id = books.id AND loans.returned_at IS NULL)"
+        if *f.Available {
+            onLoan = "NOT " + onLoan
+        }
+        db = db.Where(onLoan)
+    }
+    return db
+}
+
+// withContributors loads the books' credits in order, with their authors.
+func withContributors(db *gorm.DB) *gorm.DB {
+    return db.Preload("Contributors", func(db *gorm.DB) *gorm.DB {
+        return db.Order("position")
+    }).Preload("Contributors.Author")
 }
 
-func (r *BookRepository) FindAll(limit, offset int) ([]models.Book, error) {
+// escapeLike makes % and _ in user input match literally.
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *BookRepository) FindAll(filter BookFilter, limit, offset int) ([]models.Book, error) {
     var books []models.Book
-    err := r.DB.Limit(limit).Offset(offset).Find(&books).Error
+    err := withContributors(filter.apply(r.DB)).Order(filter.order()).Limit(limit).Offset(offset).Find(&books).Error
     return books, err
 }
 
+// CountExisting counts the books among ids that exist.
+func (r *BookRepository) CountExisting(ids []uint) (int64, error) {
+    var count int64
+    err := r.DB.Model(&models.Book{}).Where("id IN ?", ids).Count(&count).Error
+    return count, err
+}
+
+// FindInBatches calls fn with the matching books in ID order, batchSize at
+// a time, reading each batch with a keyset query so memory use stays flat
+// however large the catalog is.
+func (r *BookRepository) FindInBatches(filter BookFilter, batchSize int, fn func([]models.Book) error) error {
+    var books []models.Book
+    return filter.apply(r.DB).FindInBatches(&books, batchSize, func(tx *gorm.DB, batch int) error {
+        return fn(books)
+    }).Error
+}
+
 func (r *BookRepository) FindByID(id uint) (*models.Book, error) {
     var book models.Book
-    err := r.DB.First(&book, id).Error
+    err := withContributors(r.DB).First(&book, id).Error
+    return &book, err
+}
+
+// FindByIDs reads the books among ids that exist, in the order of ids.
+func (r *BookRepository) FindByIDs(ids []uint) ([]models.Book, error) {
+    var found []models.Book
+    if err := withContributors(r.DB).Where("id IN ?", ids).Find(&found).Error; err != nil {
+        return nil, err
+    }
+    byID := make(map[uint]models.Book, len(found))
+    for _, book := range found {
+        byID[book.ID] = book
+    }
+    books := make([]models.Book, 0, len(found))
+    for _, id := range ids {
+        if book, ok := byID[id]; ok {
+            books = append(books, book)
+        }
+    }
+    return books, nil
+}
+
+// FindDeleted finds a book that has been deleted.
+func (r *BookRepository) FindDeleted(id uint) (*models.Book, error) {
+    var book models.Book
+    err := r.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&book, id).Error
+    return &book, err
+}
+
+// FindAllDeleted lists deleted books, most recently deleted first.
+func (r *BookRepository) FindAllDeleted(limit, offset int) ([]models.Book, error) {
+    var books []models.Book
+    err := withContributors(r.DB.Unscoped()).Where("deleted_at IS NOT NULL").
+        Order("deleted_at DESC, id DESC").Limit(limit).Offset(offset).Find(&books).Error
+    return books, err
+}
+
+// FindDeletedBefore lists up to limit books deleted before t, oldest first,
+// leaving out those still on loan, which can't be purged yet.
+func (r *BookRepository) FindDeletedBefore(t time.Time, limit int) ([]models.Book, error) {
+    var books []models.Book
+    err := r.DB.Unscoped().Where("deleted_at < ?", t).
+        Where("NOT EXISTS (SELECT 1 FROM loans WHERE loans.book_id = books.id AND loans.returned_at IS NULL)").
+        Order("deleted_at, id").Limit(limit).Find(&books).Error
+    return books, err
+}
+
+// FindByISBN looks a book up by its ISBN-13. withDeleted includes deleted
+// books, which still hold their ISBN.
+func (r *BookRepository) FindByISBN(isbn13 string, withDeleted bool) (*models.Book, error) {
+    db := r.DB
+    if withDeleted {
+        db = db.Unscoped()
+    }
+    var book models.Book
+    err := withContributors(db).Where("isbn13 = ?", isbn13).First(&book).Error
     return &book, err
 }
 
-func (r *BookRepository) Update(book *models.Book) error {
-    return r.DB.Save(book).Error
+// Update saves book only if the stored row is still at version, and bumps
+// the version. ErrVersionConflict means someone else changed it first.
+func (r *BookRepository) Update(book *models.Book, version uint, prepare func(tx *gorm.DB) error, events ...EventFunc) error {
+    return withEvents(r.DB, events, func(tx *gorm.DB) error {
+        if prepare != nil {
+            if err := prepare(tx); err != nil {
+                return err
+            }
+        }
+        book.Version = version + 1
+        res := updateRow(tx, book, version)
+        if res.Error != nil {
+            book.Version = version
+            return res.Error
+        }
+        if res.RowsAffected == 0 {
+            book.Version = version
+            return r.missingOrConflict(tx, book.ID)
+        }
+        // The rating may have moved since the client read the book
+        if err := tx.Select("rating_average", "rating_count").First(book, book.ID).Error; err != nil {
+            return err
+        }
+        if err := saveContributors(tx, book); err != nil {
+            return err
+        }
+        return saveTaxonomy(tx, book)
+    })
+}
+
+// ratingColumns are kept by reviews, which change them without bumping the
+// version, so writes of a whole book leave them alone.
+var ratingColumns = []string{"RatingAverage", "RatingCount"}
+
+// updateRow writes every column of book but its ID, creation time,
+// deletion, rating and associations, if the row is still at version.
+func updateRow(tx *gorm.DB, book *models.Book, version uint) *gorm.DB {
+    omit := append([]string{"ID", "CreatedAt", "DeletedAt", clause.Associations}, ratingColumns...)
+    return tx.Model(book).Where("version = ?", version).Select("*").Omit(omit...).Updates(book)
+}
+
+// SetCover saves the book's cover fields and bumps its version. Unlike
+// Update it doesn't check the version: a new cover doesn't clash with
+// edits to the details. previousKey receives the key of the cover it
+// replaced before events are built.
+func (r *BookRepository) SetCover(book *models.Book, previousKey *string, events ...EventFunc) error {
+    return withEvents(r.DB, events, func(tx *gorm.DB) error {
+        var current models.Book
+        err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "cover_key").First(&current, book.ID).Error
+        if err != nil {
+            return err
+        }
+        *previousKey = current.CoverKey
+        err = tx.Model(&current).Updates(map[string]interface{}{
+            "cover_key":        book.CoverKey,
+            "cover_type":       book.CoverType,
+            "cover_updated_at": book.CoverUpdatedAt,
+            "version":          gorm.Expr("version + 1"),
+        }).Error
+        if err != nil {
+            return err
+        }
+        return tx.Select("version", "updated_at").First(book, book.ID).Error
+    })
+}
+
+// FindUnlinked returns books that have an author name but no credited
+// authors: imported books, and books from before authors were tracked.
+func (r *BookRepository) FindUnlinked(limit int) ([]models.Book, error) {
+    var books []models.Book
+    err := r.DB.Where("author <> ''").
+        Where("NOT EXISTS (SELECT 1 FROM book_authors WHERE book_authors.book_id = books.id)").
+        Order("id").Limit(limit).Find(&books).Error
+    return books, err
+}
+
+// AddContributors credits authors on books that exist already, skipping
+// credits the books have, and bumps the versions of the books.
+func (r *BookRepository) AddContributors(credits []models.BookAuthor) error {
+    if len(credits) == 0 {
+        return nil
+    }
+    var ids []uint
+    for _, credit := range credits {
+        ids = append(ids, credit.BookID)
+    }
+    return r.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Author").Create(&credits).Error; err != nil {
+            return err
+        }
+        return tx.Unscoped().Model(&models.Book{}).Where("id IN ?", ids).
+            UpdateColumn("version", gorm.Expr("version + 1")).Error
+    })
+}
+
+// UpsertSkip is a book Upsert left alone, by its index in the batch, and
+// why.
+type UpsertSkip struct {
+    Index   int
+    Field   string
+    Code    string
+    Message string
+}
+
+// Upsert writes a batch of imported books in one transaction. A book with
+// an ID replaces that book; one without an ID but with the ISBN of a book
+// replaces that book; the rest are inserted. Books whose ID doesn't exist,
+// whose match is deleted (restoring goes through the trash), whose ISBN
+// another book has or that repeat the ISBN of a book inserted earlier in the
+// batch are skipped and returned. It returns how many books were
+// created and updated.
+func (r *BookRepository) Upsert(books []models.Book, events ...EventFunc) (created, updated int, skipped []UpsertSkip, err error) {
+    var ids []uint
+    var isbns []string
+    for _, book := range books {
+        if book.ID != 0 {
+            ids = append(ids, book.ID)
+        }
+        if book.ISBN13 != nil {
+            isbns = append(isbns, *book.ISBN13)
+        }
+    }
+    err = withEvents(r.DB, events, func(tx *gorm.DB) error {
+        created, updated, skipped = 0, 0, nil
+        byID := map[uint]*models.Book{}
+        byISBN := map[string]*models.Book{}
+        var existing []models.Book
+        if len(ids) > 0 || len(isbns) > 0 {
+            q := tx.Unscoped().Select("id", "author", "isbn13", "deleted_at")
+            if len(ids) > 0 && len(isbns) > 0 {
+                q = q.Where("id IN ? OR isbn13 IN ?", ids, isbns)
+            } else if len(ids) > 0 {
+                q = q.Where("id IN ?", ids)
+            } else {
+                q = q.Where("isbn13 IN ?", isbns)
+            }
+            if err := q.Find(&existing).Error; err != nil {
+                return err
+            }
+        }
+        for i := range existing {
+            byID[existing[i].ID] = &existing[i]
+            if existing[i].ISBN13 != nil {
+                byISBN[*existing[i].ISBN13] = &existing[i]
+            }
+        }
+
+        var inserts []models.Book
+        pending := map[string]bool{} // ISBNs of inserts
+        var changedCredits []uint
+        for i, book := range books {
+            skip := func(field, code, message string) {
+                skipped = append(skipped, UpsertSkip{Index: i, Field: field, Code: code, Message: message})
+            }
+            var target *models.Book
+            if book.ID != 0 {
+                target = byID[book.ID]
+                if target == nil {
+                    skip("id", "not_found", "no book has this id")
+                    continue
+                }
+            } else if book.ISBN13 != nil {
+                if _, ok := pending[*book.ISBN13]; ok {
+                    skip("isbn", "duplicate", "an earlier row of the import has this ISBN")
+                    continue
+                }
+                target = byISBN[*book.ISBN13]
+            }
+            if target != nil && target.DeletedAt.Valid {
+                field := "id"
+                if book.ID == 0 {
+                    field = "isbn"
+                }
+                skip(field, "deleted", fmt.Sprintf("book %d is deleted; restore it from the trash first", target.ID))
+                continue
+            }
+            if book.ISBN13 != nil {
+                owner := byISBN[*book.ISBN13]
+                inBatch := pending[*book.ISBN13]
+                if (owner != nil && (target == nil || owner.ID != target.ID)) || inBatch {
+                    skip("isbn", "isbn_taken", "another book has this ISBN")
+                    continue
+                }
+            }
+            if target == nil {
+                if book.ISBN13 != nil {
+                    pending[*book.ISBN13] = true
+                }
+                inserts = append(inserts, book)
+                continue
+            }
+
+            changes := map[string]interface{}{
+                "title":      book.Title,
+                "author":     book.Author,
+                "updated_at": time.Now(),
+                "version":    gorm.Expr("version + 1"),
+            }
+            if book.ISBN13 != nil { // A missing ISBN keeps the old one
+                changes["isbn13"], changes["isbn10"] = book.ISBN13, book.ISBN10
+                if target.ISBN13 != nil && *target.ISBN13 != *book.ISBN13 {
+                    delete(byISBN, *target.ISBN13)
+                }
+                target.ISBN13 = book.ISBN13
+                byISBN[*book.ISBN13] = target
+            }
+            if err := tx.Model(&models.Book{}).Where("id = ?", target.ID).Updates(changes).Error; err != nil {
+                return err
+            }
+            if target.Author != book.Author {
+                // Credits follow the author name, so a new name gets linked again
+                changedCredits = append(changedCredits, target.ID)
+                target.Author = book.Author
+            }
+            updated++
+        }
+        if len(inserts) > 0 {
+            if err := tx.Create(&inserts).Error; err != nil {
+                return err
+            }
+            created = len(inserts)
+        }
+        if len(changedCredits) > 0 {
+            return tx.Where("book_id IN ?", changedCredits).Delete(&models.BookAuthor{}).Error
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, 0, nil, err
+    }
+    return created, updated, skipped, nil
+}
+
+// Delete soft-deletes the book if it is still at version.
+func (r *BookRepository) Delete(id, version uint, events ...EventFunc) error {
+    return withEvents(r.DB, events, func(tx *gorm.DB) error {
+        res := tx.Where("version = ?", version).Delete(&models.Book{}, id)
+        if res.Error == nil && res.RowsAffected == 0 {
+            return r.missingOrConflict(tx, id) // Nothing to announce
+        }
+        return res.Error
+    })
+}
+
+// Restore undeletes the book, saving its cover fields too in case they
+// were cleared, bumps its version and reloads it. gorm.ErrRecordNotFound
+// means it isn't deleted.
+func (r *BookRepository) Restore(book *models.Book, events ...EventFunc) error {
+    return withEvents(r.DB, events, func(tx *gorm.DB) error {
+        res := tx.Unscoped().Model(&models.Book{}).Where("id = ? AND deleted_at IS NOT NULL", book.ID).Updates(map[string]interface{}{
+            "deleted_at":       nil,
+            "cover_key":        book.CoverKey,
+            "cover_type":       book.CoverType,
+            "cover_updated_at": book.CoverUpdatedAt,
+            "version":          gorm.Expr("version + 1"),
+        })
+        if res.Error != nil {
+            return res.Error
+        }
+        if res.RowsAffected == 0 {
+            return gorm.ErrRecordNotFound
+        }
+        return withContributors(tx).First(book, book.ID).Error
+    })
+}
+
+// Purge deletes a deleted book for good, with its credits, subject and tag
+// links, reviews, places in collections and loan history. Holds it was set
+// aside for go back to waiting, and fulfilled ones forget it. A book still
+// on loan is ErrOpenLoans; gorm.ErrRecordNotFound means it isn't deleted,
+// or is already gone.
+func (r *BookRepository) Purge(id uint, events ...EventFunc) error {
+    return withEvents(r.DB, events, func(tx *gorm.DB) error {
+        var book models.Book
+        err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+            Where("deleted_at IS NOT NULL").First(&book, id).Error
+        if err != nil {
+            return err
+        }
+        open, err := hasOpenLoans(tx, "book_id", id)
+        if err != nil {
+            return err
+        }
+        if open {
+            return ErrOpenLoans
+        }
+        err = tx.Model(&models.Hold{}).Where("book_id = ? AND status = ?", id, models.HoldReady).
+            Updates(map[string]interface{}{"status": models.HoldWaiting, "book_id": nil, "ready_at": nil}).Error
+        if err != nil {
+            return err
+        }
+        if err := tx.Model(&models.Hold{}).Where("book_id = ?", id).Update("book_id", nil).Error; err != nil {
+            return err
+        }
+        for _, dependent := range []interface{}{&models.BookAuthor{}, &models.BookSubject{}, &models.BookTag{},
+            &models.CollectionItem{}, &models.Review{}, &models.Loan{}} {
+            if err := tx.Where("book_id = ?", id).Delete(dependent).Error; err != nil {
+                return err
+            }
+        }
+        return tx.Unscoped().Delete(&book).Error
+    })
 }
 
-func (r *BookRepository) Delete(id uint) error {
-    return r.DB.Delete(&models.Book{}, id).Error
+// missingOrConflict explains why a versioned write matched no rows.
+func (r *BookRepository) missingOrConflict(tx *gorm.DB, id uint) error {
+    var count int64
+    if err := tx.Model(&models.Book{}).Where("id = ?", id).Count(&count).Error; err != nil {
+        return err
+    }
+    if count == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return ErrVersionConflict
 }
\ No newline at end of file
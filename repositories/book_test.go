@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+// dryRun builds statements without a database.
+func dryRun(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test@tcp(127.0.0.1:0)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	return db
+}
+
+func TestUpdateRow_LeavesRatingToReviews(t *testing.T) {
+	// The editor's copy was read before a review changed the rating
+	book := &models.Book{Title: "Dune", Author: "Frank Herbert", Version: 4, RatingAverage: 4, RatingCount: 2}
+	book.ID = 1
+
+	res := updateRow(dryRun(t), book, 3)
+	require.NoError(t, res.Error)
+	sql := res.Statement.SQL.String()
+	assert.Contains(t, sql, "`title`=")
+	assert.Contains(t, sql, "`version`=")
+	assert.NotContains(t, sql, "rating_average")
+	assert.NotContains(t, sql, "rating_count")
+}
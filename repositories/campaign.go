@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+type CampaignRepository struct {
+	DB *gorm.DB
+}
+
+func NewCampaignRepository(db *gorm.DB) *CampaignRepository {
+	return &CampaignRepository{DB: db}
+}
+
+func (r *CampaignRepository) Create(campaign *models.Campaign) error {
+	return r.DB.Create(campaign).Error
+}
+
+func (r *CampaignRepository) Update(campaign *models.Campaign) error {
+	return r.DB.Save(campaign).Error
+}
+
+func (r *CampaignRepository) FindAll(limit, offset int) ([]models.Campaign, error) {
+	var campaigns []models.Campaign
+	err := r.DB.Order("id DESC").Limit(limit).Offset(offset).Find(&campaigns).Error
+	return campaigns, err
+}
+
+func (r *CampaignRepository) FindByID(id uint) (*models.Campaign, error) {
+	var campaign models.Campaign
+	err := r.DB.First(&campaign, id).Error
+	return &campaign, err
+}
+
+func (r *CampaignRepository) FindDue(now time.Time) ([]models.Campaign, error) {
+	var campaigns []models.Campaign
+	err := r.DB.Where("status = ? AND scheduled_at <= ?", models.CampaignScheduled, now).Find(&campaigns).Error
+	return campaigns, err
+}
+
+// TransitionStatus moves a campaign from one status to another and reports
+// whether this caller won, so two replicas never send the same campaign.
+func (r *CampaignRepository) TransitionStatus(id uint, from, to string) (bool, error) {
+	res := r.DB.Model(&models.Campaign{}).Where("id = ? AND status = ?", id, from).Update("status", to)
+	return res.RowsAffected == 1, res.Error
+}
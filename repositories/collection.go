@@ -0,0 +1,245 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"library-api/models"
+)
+
+// ErrOrderMismatch means a new order doesn't list exactly the collection's
+// books.
+var ErrOrderMismatch = errors.New("order must list each of the collection's books once")
+
+type CollectionRepository struct {
+	DB *gorm.DB
+}
+
+func NewCollectionRepository(db *gorm.DB) *CollectionRepository {
+	return &CollectionRepository{DB: db}
+}
+
+// CollectionFilter narrows collection listings. Empty fields don't filter.
+type CollectionFilter struct {
+	OwnerID    uint
+	Visibility string
+}
+
+// withBookCount reads collections with the number of books in them.
+func withBookCount(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Collection{}).Select(`collections.*, (SELECT COUNT(*) FROM collection_items
+		JOIN books ON books.id = collection_items.book_id AND books.deleted_at IS NULL
+		WHERE collection_items.collection_id = collections.id) AS book_count`)
+}
+
+// FindAll lists collections, most recently changed first.
+func (r *CollectionRepository) FindAll(filter CollectionFilter, limit, offset int) ([]models.Collection, error) {
+	db := withBookCount(r.DB)
+	if filter.OwnerID != 0 {
+		db = db.Where("owner_id = ?", filter.OwnerID)
+	}
+	if filter.Visibility != "" {
+		db = db.Where("visibility = ?", filter.Visibility)
+	}
+	var collections []models.Collection
+	err := db.Order("updated_at DESC, id DESC").Limit(limit).Offset(offset).Find(&collections).Error
+	return collections, err
+}
+
+func (r *CollectionRepository) FindByID(id uint) (*models.Collection, error) {
+	var collection models.Collection
+	err := withBookCount(r.DB).Where("id = ?", id).Take(&collection).Error
+	return &collection, err
+}
+
+func (r *CollectionRepository) FindByToken(token string) (*models.Collection, error) {
+	var collection models.Collection
+	err := withBookCount(r.DB).Where("share_token = ?", token).Take(&collection).Error
+	return &collection, err
+}
+
+// FindSharedWithBook lists the public and unlisted collections the book is
+// in, without their books.
+func (r *CollectionRepository) FindSharedWithBook(bookID uint) ([]models.Collection, error) {
+	var collections []models.Collection
+	err := r.DB.Select("collections.id", "collections.visibility", "collections.share_token").
+		Joins("JOIN collection_items ON collection_items.collection_id = collections.id").
+		Where("collection_items.book_id = ? AND collections.visibility <> ?", bookID, models.VisibilityPrivate).
+		Find(&collections).Error
+	return collections, err
+}
+
+// LoadItems loads the collection's books in order. Deleted books are left
+// out; they come back if the book is restored.
+func (r *CollectionRepository) LoadItems(collection *models.Collection) error {
+	collection.Items = nil
+	return r.DB.Joins("JOIN books ON books.id = collection_items.book_id AND books.deleted_at IS NULL").
+		Preload("Book", withContributors).
+		Where("collection_items.collection_id = ?", collection.ID).
+		Order("collection_items.position").Find(&collection.Items).Error
+}
+
+func (r *CollectionRepository) Create(collection *models.Collection, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		return tx.Omit("Items").Create(collection).Error
+	})
+}
+
+// Update saves the title, description and visibility.
+func (r *CollectionRepository) Update(collection *models.Collection, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		return tx.Model(collection).Select("title", "description", "visibility", "updated_at").Updates(collection).Error
+	})
+}
+
+func (r *CollectionRepository) Delete(collection *models.Collection, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.CollectionItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(collection).Error
+	})
+}
+
+// AddBooks inserts the books at position, or appends them if position is
+// negative or past the end. Books already in the collection stay where
+// they are.
+func (r *CollectionRepository) AddBooks(collection *models.Collection, bookIDs []uint, position int, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		current, err := lockItems(tx, collection.ID)
+		if err != nil {
+			return err
+		}
+		present := make(map[uint]bool, len(current))
+		for _, item := range current {
+			present[item.BookID] = true
+		}
+		var items []models.CollectionItem
+		for _, id := range bookIDs {
+			if !present[id] {
+				present[id] = true
+				items = append(items, models.CollectionItem{CollectionID: collection.ID, BookID: id})
+			}
+		}
+		if len(items) == 0 {
+			return touch(tx, collection)
+		}
+		if position < 0 || position > len(current) {
+			position = len(current)
+		}
+		err = tx.Model(&models.CollectionItem{}).
+			Where("collection_id = ? AND position >= ?", collection.ID, position).
+			UpdateColumn("position", gorm.Expr("position + ?", len(items))).Error
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].Position = position + i
+		}
+		if err := tx.Omit("Book").Create(&items).Error; err != nil {
+			return err
+		}
+		return touch(tx, collection)
+	})
+}
+
+// RemoveBook takes the book out of the collection and closes the gap.
+// gorm.ErrRecordNotFound means it wasn't in it.
+func (r *CollectionRepository) RemoveBook(collection *models.Collection, bookID uint, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		current, err := lockItems(tx, collection.ID)
+		if err != nil {
+			return err
+		}
+		position := -1
+		for _, item := range current {
+			if item.BookID == bookID {
+				position = item.Position
+			}
+		}
+		if position < 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err = tx.Where("collection_id = ? AND book_id = ?", collection.ID, bookID).Delete(&models.CollectionItem{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.CollectionItem{}).
+			Where("collection_id = ? AND position > ?", collection.ID, position).
+			UpdateColumn("position", gorm.Expr("position - 1")).Error
+		if err != nil {
+			return err
+		}
+		return touch(tx, collection)
+	})
+}
+
+// Reorder puts the collection's books in the order of bookIDs, which must
+// list each of them once, or ErrOrderMismatch. Deleted books, which
+// listings leave out, go after them.
+func (r *CollectionRepository) Reorder(collection *models.Collection, bookIDs []uint, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		current, err := lockItems(tx, collection.ID)
+		if err != nil {
+			return err
+		}
+		var live []uint
+		err = tx.Model(&models.CollectionItem{}).
+			Joins("JOIN books ON books.id = collection_items.book_id AND books.deleted_at IS NULL").
+			Where("collection_items.collection_id = ?", collection.ID).Pluck("collection_items.book_id", &live).Error
+		if err != nil {
+			return err
+		}
+		if len(bookIDs) != len(live) {
+			return ErrOrderMismatch
+		}
+		order := make(map[uint]int, len(current))
+		for _, id := range live {
+			order[id] = -1
+		}
+		for position, id := range bookIDs {
+			if previous, ok := order[id]; !ok || previous >= 0 {
+				return ErrOrderMismatch // Not in the collection, or listed twice
+			}
+			order[id] = position
+		}
+		next := len(bookIDs)
+		for _, item := range current {
+			position, ok := order[item.BookID]
+			if !ok {
+				position = next
+				next++
+			}
+			if position == item.Position {
+				continue
+			}
+			err := tx.Model(&models.CollectionItem{}).Where("collection_id = ? AND book_id = ?", collection.ID, item.BookID).
+				UpdateColumn("position", position).Error
+			if err != nil {
+				return err
+			}
+		}
+		return touch(tx, collection)
+	})
+}
+
+// lockItems locks the collection, so changes to its books queue up, and
+// returns its items in order, those of deleted books included.
+func lockItems(tx *gorm.DB, collectionID uint) ([]models.CollectionItem, error) {
+	var collection models.Collection
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&collection, collectionID).Error
+	if err != nil {
+		return nil, err
+	}
+	var items []models.CollectionItem
+	err = tx.Where("collection_id = ?", collectionID).Order("position").Find(&items).Error
+	return items, err
+}
+
+// touch marks the collection changed, which moves it up its owner's list.
+func touch(tx *gorm.DB, collection *models.Collection) error {
+	collection.UpdatedAt = time.Now()
+	return tx.Model(collection).UpdateColumn("updated_at", collection.UpdatedAt).Error
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"library-api/email"
+	"library-api/models"
+)
+
+type EmailTemplateRepository struct {
+	DB *gorm.DB
+}
+
+func NewEmailTemplateRepository(db *gorm.DB) *EmailTemplateRepository {
+	return &EmailTemplateRepository{DB: db}
+}
+
+func (r *EmailTemplateRepository) FindAll() ([]models.EmailTemplate, error) {
+	var templates []models.EmailTemplate
+	err := r.DB.Order("name").Find(&templates).Error
+	return templates, err
+}
+
+func (r *EmailTemplateRepository) FindByName(name string) (*models.EmailTemplate, error) {
+	var tmpl models.EmailTemplate
+	err := r.DB.Where("name = ?", name).First(&tmpl).Error
+	return &tmpl, err
+}
+
+// Save inserts the template or replaces the one with the same name.
+func (r *EmailTemplateRepository) Save(tmpl *models.EmailTemplate) error {
+	existing, err := r.FindByName(tmpl.Name)
+	if err == nil {
+		tmpl.ID = existing.ID
+		tmpl.CreatedAt = existing.CreatedAt
+		return r.DB.Save(tmpl).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return r.DB.Create(tmpl).Error
+}
+
+func (r *EmailTemplateRepository) DeleteByName(name string) error {
+	return r.DB.Unscoped().Where("name = ?", name).Delete(&models.EmailTemplate{}).Error
+}
+
+// GetTemplate implements email.TemplateStore.
+func (r *EmailTemplateRepository) GetTemplate(name string) (*email.Template, error) {
+	tmpl, err := r.FindByName(name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, email.ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ToEmailTemplate(tmpl), nil
+}
+
+func ToEmailTemplate(tmpl *models.EmailTemplate) *email.Template {
+	var vars []string
+	for _, v := range strings.Split(tmpl.Variables, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			vars = append(vars, v)
+		}
+	}
+	return &email.Template{Name: tmpl.Name, Subject: tmpl.Subject, HTML: tmpl.HTML, Text: tmpl.Text, Variables: vars}
+}
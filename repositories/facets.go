@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+// Availability values. A book is on loan while it has a loan that hasn't
+// been returned.
+const (
+	AvailabilityAvailable = "available"
+	AvailabilityOnLoan    = "on_loan"
+)
+
+// BookFacets counts the books matching a filter by subject, author,
+// language and availability, most common values first.
+type BookFacets struct {
+	Total        int64        `json:"total"`
+	Subjects     []IDFacet    `json:"subjects"`
+	Authors      []IDFacet    `json:"authors"`
+	Languages    []ValueFacet `json:"languages"`
+	Availability []ValueFacet `json:"availability"`
+}
+
+// IDFacet is a count for an entity, which can be passed back as a filter
+// (?subject=, ?author_id=).
+type IDFacet struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	ParentID *uint  `json:"parent_id,omitempty"` // Subjects only, to nest them
+	Count    int64  `json:"count"`
+}
+
+type ValueFacet struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Facets counts the books matching filter, up to limit values per facet.
+// Subjects count the books linked to them directly; a parent's count
+// doesn't include its children's.
+func (r *BookRepository) Facets(filter BookFilter, limit int) (*BookFacets, error) {
+	matching := func() *gorm.DB {
+		return filter.apply(r.DB.Session(&gorm.Session{NewDB: true}).Model(&models.Book{})).
+			Where("books.deleted_at IS NULL").Select("books.id")
+	}
+	facets := &BookFacets{Subjects: []IDFacet{}, Authors: []IDFacet{}, Languages: []ValueFacet{}, Availability: []ValueFacet{}}
+	if err := filter.apply(r.DB.Model(&models.Book{})).Count(&facets.Total).Error; err != nil {
+		return nil, err
+	}
+	if facets.Total == 0 {
+		return facets, nil
+	}
+	err := r.DB.Table("book_subjects").
+		Select("subjects.id, subjects.name, subjects.parent_id, COUNT(*) AS count").
+		Joins("JOIN subjects ON subjects.id = book_subjects.subject_id AND subjects.deleted_at IS NULL").
+		Where("book_subjects.book_id IN (?)", matching()).
+		Group("subjects.id, subjects.name, subjects.parent_id").
+		Order("count DESC, subjects.name").Limit(limit).Scan(&facets.Subjects).Error
+	if err != nil {
+		return nil, err
+	}
+	err = r.DB.Table("book_authors").
+		Select("authors.id, authors.name, COUNT(DISTINCT book_authors.book_id) AS count").
+		Joins("JOIN authors ON authors.id = book_authors.author_id AND authors.deleted_at IS NULL").
+		Where("book_authors.book_id IN (?)", matching()).
+		Group("authors.id, authors.name").
+		Order("count DESC, authors.name").Limit(limit).Scan(&facets.Authors).Error
+	if err != nil {
+		return nil, err
+	}
+	err = filter.apply(r.DB.Model(&models.Book{})).
+		Select("language AS value, COUNT(*) AS count").
+		Where("language <> ''").
+		Group("language").
+		Order("count DESC, language").Limit(limit).Scan(&facets.Languages).Error
+	if err != nil {
+		return nil, err
+	}
+	var onLoan int64
+	err = r.DB.Model(&models.Loan{}).
+		Where("returned_at IS NULL AND book_id IN (?)", matching()).
+		Distinct("book_id").Count(&onLoan).Error
+	if err != nil {
+		return nil, err
+	}
+	facets.Availability = append(facets.Availability,
+		ValueFacet{Value: AvailabilityAvailable, Count: facets.Total - onLoan},
+		ValueFacet{Value: AvailabilityOnLoan, Count: onLoan})
+	return facets, nil
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"library-api/models"
+)
+
+var (
+	// ErrHoldExists means the member already has an open hold on the work.
+	ErrHoldExists = errors.New("member already has a hold on this work")
+	// ErrHoldClosed means the hold was fulfilled or cancelled before.
+	ErrHoldClosed = errors.New("hold is no longer open")
+)
+
+// HoldRepository keeps the members' holds on works. Holds are filled in
+// the order they were placed.
+type HoldRepository struct {
+	DB *gorm.DB
+}
+
+func NewHoldRepository(db *gorm.DB) *HoldRepository {
+	return &HoldRepository{DB: db}
+}
+
+type HoldFilter struct {
+	WorkID uint
+	UserID uint
+	Status string
+}
+
+// FindAll lists holds in queue order, oldest first.
+func (r *HoldRepository) FindAll(filter HoldFilter, limit, offset int) ([]models.Hold, error) {
+	db := r.DB.Model(&models.Hold{})
+	if filter.WorkID != 0 {
+		db = db.Where("work_id = ?", filter.WorkID)
+	}
+	if filter.UserID != 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	var holds []models.Hold
+	err := db.Order("created_at, id").Limit(limit).Offset(offset).Find(&holds).Error
+	return holds, err
+}
+
+func (r *HoldRepository) FindByID(id uint) (*models.Hold, error) {
+	var hold models.Hold
+	err := r.DB.First(&hold, id).Error
+	return &hold, err
+}
+
+// FindOpen finds the member's waiting or ready hold on the work.
+func (r *HoldRepository) FindOpen(workID, userID uint) (*models.Hold, error) {
+	var hold models.Hold
+	err := r.DB.Where("work_id = ? AND user_id = ? AND status IN ?", workID, userID, []string{models.HoldWaiting, models.HoldReady}).
+		First(&hold).Error
+	return &hold, err
+}
+
+// Create places the hold at the end of the work's queue. The work's row is
+// locked while the member's open holds are checked, so they can't place two
+// at once; a missing work is gorm.ErrRecordNotFound.
+func (r *HoldRepository) Create(hold *models.Hold) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var work models.Work
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&work, hold.WorkID).Error; err != nil {
+			return err
+		}
+		var open int64
+		err := tx.Model(&models.Hold{}).Where("work_id = ? AND user_id = ? AND status IN ?", hold.WorkID, hold.UserID,
+			[]string{models.HoldWaiting, models.HoldReady}).Count(&open).Error
+		if err != nil {
+			return err
+		}
+		if open > 0 {
+			return ErrHoldExists
+		}
+		hold.Status = models.HoldWaiting
+		return tx.Create(hold).Error
+	})
+}
+
+// Cancel cancels the hold. A hold that was fulfilled or cancelled before
+// is ErrHoldClosed.
+func (r *HoldRepository) Cancel(hold *models.Hold) error {
+	result := r.DB.Model(&models.Hold{}).Where("id = ? AND status IN ?", hold.ID, []string{models.HoldWaiting, models.HoldReady}).
+		Update("status", models.HoldCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrHoldClosed
+	}
+	hold.Status = models.HoldCancelled
+	return nil
+}
+
+// Fill sets the book aside for the oldest waiting hold on its work, if the
+// book is an edition of a work and is free: not on loan and not set aside
+// already. It returns the hold it filled, or nil.
+func (r *HoldRepository) Fill(bookID uint, at time.Time) (*models.Hold, error) {
+	var filled *models.Hold
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// Locked like a checkout, so the two can't both take the book
+		var book models.Book
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "work_id").First(&book, bookID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && book.WorkID == nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		free, err := isFree(tx, bookID)
+		if err != nil || !free {
+			return err
+		}
+		var hold models.Hold
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("work_id = ? AND status = ?", *book.WorkID, models.HoldWaiting).
+			Order("created_at, id").First(&hold).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&hold).Updates(map[string]interface{}{"status": models.HoldReady, "book_id": bookID, "ready_at": at}).Error
+		if err != nil {
+			return err
+		}
+		hold.Status, hold.BookID, hold.ReadyAt = models.HoldReady, &bookID, &at
+		filled = &hold
+		return nil
+	})
+	return filled, err
+}
+
+// FillWork fills the work's waiting holds from those of its editions that
+// are free, and returns the holds it filled.
+func (r *HoldRepository) FillWork(workID uint, at time.Time) ([]models.Hold, error) {
+	var bookIDs []uint
+	if err := r.DB.Model(&models.Book{}).Where("work_id = ?", workID).Order("id").Pluck("id", &bookIDs).Error; err != nil {
+		return nil, err
+	}
+	var filled []models.Hold
+	for _, bookID := range bookIDs {
+		hold, err := r.Fill(bookID, at)
+		if err != nil {
+			return filled, err
+		}
+		if hold != nil {
+			filled = append(filled, *hold)
+		}
+	}
+	return filled, nil
+}
+
+// isFree reports whether the book is neither on loan nor set aside for a
+// ready hold.
+func isFree(tx *gorm.DB, bookID uint) (bool, error) {
+	var busy int64
+	if err := tx.Model(&models.Loan{}).Where("book_id = ? AND returned_at IS NULL", bookID).Count(&busy).Error; err != nil || busy > 0 {
+		return false, err
+	}
+	err := tx.Model(&models.Hold{}).Where("book_id = ? AND status = ?", bookID, models.HoldReady).Count(&busy).Error
+	return busy == 0, err
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+type ImportRepository struct {
+	DB *gorm.DB
+}
+
+func NewImportRepository(db *gorm.DB) *ImportRepository {
+	return &ImportRepository{DB: db}
+}
+
+func (r *ImportRepository) Create(job *models.ImportJob) error {
+	return r.DB.Create(job).Error
+}
+
+func (r *ImportRepository) Save(job *models.ImportJob) error {
+	return r.DB.Save(job).Error
+}
+
+func (r *ImportRepository) FindByID(id uint) (*models.ImportJob, error) {
+	var job models.ImportJob
+	err := r.DB.First(&job, id).Error
+	return &job, err
+}
+
+func (r *ImportRepository) FindAll(limit, offset int) ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+	err := r.DB.Order("id DESC").Limit(limit).Offset(offset).Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *ImportRepository) AddErrors(errs []models.ImportRowError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return r.DB.CreateInBatches(errs, 500).Error
+}
+
+func (r *ImportRepository) FindErrors(jobID uint, limit, offset int) ([]models.ImportRowError, error) {
+	var errs []models.ImportRowError
+	err := r.DB.Where("job_id = ?", jobID).Order("line, id").Limit(limit).Offset(offset).Find(&errs).Error
+	return errs, err
+}
+
+// FailStale marks jobs that stopped reporting progress as failed, which
+// happens when the replica running them goes away.
+func (r *ImportRepository) FailStale(before time.Time) (int64, error) {
+	now := time.Now()
+	res := r.DB.Model(&models.ImportJob{}).
+		Where("status = ? AND updated_at < ?", models.ImportRunning, before).
+		Updates(map[string]interface{}{"status": models.ImportFailed, "error": "the import was interrupted", "finished_at": now})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,201 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"library-api/models"
+)
+
+var (
+	// ErrBookOnLoan means the book is already out on an open loan.
+	ErrBookOnLoan = errors.New("book is already on loan")
+	// ErrLoanReturned means the loan was closed before.
+	ErrLoanReturned = errors.New("loan was already returned")
+	// ErrBookOnHold means the book is set aside for another member's hold.
+	ErrBookOnHold = errors.New("book is set aside for a hold")
+	// ErrOpenLoans means a book or user can't be purged while loans of
+	// theirs are still open.
+	ErrOpenLoans = errors.New("record still has open loans")
+)
+
+// LoanRepository keeps the loans circulation records: a loan is opened when
+// a book is checked out and closed when it comes back.
+type LoanRepository struct {
+	DB *gorm.DB
+}
+
+func NewLoanRepository(db *gorm.DB) *LoanRepository {
+	return &LoanRepository{DB: db}
+}
+
+// LoanFilter narrows FindAll; Open true lists loans not yet returned, false
+// returned ones.
+type LoanFilter struct {
+	BookID uint
+	UserID uint
+	Open   *bool
+}
+
+// FindAll lists loans, most recently borrowed first.
+func (r *LoanRepository) FindAll(filter LoanFilter, limit, offset int) ([]models.Loan, error) {
+	db := r.DB.Model(&models.Loan{})
+	if filter.BookID != 0 {
+		db = db.Where("book_id = ?", filter.BookID)
+	}
+	if filter.UserID != 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Open != nil {
+		if *filter.Open {
+			db = db.Where("returned_at IS NULL")
+		} else {
+			db = db.Where("returned_at IS NOT NULL")
+		}
+	}
+	var loans []models.Loan
+	err := db.Order("borrowed_at DESC, id DESC").Limit(limit).Offset(offset).Find(&loans).Error
+	return loans, err
+}
+
+func (r *LoanRepository) FindByID(id uint) (*models.Loan, error) {
+	var loan models.Loan
+	err := r.DB.First(&loan, id).Error
+	return &loan, err
+}
+
+// HasBorrowed reports whether the user has ever borrowed the book, whether
+// or not they returned it.
+func (r *LoanRepository) HasBorrowed(userID, bookID uint) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Loan{}).Where("user_id = ? AND book_id = ?", userID, bookID).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+// Create opens the loan. The book's row is locked while its open loans and
+// holds are checked, so two checkouts of the same book can't both succeed; a
+// book already out is ErrBookOnLoan, one set aside for another member's hold
+// ErrBookOnHold, and a missing or deleted one gorm.ErrRecordNotFound. The
+// member's hold on the book's work, if any, is fulfilled by the loan.
+func (r *LoanRepository) Create(loan *models.Loan, events ...EventFunc) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var book models.Book
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "work_id").First(&book, loan.BookID).Error; err != nil {
+			return err
+		}
+		var open int64
+		if err := tx.Model(&models.Loan{}).Where("book_id = ? AND returned_at IS NULL", loan.BookID).Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return ErrBookOnLoan
+		}
+		var ready models.Hold
+		if err := tx.Where("book_id = ? AND status = ?", loan.BookID, models.HoldReady).Limit(1).Find(&ready).Error; err != nil {
+			return err
+		}
+		if ready.ID != 0 && ready.UserID != loan.UserID {
+			return ErrBookOnHold
+		}
+		if err := fulfillHold(tx, &book, loan.UserID); err != nil {
+			return err
+		}
+		return withEvents(tx, events, func(tx *gorm.DB) error {
+			return tx.Create(loan).Error
+		})
+	})
+}
+
+// fulfillHold marks the member's open hold on the book's work fulfilled by
+// the book, whether it was ready with this book, ready with another
+// edition, which is freed, or still waiting.
+func fulfillHold(tx *gorm.DB, book *models.Book, userID uint) error {
+	if book.WorkID == nil {
+		return nil
+	}
+	return tx.Model(&models.Hold{}).
+		Where("work_id = ? AND user_id = ? AND status IN ?", *book.WorkID, userID, []string{models.HoldWaiting, models.HoldReady}).
+		Updates(map[string]interface{}{"status": models.HoldFulfilled, "book_id": book.ID}).Error
+}
+
+// FindDueSoon lists open loans due between now and until that no reminder
+// has been sent for, soonest due first.
+func (r *LoanRepository) FindDueSoon(now, until time.Time, limit int) ([]models.Loan, error) {
+	var loans []models.Loan
+	err := r.DB.Where("returned_at IS NULL AND reminded_at IS NULL AND due_at >= ? AND due_at < ?", now, until).
+		Order("due_at, id").Limit(limit).Find(&loans).Error
+	return loans, err
+}
+
+// MarkReminded records that the member was reminded of the loan at at. It
+// reports false when the loan was returned or another replica reminded
+// them first.
+func (r *LoanRepository) MarkReminded(loan *models.Loan, at time.Time) (bool, error) {
+	result := r.DB.Model(&models.Loan{}).Where("id = ? AND returned_at IS NULL AND reminded_at IS NULL", loan.ID).Update("reminded_at", at)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	loan.RemindedAt = &at
+	return true, nil
+}
+
+// FindOverdue lists open loans past their due date that loan.overdue hasn't
+// been recorded for, longest overdue first.
+func (r *LoanRepository) FindOverdue(now time.Time, limit int) ([]models.Loan, error) {
+	var loans []models.Loan
+	err := r.DB.Where("returned_at IS NULL AND overdue_at IS NULL AND due_at < ?", now).
+		Order("due_at, id").Limit(limit).Find(&loans).Error
+	return loans, err
+}
+
+// MarkOverdue records that the loan went overdue at at. It reports false,
+// writing nothing, when the loan was returned or marked in the meantime,
+// such as by another replica.
+func (r *LoanRepository) MarkOverdue(loan *models.Loan, at time.Time, events ...EventFunc) (bool, error) {
+	marked := false
+	err := withEvents(r.DB, events, func(tx *gorm.DB) error {
+		result := tx.Model(&models.Loan{}).Where("id = ? AND returned_at IS NULL AND overdue_at IS NULL", loan.ID).Update("overdue_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNotMarked
+		}
+		marked = true
+		loan.OverdueAt = &at
+		return nil
+	})
+	if errors.Is(err, errNotMarked) {
+		return false, nil
+	}
+	return marked, err
+}
+
+// errNotMarked rolls back the events of a loan that wasn't marked.
+var errNotMarked = errors.New("loan not marked")
+
+// Return closes the loan as of at and sets loan.ReturnedAt. A loan closed
+// before is ErrLoanReturned.
+func (r *LoanRepository) Return(loan *models.Loan, at time.Time, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		result := tx.Model(&models.Loan{}).Where("id = ? AND returned_at IS NULL", loan.ID).Update("returned_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrLoanReturned
+		}
+		loan.ReturnedAt = &at
+		return nil
+	})
+}
+
+// hasOpenLoans reports whether a loan whose column (book_id or user_id) is
+// id is still open.
+func hasOpenLoans(tx *gorm.DB, column string, id uint) (bool, error) {
+	var open int64
+	err := tx.Model(&models.Loan{}).Where(column+" = ? AND returned_at IS NULL", id).Count(&open).Error
+	return open > 0, err
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+// EventFunc builds an outbox event once the row it describes has been
+// written, so the event can carry generated IDs.
+type EventFunc func() (*models.OutboxEvent, error)
+
+// withEvents runs write and appends the events in one transaction: either
+// the change and its events are committed, or neither is.
+func withEvents(db *gorm.DB, events []EventFunc, write func(tx *gorm.DB) error) error {
+	if len(events) == 0 {
+		return write(db)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := write(tx); err != nil {
+			return err
+		}
+		for _, build := range events {
+			event, err := build()
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(event).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// OutboxRepository is the events.Store backed by the outbox_events table.
+type OutboxRepository struct {
+	DB *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{DB: db}
+}
+
+func (r *OutboxRepository) FindDue(now time.Time, limit int) ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	err := r.DB.Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, now).
+		Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// Claim pushes a due event's next attempt to until and reports whether this
+// caller won. If the winner dies mid-way the event becomes due again at until.
+func (r *OutboxRepository) Claim(event *models.OutboxEvent, until time.Time) (bool, error) {
+	res := r.DB.Model(&models.OutboxEvent{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", event.ID, models.OutboxPending, event.NextAttemptAt).
+		Update("next_attempt_at", until)
+	if res.RowsAffected == 1 {
+		event.NextAttemptAt = until
+	}
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *OutboxRepository) Save(event *models.OutboxEvent) error {
+	return r.DB.Save(event).Error
+}
+
+func (r *OutboxRepository) DeleteProcessedBefore(t time.Time) error {
+	return r.DB.Where("status = ? AND processed_at < ?", models.OutboxProcessed, t).Delete(&models.OutboxEvent{}).Error
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"library-api/models"
+)
+
+type PublisherRepository struct {
+	DB *gorm.DB
+}
+
+func NewPublisherRepository(db *gorm.DB) *PublisherRepository {
+	return &PublisherRepository{DB: db}
+}
+
+func (r *PublisherRepository) FindByID(id uint) (*models.Publisher, error) {
+	var publisher models.Publisher
+	err := r.DB.First(&publisher, id).Error
+	return &publisher, err
+}
+
+func (r *PublisherRepository) FindAll(query string, limit, offset int) ([]models.Publisher, error) {
+	db := r.DB
+	if query != "" {
+		db = db.Where("name LIKE ?", "%"+escapeLike(query)+"%")
+	}
+	var publishers []models.Publisher
+	err := db.Order("name").Limit(limit).Offset(offset).Find(&publishers).Error
+	return publishers, err
+}
+
+// FindOrCreate returns the publisher with this name, creating it if needed.
+// Names are unique, so a concurrent create is resolved by reading again. It
+// can run in a transaction, through a repository made with that tx.
+func (r *PublisherRepository) FindOrCreate(name string) (*models.Publisher, error) {
+	var publisher models.Publisher
+	err := r.DB.Where("name = ?", name).First(&publisher).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &publisher, err
+	}
+	publisher = models.Publisher{Name: name}
+	err = r.DB.Create(&publisher).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// A locking read sees the other create even inside a transaction
+		publisher = models.Publisher{}
+		err = r.DB.Clauses(clause.Locking{Strength: "SHARE"}).Where("name = ?", name).First(&publisher).Error
+	}
+	return &publisher, err
+}
+
+// LinkBooks sets the publisher of books that only have a publisher name,
+// creating the publishers that don't exist yet.
+func (r *PublisherRepository) LinkBooks() error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT IGNORE INTO publishers (name, created_at, updated_at)
+			SELECT DISTINCT publisher, NOW(), NOW() FROM books
+			WHERE publisher <> '' AND publisher_id IS NULL`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE books JOIN publishers ON publishers.name = books.publisher
+			SET books.publisher_id = publishers.id
+			WHERE books.publisher_id IS NULL AND books.publisher <> '' AND publishers.deleted_at IS NULL`).Error
+	})
+}
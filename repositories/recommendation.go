@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"library-api/models"
+	"library-api/recommend"
+)
+
+// RecommendationRepository reads the signals recommendations are built
+// from. A member's reading history is the books they borrowed, from the
+// loans circulation records.
+type RecommendationRepository struct {
+	DB *gorm.DB
+}
+
+func NewRecommendationRepository(db *gorm.DB) *RecommendationRepository {
+	return &RecommendationRepository{DB: db}
+}
+
+// Histories reads every member's most recently borrowed books, at most
+// perUser each, skipping deleted books. A book borrowed again shows up
+// more than once; recommend.Similar counts it once.
+func (r *RecommendationRepository) Histories(perUser int) (map[uint][]uint, error) {
+	rows, err := r.DB.Model(&models.Loan{}).Select("loans.user_id, loans.book_id").
+		Joins("JOIN books ON books.id = loans.book_id AND books.deleted_at IS NULL").
+		Order("loans.user_id, loans.borrowed_at DESC").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	histories := map[uint][]uint{}
+	for rows.Next() {
+		var userID, bookID uint
+		if err := rows.Scan(&userID, &bookID); err != nil {
+			return nil, err
+		}
+		if len(histories[userID]) < perUser {
+			histories[userID] = append(histories[userID], bookID)
+		}
+	}
+	return histories, rows.Err()
+}
+
+// ReadBy lists the books the member borrowed, most recent first and each
+// once, deleted ones included so they aren't recommended back once
+// restored.
+func (r *RecommendationRepository) ReadBy(userID uint, limit int) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Model(&models.Loan{}).Where("user_id = ?", userID).Group("book_id").
+		Order("MAX(borrowed_at) DESC").Limit(limit).Pluck("book_id", &ids).Error
+	return ids, err
+}
+
+// Related finds books sharing authors or subjects with the seed books,
+// the seeds themselves left out. A shared author counts twice as much as
+// a shared subject.
+func (r *RecommendationRepository) Related(seeds []uint, limit int) ([]recommend.Scored, error) {
+	var related []recommend.Scored
+	err := r.DB.Raw(`SELECT related.book_id, SUM(related.weight) AS score FROM (
+			SELECT DISTINCT seed.book_id AS seed_id, other.book_id, seed.author_id AS link_id, 2 AS weight
+			FROM book_authors seed JOIN book_authors other ON other.author_id = seed.author_id
+			WHERE seed.book_id IN ?
+			UNION ALL
+			SELECT seed.book_id, other.book_id, seed.subject_id, 1
+			FROM book_subjects seed JOIN book_subjects other ON other.subject_id = seed.subject_id
+			JOIN subjects ON subjects.id = seed.subject_id AND subjects.deleted_at IS NULL
+			WHERE seed.book_id IN ?
+		) related
+		JOIN books ON books.id = related.book_id AND books.deleted_at IS NULL
+		WHERE related.book_id NOT IN ?
+		GROUP BY related.book_id
+		ORDER BY score DESC, related.book_id
+		LIMIT ?`, seeds, seeds, seeds, limit).Scan(&related).Error
+	return related, err
+}
+
+// Popular lists the most reviewed books, best rated first among equals,
+// leaving out those in exclude.
+func (r *RecommendationRepository) Popular(exclude []uint, limit int) ([]recommend.Scored, error) {
+	db := r.DB.Model(&models.Book{}).Select("id AS book_id, rating_count AS score").Where("rating_count > 0")
+	if len(exclude) > 0 {
+		db = db.Where("id NOT IN ?", exclude)
+	}
+	var popular []recommend.Scored
+	err := db.Order("rating_count DESC, rating_average DESC, id").Limit(limit).Scan(&popular).Error
+	return popular, err
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+type ReviewRepository struct {
+	DB *gorm.DB
+}
+
+func NewReviewRepository(db *gorm.DB) *ReviewRepository {
+	return &ReviewRepository{DB: db}
+}
+
+// ReviewFilter narrows review listings. Empty fields don't filter.
+type ReviewFilter struct {
+	BookID uint
+	UserID uint
+	Hidden *bool
+}
+
+// withUsername reads reviews with their author's username.
+func withUsername(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Review{}).Select("reviews.*, users.username").
+		Joins("LEFT JOIN users ON users.id = reviews.user_id")
+}
+
+// FindAll lists reviews, newest first.
+func (r *ReviewRepository) FindAll(filter ReviewFilter, limit, offset int) ([]models.Review, error) {
+	db := withUsername(r.DB)
+	if filter.BookID != 0 {
+		db = db.Where("reviews.book_id = ?", filter.BookID)
+	}
+	if filter.UserID != 0 {
+		db = db.Where("reviews.user_id = ?", filter.UserID)
+	}
+	if filter.Hidden != nil {
+		db = db.Where("reviews.hidden = ?", *filter.Hidden)
+	}
+	var reviews []models.Review
+	err := db.Order("reviews.created_at DESC, reviews.id DESC").Limit(limit).Offset(offset).Find(&reviews).Error
+	return reviews, err
+}
+
+func (r *ReviewRepository) FindByID(id uint) (*models.Review, error) {
+	var review models.Review
+	err := withUsername(r.DB).Where("reviews.id = ?", id).Take(&review).Error
+	return &review, err
+}
+
+// FindByBookAndUser finds the member's review of the book.
+func (r *ReviewRepository) FindByBookAndUser(bookID, userID uint) (*models.Review, error) {
+	var review models.Review
+	err := withUsername(r.DB).Where("reviews.book_id = ? AND reviews.user_id = ?", bookID, userID).Take(&review).Error
+	return &review, err
+}
+
+// Create, Update, SetHidden and Delete refresh the book's rating in the
+// same transaction, so it never disagrees with the reviews.
+
+func (r *ReviewRepository) Create(review *models.Review, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+		return refreshRating(tx, review.BookID)
+	})
+}
+
+// Update saves the rating and text.
+func (r *ReviewRepository) Update(review *models.Review, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		if err := tx.Model(review).Select("rating", "text", "updated_at").Updates(review).Error; err != nil {
+			return err
+		}
+		return refreshRating(tx, review.BookID)
+	})
+}
+
+// SetHidden saves whether the review is hidden, and by whom and why.
+func (r *ReviewRepository) SetHidden(review *models.Review, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		err := tx.Model(review).Select("hidden", "hidden_reason", "hidden_by", "hidden_at").Updates(review).Error
+		if err != nil {
+			return err
+		}
+		return refreshRating(tx, review.BookID)
+	})
+}
+
+func (r *ReviewRepository) Delete(review *models.Review, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		if err := tx.Delete(review).Error; err != nil {
+			return err
+		}
+		return refreshRating(tx, review.BookID)
+	})
+}
+
+// refreshRating recomputes the book's rating from its visible reviews. The
+// rating isn't something editors change, so neither the version nor
+// updated_at move: a review never makes an edit fail with 412.
+func refreshRating(tx *gorm.DB, bookID uint) error {
+	visible := tx.Session(&gorm.Session{NewDB: true}).Model(&models.Review{}).
+		Where("book_id = ? AND hidden = ?", bookID, false)
+	return tx.Unscoped().Model(&models.Book{}).Where("id = ?", bookID).UpdateColumns(map[string]interface{}{
+		"rating_average": visible.Session(&gorm.Session{}).Select("COALESCE(ROUND(AVG(rating), 2), 0)"),
+		"rating_count":   visible.Session(&gorm.Session{}).Select("COUNT(*)"),
+	}).Error
+}
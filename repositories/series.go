@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+type SeriesRepository struct {
+	DB *gorm.DB
+}
+
+func NewSeriesRepository(db *gorm.DB) *SeriesRepository {
+	return &SeriesRepository{DB: db}
+}
+
+func (r *SeriesRepository) Create(series *models.Series) error {
+	return r.DB.Create(series).Error
+}
+
+func (r *SeriesRepository) Update(series *models.Series, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		return tx.Save(series).Error
+	})
+}
+
+func (r *SeriesRepository) FindByID(id uint) (*models.Series, error) {
+	var series models.Series
+	err := r.DB.First(&series, id).Error
+	return &series, err
+}
+
+func (r *SeriesRepository) FindAll(query string, limit, offset int) ([]models.Series, error) {
+	db := r.DB
+	if query != "" {
+		db = db.Where("title LIKE ?", "%"+escapeLike(query)+"%")
+	}
+	var series []models.Series
+	err := db.Order("title, id").Limit(limit).Offset(offset).Find(&series).Error
+	return series, err
+}
+
+// FindBooks returns the series' books in volume order; books without a
+// number come last.
+func (r *SeriesRepository) FindBooks(id uint, limit int) ([]models.Book, error) {
+	var books []models.Book
+	err := withContributors(r.DB).Where("series_id = ?", id).
+		Order("series_number IS NULL, series_number, id").Limit(limit).Find(&books).Error
+	return books, err
+}
+
+// Delete deletes the series; its books stay, outside any series.
+func (r *SeriesRepository) Delete(series *models.Series, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.Book{}).Where("series_id = ?", series.ID).UpdateColumns(map[string]interface{}{
+			"series_id":     nil,
+			"series_number": nil,
+			"version":       gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(series).Error
+	})
+}
@@ -0,0 +1,288 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"library-api/models"
+)
+
+// TaxonomyRepository stores subject trees and tags. Books keep the names
+// of their subjects and tags too, and renames and deletes here update them.
+type TaxonomyRepository struct {
+	DB *gorm.DB
+}
+
+func NewTaxonomyRepository(db *gorm.DB) *TaxonomyRepository {
+	return &TaxonomyRepository{DB: db}
+}
+
+// SubjectFilter narrows subject listings. Empty fields don't filter.
+type SubjectFilter struct {
+	Kind     string
+	ParentID *uint // 0 for top-level subjects only
+	Query    string
+}
+
+func (r *TaxonomyRepository) FindSubjects(filter SubjectFilter, limit, offset int) ([]models.Subject, error) {
+	db := r.DB
+	if filter.Kind != "" {
+		db = db.Where("kind = ?", filter.Kind)
+	}
+	switch {
+	case filter.ParentID == nil:
+	case *filter.ParentID == 0:
+		db = db.Where("parent_id IS NULL")
+	default:
+		db = db.Where("parent_id = ?", *filter.ParentID)
+	}
+	if filter.Query != "" {
+		db = db.Where("name LIKE ?", "%"+escapeLike(filter.Query)+"%")
+	}
+	var subjects []models.Subject
+	err := db.Order("path").Limit(limit).Offset(offset).Find(&subjects).Error
+	return subjects, err
+}
+
+func (r *TaxonomyRepository) FindSubject(id uint) (*models.Subject, error) {
+	var subject models.Subject
+	err := r.DB.First(&subject, id).Error
+	return &subject, err
+}
+
+func (r *TaxonomyRepository) CountChildren(id uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.Subject{}).Where("parent_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// CreateSubject stores subject under its parent, which must have been
+// loaded into parent (nil for a top-level subject).
+func (r *TaxonomyRepository) CreateSubject(subject *models.Subject, parent *models.Subject) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(subject).Error; err != nil {
+			return err
+		}
+		subject.Path = subjectPath(parent, subject.ID)
+		return tx.Model(subject).Update("path", subject.Path).Error
+	})
+}
+
+// FindOrCreateSubject returns the oldest subject with this name, of any
+// kind and anywhere in the trees, or creates a top-level subject.
+func (r *TaxonomyRepository) FindOrCreateSubject(name string) (*models.Subject, error) {
+	var subject models.Subject
+	err := r.DB.Where("name = ?", name).Order("id").First(&subject).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		subject = models.Subject{Name: name, Kind: models.SubjectKindSubject}
+		err = r.CreateSubject(&subject, nil)
+	}
+	return &subject, err
+}
+
+// UpdateSubject saves a new name, kind and parent. Moving a subject moves
+// its subtree, and the subtree takes the subject's kind.
+func (r *TaxonomyRepository) UpdateSubject(subject *models.Subject, oldName string, parent *models.Subject, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		oldPath := subject.Path
+		subject.Path = subjectPath(parent, subject.ID)
+		if err := tx.Select("name", "kind", "parent_id", "path").Save(subject).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.Subject{}).Where("path LIKE ? AND id <> ?", escapeLike(oldPath)+"%", subject.ID).
+			UpdateColumns(map[string]interface{}{
+				"path": gorm.Expr("CONCAT(?, SUBSTRING(path, ?))", subject.Path, len(oldPath)+1),
+				"kind": subject.Kind,
+			}).Error
+		if err != nil {
+			return err
+		}
+		if subject.Name == oldName {
+			return nil
+		}
+		bookIDs, err := linkedBooks(tx, "book_subjects", "subject_id", subject.ID)
+		if err != nil {
+			return err
+		}
+		return replaceBookNames(tx, "subjects", bookIDs, oldName, subject.Name)
+	})
+}
+
+// DeleteSubject deletes a subject without children and takes it off books.
+func (r *TaxonomyRepository) DeleteSubject(subject *models.Subject, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		bookIDs, err := linkedBooks(tx, "book_subjects", "subject_id", subject.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("subject_id = ?", subject.ID).Delete(&models.BookSubject{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(subject).Error; err != nil {
+			return err
+		}
+		return replaceBookNames(tx, "subjects", bookIDs, subject.Name, "")
+	})
+}
+
+func subjectPath(parent *models.Subject, id uint) string {
+	prefix := "/"
+	if parent != nil {
+		prefix = parent.Path
+	}
+	return fmt.Sprintf("%s%d/", prefix, id)
+}
+
+// NormalizeTag is how tag names are stored and matched: trimmed, lower
+// case, with runs of spaces collapsed.
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func (r *TaxonomyRepository) FindTags(query string, limit, offset int) ([]models.Tag, error) {
+	db := r.DB
+	if query != "" {
+		db = db.Where("name LIKE ?", "%"+escapeLike(NormalizeTag(query))+"%")
+	}
+	var tags []models.Tag
+	err := db.Order("name").Limit(limit).Offset(offset).Find(&tags).Error
+	return tags, err
+}
+
+func (r *TaxonomyRepository) FindTag(id uint) (*models.Tag, error) {
+	var tag models.Tag
+	err := r.DB.First(&tag, id).Error
+	return &tag, err
+}
+
+func (r *TaxonomyRepository) CreateTag(tag *models.Tag) error {
+	return r.DB.Create(tag).Error
+}
+
+// FindOrCreateTag returns the tag with this (normalized) name, creating it
+// if needed. Names are unique, so a concurrent create is resolved by
+// reading again.
+func (r *TaxonomyRepository) FindOrCreateTag(name string) (*models.Tag, error) {
+	var tag models.Tag
+	err := r.DB.Where("name = ?", name).First(&tag).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &tag, err
+	}
+	tag = models.Tag{Name: name}
+	err = r.DB.Create(&tag).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// A locking read sees the other create even inside a transaction
+		tag = models.Tag{}
+		err = r.DB.Clauses(clause.Locking{Strength: "SHARE"}).Where("name = ?", name).First(&tag).Error
+	}
+	return &tag, err
+}
+
+// RenameTag renames the tag on books too. A name another tag has fails
+// with gorm.ErrDuplicatedKey.
+func (r *TaxonomyRepository) RenameTag(tag *models.Tag, name string, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		oldName := tag.Name
+		if err := tx.Model(tag).Update("name", name).Error; err != nil {
+			return err
+		}
+		tag.Name = name
+		bookIDs, err := linkedBooks(tx, "book_tags", "tag_id", tag.ID)
+		if err != nil {
+			return err
+		}
+		return replaceBookNames(tx, "tags", bookIDs, oldName, name)
+	})
+}
+
+// DeleteTag deletes the tag and takes it off books.
+func (r *TaxonomyRepository) DeleteTag(tag *models.Tag, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		bookIDs, err := linkedBooks(tx, "book_tags", "tag_id", tag.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.BookTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(tag).Error; err != nil {
+			return err
+		}
+		return replaceBookNames(tx, "tags", bookIDs, tag.Name, "")
+	})
+}
+
+// FindUnlinkedSubjects returns books after afterID that list subjects but
+// aren't linked to any: books enriched before subjects were tracked.
+func (r *TaxonomyRepository) FindUnlinkedSubjects(afterID uint, limit int) ([]models.Book, error) {
+	var books []models.Book
+	err := r.DB.Select("id", "subjects").
+		Where("id > ? AND subjects IS NOT NULL AND subjects NOT IN ('', 'null', '[]')", afterID).
+		Where("NOT EXISTS (SELECT 1 FROM book_subjects WHERE book_subjects.book_id = books.id)").
+		Order("id").Limit(limit).Find(&books).Error
+	return books, err
+}
+
+// AddSubjectLinks links books to subjects, skipping links that exist.
+func (r *TaxonomyRepository) AddSubjectLinks(links []models.BookSubject) error {
+	if len(links) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error
+}
+
+func linkedBooks(tx *gorm.DB, table, column string, id uint) ([]uint, error) {
+	var bookIDs []uint
+	err := tx.Table(table).Where(column+" = ?", id).Pluck("book_id", &bookIDs).Error
+	return bookIDs, err
+}
+
+// replaceBookNames renames oldName to newName in the subjects or tags
+// column of each book, or removes it if newName is empty, and bumps the
+// books' versions.
+func replaceBookNames(tx *gorm.DB, column string, bookIDs []uint, oldName, newName string) error {
+	for _, id := range bookIDs {
+		var book models.Book
+		if err := tx.Unscoped().Select("id", column).First(&book, id).Error; err != nil {
+			return err
+		}
+		names := book.Subjects
+		if column == "tags" {
+			names = book.Tags
+		}
+		var kept []string
+		for _, name := range names {
+			if strings.EqualFold(name, oldName) {
+				name = newName
+			}
+			if name != "" && !containsFold(kept, name) {
+				kept = append(kept, name)
+			}
+		}
+		value, err := json.Marshal(kept)
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&models.Book{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+			column:    string(value),
+			"version": gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,9 @@
 package repositories
 
 import (
+    "time"
     "gorm.io/gorm"
+    "gorm.io/gorm/clause"
     "library-api/models"
 )
 
@@ -13,12 +15,163 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
     return &UserRepository{DB: db}
 }
 
-func (r *UserRepository) Create(user *models.User) error {
-    return r.DB.Create(user).Error
+// Create writes the given outbox events in the same transaction.
+func (r *UserRepository) Create(user *models.User, events ...EventFunc) error {
+    return withEvents(r.DB, events, func(tx *gorm.DB) error {
+        return tx.Create(user).Error
+    })
 }
 
 func (r *UserRepository) FindByUsername(username string) (*models.User, error) {
     var user models.User
     err := r.DB.Where("username = ?", username).First(&user).Error
     return &user, err
-}
\ No newline at end of file
+}
+
+func (r *UserRepository) FindByID(id uint) (*models.User, error) {
+    var user models.User
+    err := r.DB.First(&user, id).Error
+    return &user, err
+}
+
+// Exists reports whether the user exists and isn't deleted.
+func (r *UserRepository) Exists(id uint) (bool, error) {
+    var count int64
+    err := r.DB.Model(&models.User{}).Where("id = ?", id).Limit(1).Count(&count).Error
+    return count > 0, err
+}
+
+// Delete soft-deletes the user. The username stays taken until the user is
+// purged.
+func (r *UserRepository) Delete(id uint) error {
+    res := r.DB.Delete(&models.User{}, id)
+    if res.Error == nil && res.RowsAffected == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return res.Error
+}
+
+// FindDeleted finds a user that has been deleted.
+func (r *UserRepository) FindDeleted(id uint) (*models.User, error) {
+    var user models.User
+    err := r.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&user, id).Error
+    return &user, err
+}
+
+// FindAllDeleted lists deleted users, most recently deleted first.
+func (r *UserRepository) FindAllDeleted(limit, offset int) ([]models.User, error) {
+    var users []models.User
+    err := r.DB.Unscoped().Where("deleted_at IS NOT NULL").
+        Order("deleted_at DESC, id DESC").Limit(limit).Offset(offset).Find(&users).Error
+    return users, err
+}
+
+// FindDeletedBefore lists up to limit users deleted before t, oldest first,
+// leaving out those with books still out, who can't be purged yet.
+func (r *UserRepository) FindDeletedBefore(t time.Time, limit int) ([]models.User, error) {
+    var users []models.User
+    err := r.DB.Unscoped().Where("deleted_at < ?", t).
+        Where("NOT EXISTS (SELECT 1 FROM loans WHERE loans.user_id = users.id AND loans.returned_at IS NULL)").
+        Order("deleted_at, id").Limit(limit).Find(&users).Error
+    return users, err
+}
+
+// Restore undeletes the user and reloads it. gorm.ErrRecordNotFound means
+// it isn't deleted.
+func (r *UserRepository) Restore(user *models.User) error {
+    return r.DB.Transaction(func(tx *gorm.DB) error {
+        res := tx.Unscoped().Model(&models.User{}).Where("id = ? AND deleted_at IS NOT NULL", user.ID).Update("deleted_at", nil)
+        if res.Error != nil {
+            return res.Error
+        }
+        if res.RowsAffected == 0 {
+            return gorm.ErrRecordNotFound
+        }
+        return tx.First(user, user.ID).Error
+    })
+}
+
+// Purge deletes a deleted user for good, with their collections, reviews,
+// holds and loan history; the ratings of the books they reviewed are
+// recomputed. A user with books still out is ErrOpenLoans;
+// gorm.ErrRecordNotFound means the user isn't deleted, or is already gone.
+func (r *UserRepository) Purge(id uint, events ...EventFunc) error {
+    return withEvents(r.DB, events, func(tx *gorm.DB) error {
+        var user models.User
+        err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+            Where("deleted_at IS NOT NULL").First(&user, id).Error
+        if err != nil {
+            return err
+        }
+        open, err := hasOpenLoans(tx, "user_id", id)
+        if err != nil {
+            return err
+        }
+        if open {
+            return ErrOpenLoans
+        }
+        for _, dependent := range []interface{}{&models.Hold{}, &models.Loan{}} {
+            if err := tx.Where("user_id = ?", id).Delete(dependent).Error; err != nil {
+                return err
+            }
+        }
+        collections := tx.Unscoped().Model(&models.Collection{}).Select("id").Where("owner_id = ?", id)
+        if err := tx.Where("collection_id IN (?)", collections).Delete(&models.CollectionItem{}).Error; err != nil {
+            return err
+        }
+        if err := tx.Unscoped().Where("owner_id = ?", id).Delete(&models.Collection{}).Error; err != nil {
+            return err
+        }
+        var reviewed []uint
+        if err := tx.Model(&models.Review{}).Where("user_id = ?", id).Pluck("book_id", &reviewed).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("user_id = ?", id).Delete(&models.Review{}).Error; err != nil {
+            return err
+        }
+        for _, bookID := range reviewed {
+            if err := refreshRating(tx, bookID); err != nil {
+                return err
+            }
+        }
+        return tx.Unscoped().Delete(&user).Error
+    })
+}
+
+func (r *UserRepository) TouchLastLogin(id uint, at time.Time) error {
+    return r.DB.Model(&models.User{}).Where("id = ?", id).Update("last_login_at", at).Error
+}
+
+func (r *UserRepository) audienceQuery(audience models.CampaignAudience) *gorm.DB {
+    q := r.DB.Model(&models.User{}).Where("email <> ''")
+    if audience.Role != "" {
+        q = q.Where("role = ?", audience.Role)
+    }
+    if audience.Verified != nil {
+        q = q.Where("email_verified = ?", *audience.Verified)
+    }
+    if audience.HasActiveLoans != nil {
+        active := "EXISTS (SELECT 1 FROM loans WHERE loans.user_id = users.id AND loans.returned_at IS NULL)"
+        if !*audience.HasActiveLoans {
+            active = "NOT " + active
+        }
+        q = q.Where(active)
+    }
+    if audience.InactiveSince != nil {
+        q = q.Where("last_login_at IS NULL OR last_login_at < ?", *audience.InactiveSince)
+    }
+    return q
+}
+
+// FindEmailsByAudience returns the distinct addresses of users matching the audience.
+func (r *UserRepository) FindEmailsByAudience(audience models.CampaignAudience) ([]string, error) {
+    var emails []string
+    err := r.audienceQuery(audience).Distinct().Pluck("email", &emails).Error
+    return emails, err
+}
+
+func (r *UserRepository) CountByAudience(audience models.CampaignAudience) (int64, error) {
+    var count int64
+    err := r.audienceQuery(audience).Distinct("email").Count(&count).Error
+    return count, err
+}
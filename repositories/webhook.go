@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+type WebhookRepository struct {
+	DB *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{DB: db}
+}
+
+func (r *WebhookRepository) Create(hook *models.Webhook) error {
+	return r.DB.Create(hook).Error
+}
+
+func (r *WebhookRepository) Update(hook *models.Webhook) error {
+	return r.DB.Save(hook).Error
+}
+
+func (r *WebhookRepository) Delete(id uint) error {
+	return r.DB.Delete(&models.Webhook{}, id).Error
+}
+
+func (r *WebhookRepository) FindAll() ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	err := r.DB.Order("id").Find(&hooks).Error
+	return hooks, err
+}
+
+func (r *WebhookRepository) FindActive() ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	err := r.DB.Where("active = ?", true).Find(&hooks).Error
+	return hooks, err
+}
+
+func (r *WebhookRepository) FindByID(id uint) (*models.Webhook, error) {
+	var hook models.Webhook
+	err := r.DB.First(&hook, id).Error
+	return &hook, err
+}
+
+func (r *WebhookRepository) CreateDeliveries(deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.DB.Create(&deliveries).Error
+}
+
+func (r *WebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	return r.DB.Save(delivery).Error
+}
+
+func (r *WebhookRepository) FindDeliveries(webhookID uint, limit, offset int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.DB.Where("webhook_id = ?", webhookID).Order("id DESC").Limit(limit).Offset(offset).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *WebhookRepository) FindDelivery(webhookID, id uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.DB.Where("webhook_id = ?", webhookID).First(&delivery, id).Error
+	return &delivery, err
+}
+
+// FindDue returns pending deliveries whose next attempt is due, oldest first.
+func (r *WebhookRepository) FindDue(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ClaimDelivery pushes a due delivery's next attempt to until and reports
+// whether this caller won. Only the winner sends it; if it dies mid-send the
+// delivery becomes due again at until.
+func (r *WebhookRepository) ClaimDelivery(delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	res := r.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, models.DeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", until)
+	if res.RowsAffected == 1 {
+		delivery.NextAttemptAt = until
+	}
+	return res.RowsAffected == 1, res.Error
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"library-api/models"
+)
+
+type WorkRepository struct {
+	DB *gorm.DB
+}
+
+func NewWorkRepository(db *gorm.DB) *WorkRepository {
+	return &WorkRepository{DB: db}
+}
+
+func (r *WorkRepository) Create(work *models.Work) error {
+	return r.DB.Create(work).Error
+}
+
+func (r *WorkRepository) Update(work *models.Work, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		return tx.Save(work).Error
+	})
+}
+
+func (r *WorkRepository) FindByID(id uint) (*models.Work, error) {
+	var work models.Work
+	err := r.DB.First(&work, id).Error
+	return &work, err
+}
+
+// FindAll lists works by title; query, if set, matches part of the title.
+func (r *WorkRepository) FindAll(query string, limit, offset int) ([]models.Work, error) {
+	db := r.DB
+	if query != "" {
+		db = db.Where("title LIKE ?", "%"+escapeLike(query)+"%")
+	}
+	var works []models.Work
+	err := db.Order("title, id").Limit(limit).Offset(offset).Find(&works).Error
+	return works, err
+}
+
+func (r *WorkRepository) CountEditions(id uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.Book{}).Where("work_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// AddEditions makes the books editions of the work, moving them from any
+// work they were in.
+func (r *WorkRepository) AddEditions(id uint, bookIDs []uint, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		return setBooksColumn(tx, "id IN ?", bookIDs, "work_id", id)
+	})
+}
+
+// Delete deletes the work; its editions stay, without a work, and its
+// open holds are cancelled.
+func (r *WorkRepository) Delete(work *models.Work, events ...EventFunc) error {
+	return withEvents(r.DB, events, func(tx *gorm.DB) error {
+		if err := setBooksColumn(tx, "work_id = ?", work.ID, "work_id", nil); err != nil {
+			return err
+		}
+		err := tx.Model(&models.Hold{}).Where("work_id = ? AND status IN ?", work.ID, []string{models.HoldWaiting, models.HoldReady}).
+			Update("status", models.HoldCancelled).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(work).Error
+	})
+}
+
+// setBooksColumn sets column on the books matching the condition, deleted
+// ones included, and bumps their versions.
+func setBooksColumn(tx *gorm.DB, condition string, arg interface{}, column string, value interface{}) error {
+	return tx.Unscoped().Model(&models.Book{}).Where(condition, arg).UpdateColumns(map[string]interface{}{
+		column:    value,
+		"version": gorm.Expr("version + 1"),
+	}).Error
+}
@@ -3,23 +3,126 @@ package routes
 import (
 	"library-api/controllers"
 	"library-api/middleware"
+	"library-api/models"
 	"github.com/gorilla/mux"
 )
 
-func SetupRouter(userCtrl *controllers.UserController, bookCtrl *controllers.BookController) *mux.Router {
+func SetupRouter(userCtrl *controllers.UserController, bookCtrl *controllers.BookController, templateCtrl *controllers.EmailTemplateController, campaignCtrl *controllers.CampaignController, notificationCtrl *controllers.NotificationController, webhookCtrl *controllers.WebhookController, importCtrl *controllers.ImportController, authorCtrl *controllers.AuthorController, publisherCtrl *controllers.PublisherController, taxonomyCtrl *controllers.TaxonomyController, workCtrl *controllers.WorkController, seriesCtrl *controllers.SeriesController, coverCtrl *controllers.CoverController, reviewCtrl *controllers.ReviewController, collectionCtrl *controllers.CollectionController, recommendationCtrl *controllers.RecommendationController, trashCtrl *controllers.TrashController, loanCtrl *controllers.LoanController, holdCtrl *controllers.HoldController, idempotency *middleware.Idempotency) *mux.Router {
 	router := mux.NewRouter()
 	// Apply rate limiting to all routes
 	router.Use(middleware.RateLimit(10, 20)) // 10 req/s, burst 20
 
 	router.HandleFunc("/users", userCtrl.CreateUser).Methods("POST")
+	router.HandleFunc("/users/{id}", middleware.RequireRole(userCtrl.DeleteUser, models.RoleAdmin)).Methods("DELETE")
+	router.HandleFunc("/users/me/recommendations", middleware.Authenticate(recommendationCtrl.ForMember)).Methods("GET")
+	router.HandleFunc("/users/me/loans", middleware.Authenticate(loanCtrl.ListOwn)).Methods("GET")
+	router.HandleFunc("/users/me/holds", middleware.Authenticate(holdCtrl.ListOwn)).Methods("GET")
 	router.HandleFunc("/login", userCtrl.Login).Methods("POST")
+	// Registered before /books/{id} so "import" and "export" aren't taken for IDs
+	router.HandleFunc("/books/import", middleware.RequireRole(importCtrl.StartImport, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/books/import", middleware.RequireRole(importCtrl.ListImports, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/books/import/{id}", middleware.RequireRole(importCtrl.GetImport, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/books/import/{id}/errors", middleware.RequireRole(importCtrl.ListImportErrors, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/books/export", middleware.RequireRole(bookCtrl.ExportBooks, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/books/facets", bookCtrl.GetFacets).Methods("GET")
 	router.HandleFunc("/books", bookCtrl.GetBooks).Methods("GET")
 	router.HandleFunc("/books/{id}", bookCtrl.GetBook).Methods("GET")
-	router.HandleFunc("/books", middleware.Authenticate(bookCtrl.CreateBook)).Methods("POST")
+	router.HandleFunc("/books/isbn/{isbn}", bookCtrl.GetBookByISBN).Methods("GET")
+	router.HandleFunc("/books", middleware.Authenticate(idempotency.Wrap(bookCtrl.CreateBook))).Methods("POST")
 	router.HandleFunc("/books/{id}", middleware.Authenticate(bookCtrl.UpdateBook)).Methods("PUT")
+	router.HandleFunc("/books/{id}", middleware.Authenticate(bookCtrl.PatchBook)).Methods("PATCH")
 	router.HandleFunc("/books/{id}", middleware.Authenticate(bookCtrl.DeleteBook)).Methods("DELETE")
-	router.HandleFunc("/bulk-emails", middleware.Authenticate(userCtrl.SendBulkEmails)).Methods("POST")
-	router.HandleFunc("/bulk-emails/status", middleware.Authenticate(userCtrl.GetBulkEmailStatus)).Methods("GET")
-	router.HandleFunc("/bulk-emails/stream", middleware.Authenticate(userCtrl.StreamBulkEmailStatus)).Methods("GET")
+	router.HandleFunc("/books/{id}/cover", coverCtrl.GetCover).Methods("GET")
+	router.HandleFunc("/books/{id}/cover", middleware.Authenticate(coverCtrl.UploadCover)).Methods("PUT")
+	router.HandleFunc("/books/{id}/cover", middleware.Authenticate(coverCtrl.DeleteCover)).Methods("DELETE")
+	router.HandleFunc("/books/{id}/reviews", reviewCtrl.ListBookReviews).Methods("GET")
+	router.HandleFunc("/books/{id}/reviews", middleware.Authenticate(reviewCtrl.CreateReview)).Methods("POST")
+	router.HandleFunc("/reviews", middleware.RequireRole(reviewCtrl.ListReviews, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/reviews/{id}", middleware.OptionalAuthenticate(reviewCtrl.GetReview)).Methods("GET")
+	router.HandleFunc("/reviews/{id}", middleware.Authenticate(reviewCtrl.UpdateReview)).Methods("PUT")
+	router.HandleFunc("/reviews/{id}", middleware.Authenticate(reviewCtrl.DeleteReview)).Methods("DELETE")
+	router.HandleFunc("/reviews/{id}/moderation", middleware.RequireRole(reviewCtrl.ModerateReview, models.RoleStaff, models.RoleAdmin)).Methods("PUT")
+	router.HandleFunc("/books/{id}/similar", recommendationCtrl.Similar).Methods("GET")
+	router.HandleFunc("/books/{id}/enrich", middleware.RequireRole(bookCtrl.EnrichBook, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	// Registered before /collections/{id} so "mine" and "shared" aren't taken for IDs
+	router.HandleFunc("/collections/mine", middleware.Authenticate(collectionCtrl.ListOwn)).Methods("GET")
+	router.HandleFunc("/collections/shared/{token}", collectionCtrl.GetShared).Methods("GET")
+	router.HandleFunc("/collections", collectionCtrl.ListPublic).Methods("GET")
+	router.HandleFunc("/collections", middleware.Authenticate(collectionCtrl.CreateCollection)).Methods("POST")
+	router.HandleFunc("/collections/{id}", middleware.Authenticate(collectionCtrl.GetCollection)).Methods("GET")
+	router.HandleFunc("/collections/{id}", middleware.Authenticate(collectionCtrl.UpdateCollection)).Methods("PUT")
+	router.HandleFunc("/collections/{id}", middleware.Authenticate(collectionCtrl.DeleteCollection)).Methods("DELETE")
+	router.HandleFunc("/collections/{id}/books", middleware.Authenticate(collectionCtrl.AddBooks)).Methods("POST")
+	router.HandleFunc("/collections/{id}/books", middleware.Authenticate(collectionCtrl.ReorderBooks)).Methods("PUT")
+	router.HandleFunc("/collections/{id}/books/{book_id}", middleware.Authenticate(collectionCtrl.RemoveBook)).Methods("DELETE")
+	router.HandleFunc("/loans", middleware.RequireRole(loanCtrl.ListLoans, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/loans", middleware.RequireRole(idempotency.Wrap(loanCtrl.CreateLoan), models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/loans/{id}", middleware.RequireRole(loanCtrl.GetLoan, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/loans/{id}/return", middleware.RequireRole(loanCtrl.ReturnLoan, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/authors", authorCtrl.ListAuthors).Methods("GET")
+	router.HandleFunc("/authors", middleware.RequireRole(authorCtrl.CreateAuthor, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/authors/{id}", authorCtrl.GetAuthor).Methods("GET")
+	router.HandleFunc("/authors/{id}", middleware.RequireRole(authorCtrl.RenameAuthor, models.RoleStaff, models.RoleAdmin)).Methods("PUT")
+	router.HandleFunc("/authors/{id}/books", authorCtrl.GetAuthorBooks).Methods("GET")
+	router.HandleFunc("/authors/{id}/merge", middleware.RequireRole(authorCtrl.MergeAuthors, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/publishers", publisherCtrl.ListPublishers).Methods("GET")
+	router.HandleFunc("/publishers/{id}", publisherCtrl.GetPublisher).Methods("GET")
+	router.HandleFunc("/publishers/{id}/books", publisherCtrl.GetPublisherBooks).Methods("GET")
+	router.HandleFunc("/subjects", taxonomyCtrl.ListSubjects).Methods("GET")
+	router.HandleFunc("/subjects", middleware.RequireRole(taxonomyCtrl.CreateSubject, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/subjects/{id}", taxonomyCtrl.GetSubject).Methods("GET")
+	router.HandleFunc("/subjects/{id}", middleware.RequireRole(taxonomyCtrl.UpdateSubject, models.RoleStaff, models.RoleAdmin)).Methods("PUT")
+	router.HandleFunc("/subjects/{id}", middleware.RequireRole(taxonomyCtrl.DeleteSubject, models.RoleStaff, models.RoleAdmin)).Methods("DELETE")
+	router.HandleFunc("/tags", taxonomyCtrl.ListTags).Methods("GET")
+	router.HandleFunc("/tags", middleware.RequireRole(taxonomyCtrl.CreateTag, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/tags/{id}", taxonomyCtrl.GetTag).Methods("GET")
+	router.HandleFunc("/tags/{id}", middleware.RequireRole(taxonomyCtrl.RenameTag, models.RoleStaff, models.RoleAdmin)).Methods("PUT")
+	router.HandleFunc("/tags/{id}", middleware.RequireRole(taxonomyCtrl.DeleteTag, models.RoleStaff, models.RoleAdmin)).Methods("DELETE")
+	router.HandleFunc("/works", workCtrl.ListWorks).Methods("GET")
+	router.HandleFunc("/works", middleware.RequireRole(workCtrl.CreateWork, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/works/{id}", workCtrl.GetWork).Methods("GET")
+	router.HandleFunc("/works/{id}", middleware.RequireRole(workCtrl.UpdateWork, models.RoleStaff, models.RoleAdmin)).Methods("PUT")
+	router.HandleFunc("/works/{id}", middleware.RequireRole(workCtrl.DeleteWork, models.RoleStaff, models.RoleAdmin)).Methods("DELETE")
+	router.HandleFunc("/works/{id}/editions", workCtrl.ListEditions).Methods("GET")
+	router.HandleFunc("/works/{id}/editions", middleware.RequireRole(workCtrl.AddEditions, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/works/{id}/holds", middleware.RequireRole(holdCtrl.ListWorkHolds, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/works/{id}/holds", middleware.Authenticate(holdCtrl.PlaceHold)).Methods("POST")
+	router.HandleFunc("/holds/{id}", middleware.Authenticate(holdCtrl.GetHold)).Methods("GET")
+	router.HandleFunc("/holds/{id}/cancel", middleware.Authenticate(holdCtrl.CancelHold)).Methods("POST")
+	router.HandleFunc("/series", seriesCtrl.ListSeries).Methods("GET")
+	router.HandleFunc("/series", middleware.RequireRole(seriesCtrl.CreateSeries, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/series/{id}", seriesCtrl.GetSeries).Methods("GET")
+	router.HandleFunc("/series/{id}", middleware.RequireRole(seriesCtrl.UpdateSeries, models.RoleStaff, models.RoleAdmin)).Methods("PUT")
+	router.HandleFunc("/series/{id}", middleware.RequireRole(seriesCtrl.DeleteSeries, models.RoleStaff, models.RoleAdmin)).Methods("DELETE")
+	// POST /bulk-emails is kept for existing clients and creates an immediate campaign
+	router.HandleFunc("/bulk-emails", middleware.RequireRole(idempotency.Wrap(campaignCtrl.CreateCampaign), models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/bulk-emails/status", middleware.RequireRole(userCtrl.GetBulkEmailStatus, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/bulk-emails/{task_id}/pause", middleware.RequireRole(userCtrl.PauseBulkEmails, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/bulk-emails/{task_id}/resume", middleware.RequireRole(userCtrl.ResumeBulkEmails, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/bulk-emails/{task_id}/cancel", middleware.RequireRole(userCtrl.CancelBulkEmails, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/bulk-emails/stream", middleware.RequireRole(userCtrl.StreamBulkEmailStatus, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/email-templates", middleware.RequireRole(templateCtrl.ListTemplates, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/email-templates/{name}", middleware.RequireRole(templateCtrl.GetTemplate, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/email-templates/{name}", middleware.RequireRole(templateCtrl.SaveTemplate, models.RoleStaff, models.RoleAdmin)).Methods("PUT")
+	router.HandleFunc("/email-templates/{name}", middleware.RequireRole(templateCtrl.DeleteTemplate, models.RoleStaff, models.RoleAdmin)).Methods("DELETE")
+	router.HandleFunc("/email-templates/{name}/preview", middleware.RequireRole(templateCtrl.PreviewTemplate, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/campaigns", middleware.RequireRole(campaignCtrl.ListCampaigns, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/campaigns", middleware.RequireRole(campaignCtrl.CreateCampaign, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/campaigns/{id}", middleware.RequireRole(campaignCtrl.GetCampaign, models.RoleStaff, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/campaigns/{id}/cancel", middleware.RequireRole(campaignCtrl.CancelCampaign, models.RoleStaff, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/webhooks", middleware.RequireRole(webhookCtrl.ListWebhooks, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/webhooks", middleware.RequireRole(webhookCtrl.CreateWebhook, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/webhooks/{id}", middleware.RequireRole(webhookCtrl.GetWebhook, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", middleware.RequireRole(webhookCtrl.UpdateWebhook, models.RoleAdmin)).Methods("PUT")
+	router.HandleFunc("/webhooks/{id}", middleware.RequireRole(webhookCtrl.DeleteWebhook, models.RoleAdmin)).Methods("DELETE")
+	router.HandleFunc("/webhooks/{id}/deliveries", middleware.RequireRole(webhookCtrl.ListDeliveries, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/webhooks/{id}/deliveries/{delivery_id}/redeliver", middleware.RequireRole(webhookCtrl.Redeliver, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/trash/books", middleware.RequireRole(trashCtrl.ListBooks, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/trash/books/{id}/restore", middleware.RequireRole(trashCtrl.RestoreBook, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/trash/books/{id}", middleware.RequireRole(trashCtrl.PurgeBook, models.RoleAdmin)).Methods("DELETE")
+	router.HandleFunc("/trash/users", middleware.RequireRole(trashCtrl.ListUsers, models.RoleAdmin)).Methods("GET")
+	router.HandleFunc("/trash/users/{id}/restore", middleware.RequireRole(trashCtrl.RestoreUser, models.RoleAdmin)).Methods("POST")
+	router.HandleFunc("/trash/users/{id}", middleware.RequireRole(trashCtrl.PurgeUser, models.RoleAdmin)).Methods("DELETE")
+	router.HandleFunc("/ws", middleware.Authenticate(notificationCtrl.ServeWS)).Methods("GET")
 	return router
 }
\ No newline at end of file
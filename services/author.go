@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"library-api/events"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+var ErrMergeIntoSelf = errors.New("an author can't be merged into itself")
+
+// MergedAuthorError means the author was merged into another one.
+type MergedAuthorError struct {
+	ID         uint
+	MergedInto uint
+}
+
+func (e *MergedAuthorError) Error() string {
+	return fmt.Sprintf("author %d was merged into author %d", e.ID, e.MergedInto)
+}
+
+type AuthorService struct {
+	Repo  *repositories.AuthorRepository
+	Books *BookService // Author book lists are book listings, cached alike
+}
+
+func NewAuthorService(repo *repositories.AuthorRepository, books *BookService) *AuthorService {
+	return &AuthorService{Repo: repo, Books: books}
+}
+
+func (s *AuthorService) ListAuthors(query string, limit, offset int) ([]models.Author, error) {
+	return s.Repo.FindAll(query, limit, offset)
+}
+
+// GetAuthor returns the author, or a MergedAuthorError for an author that
+// was merged away.
+func (s *AuthorService) GetAuthor(id uint) (*models.Author, error) {
+	author, err := s.Repo.FindByID(id)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return author, err
+	}
+	if merged, mergedErr := s.Repo.FindMerged(id); mergedErr == nil {
+		return nil, &MergedAuthorError{ID: id, MergedInto: *merged.MergedIntoID}
+	}
+	return nil, err
+}
+
+func (s *AuthorService) CreateAuthor(name string) (*models.Author, error) {
+	author := &models.Author{Name: name}
+	if err := s.Repo.Create(author); err != nil {
+		return nil, err
+	}
+	return author, nil
+}
+
+// RenameAuthor changes the name, and with it the author name of every book
+// crediting the author.
+func (s *AuthorService) RenameAuthor(id uint, name string) (*models.Author, error) {
+	author, err := s.GetAuthor(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.Rename(author, name, newEvent(events.AuthorUpdated, author)); err != nil {
+		return nil, err
+	}
+	return author, nil
+}
+
+// GetAuthorBooks lists the books crediting the author, in any role unless
+// role is set.
+func (s *AuthorService) GetAuthorBooks(id uint, role string, limit, offset int) ([]models.Book, error) {
+	if _, err := s.GetAuthor(id); err != nil {
+		return nil, err
+	}
+	return s.Books.GetBooks(repositories.BookFilter{AuthorID: id, Role: role}, limit, offset)
+}
+
+// MergeAuthors folds duplicates of the target into it: their credits move
+// to the target and they are deleted. Requests for a merged author's ID
+// are sent on to the target afterwards.
+func (s *AuthorService) MergeAuthors(targetID uint, sourceIDs []uint) (*models.Author, error) {
+	target, err := s.GetAuthor(targetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range sourceIDs {
+		if id == targetID {
+			return nil, ErrMergeIntoSelf
+		}
+	}
+	unique := uniqueIDs(sourceIDs)
+	sources, err := s.Repo.FindByIDs(unique)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) != len(unique) {
+		found := map[uint]bool{}
+		for _, author := range sources {
+			found[author.ID] = true
+		}
+		for _, id := range unique {
+			if !found[id] {
+				return nil, fmt.Errorf("%w: %d", ErrUnknownAuthor, id)
+			}
+		}
+	}
+	data := events.AuthorsMergedData{TargetID: targetID, SourceIDs: unique}
+	if err := s.Repo.Merge(targetID, unique, newEvent(events.AuthorsMerged, data)); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
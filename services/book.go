@@ -3,35 +3,414 @@ package services
 import (
 	"context"
 	// "encoding/json"
+	"errors"
 	"fmt"
+	"gorm.io/gorm"
 	"library-api/cache"
+	"library-api/events"
+	"library-api/isbn"
+	"library-api/metadata"
 	"library-api/models"
+	"library-api/notify"
 	"library-api/repositories"
+	"strconv"
+	"strings"
 	"time"
 	// "library-api/logger" // Import logger
 )
 
 type BookService struct {
-	Repo  *repositories.BookRepository
-	Cache *cache.Cache // Added Redis cache
+	Repo     *repositories.BookRepository
+	Cache    *cache.Cache      // Added Redis cache
+	Notifier *notify.Notifier  // Optional; tells staff about catalog changes
+	Metadata metadata.Provider // Optional; enables EnrichBook
+	// AutoEnrich enriches new books with an ISBN after they are created
+	AutoEnrich bool
+	// Authors and Publishers link books to those entities; without them
+	// books only carry the names
+	Authors    *repositories.AuthorRepository
+	Publishers *repositories.PublisherRepository
+	Taxonomy   *repositories.TaxonomyRepository // Links subject and tag names
+	Works      *repositories.WorkRepository
+	Series     *repositories.SeriesRepository
 }
 
+var (
+	ErrEnrichmentDisabled = errors.New("no metadata provider is configured")
+	ErrBookHasNoISBN      = errors.New("book has no ISBN to look up")
+	ErrUnknownAuthor      = errors.New("author does not exist")
+	ErrUnknownWork        = errors.New("work does not exist")
+	ErrUnknownSeries      = errors.New("series does not exist")
+)
+
 func NewBookService(repo *repositories.BookRepository, cache *cache.Cache) *BookService {
 	return &BookService{Repo: repo, Cache: cache}
 }
 
-func (s *BookService) CreateBook(title, author string) (*models.Book, error) {
-	book := &models.Book{Title: title, Author: author}
-	if err := s.Repo.Create(book); err != nil {
+// BookInput holds the fields callers can set on a book. ISBN may be an
+// ISBN-10 or ISBN-13 in any common notation, or empty.
+type BookInput struct {
+	Title         string
+	Author        string
+	ISBN          string
+	Publisher     string
+	PublishedYear int
+	PageCount     int
+	Subjects      []string // Subject names; unknown ones become top-level subjects
+	Tags          []string
+	Language      string
+	Description   string
+	CoverURL      string
+	WorkID       *uint
+	SeriesID     *uint
+	SeriesNumber *float64
+	// Contributors credits authors in order. Without it, Author is linked
+	// by name as the only author; with it, Author is derived from it.
+	Contributors []ContributorInput
+}
+
+// ContributorInput credits an existing author by ID, or an author by name,
+// who is created if no author has that name yet.
+type ContributorInput struct {
+	AuthorID uint
+	Name     string
+	Role     string // ContributorAuthor if empty
+}
+
+// DuplicateISBNError means another book, possibly a deleted one, already
+// has the ISBN.
+type DuplicateISBNError struct {
+	ISBN    string
+	BookID  uint
+	Deleted bool
+}
+
+func (e *DuplicateISBNError) Error() string {
+	return fmt.Sprintf("ISBN %s already belongs to book %d", e.ISBN, e.BookID)
+}
+
+func (s *BookService) CreateBook(input BookInput) (*models.Book, error) {
+	book := &models.Book{}
+	if err := setBookInput(book, input); err != nil {
+		return nil, err
+	}
+	if err := s.checkISBN(book); err != nil {
+		return nil, err
+	}
+	if err := s.checkGrouping(book); err != nil {
 		return nil, err
 	}
-	// Invalidate cache on create (optional, if you want fresh data)
-	s.Cache.Client.Del(context.Background(), "books")
+	// Cache invalidation and notifications follow from the event, see RegisterHandlers
+	if err := s.Repo.Create(book, s.resolve(book, input.Contributors), newEvent(events.BookCreated, book)); err != nil {
+		return nil, s.duplicateISBN(book, err)
+	}
 	return book, nil
 }
 
-func (s *BookService) GetBooks(limit, offset int) ([]models.Book, error) {
-	cacheKey := fmt.Sprintf("books:limit:%d:offset:%d", limit, offset)
+// GetBookByISBN finds a book by an ISBN-10 or ISBN-13.
+func (s *BookService) GetBookByISBN(raw string) (*models.Book, error) {
+	isbn13, err := isbn.Normalize(raw)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.FindByISBN(isbn13, false)
+}
+
+func setBookInput(book *models.Book, input BookInput) error {
+	book.Title = input.Title
+	book.Author = input.Author
+	book.Publisher = input.Publisher
+	book.PublishedYear = input.PublishedYear
+	book.PageCount = input.PageCount
+	book.Subjects = input.Subjects
+	book.Tags = input.Tags
+	book.Language = strings.ToLower(strings.TrimSpace(input.Language))
+	book.WorkID = input.WorkID
+	book.SeriesID, book.SeriesNumber = input.SeriesID, input.SeriesNumber
+	book.Description = input.Description
+	book.CoverURL = input.CoverURL
+	book.ISBN13, book.ISBN10 = nil, nil
+	if input.ISBN == "" {
+		return nil
+	}
+	isbn13, err := isbn.Normalize(input.ISBN)
+	if err != nil {
+		return err
+	}
+	book.ISBN13 = &isbn13
+	if isbn10, ok := isbn.To10(isbn13); ok {
+		book.ISBN10 = &isbn10
+	}
+	return nil
+}
+
+// resolve returns the step that links the book to its credits, publisher,
+// subjects and tags, creating the ones that don't exist yet. It runs in the
+// transaction that writes the book, so a failed write leaves nothing behind.
+func (s *BookService) resolve(book *models.Book, credits []ContributorInput) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		if s.Authors != nil && s.Publishers != nil {
+			err := resolveCredits(repositories.NewAuthorRepository(tx), repositories.NewPublisherRepository(tx), book, credits)
+			if err != nil {
+				return err
+			}
+		}
+		if s.Taxonomy != nil {
+			return resolveTaxonomy(repositories.NewTaxonomyRepository(tx), book)
+		}
+		return nil
+	}
+}
+
+// resolveCredits sets the book's contributors and publisher from the
+// credits and the publisher name, creating authors and publishers that are
+// named but don't exist yet. Without credits, book.Author is credited as
+// the only author.
+func resolveCredits(authors *repositories.AuthorRepository, publishers *repositories.PublisherRepository, book *models.Book, credits []ContributorInput) error {
+	derived := len(credits) > 0
+	if !derived && book.Author != "" {
+		credits = []ContributorInput{{Name: book.Author}}
+	}
+	book.Contributors = nil
+	seen := map[string]bool{}
+	for _, credit := range credits {
+		role := credit.Role
+		if role == "" {
+			role = models.ContributorAuthor
+		}
+		author, err := creditedAuthor(authors, credit)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%d:%s", author.ID, role)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		book.Contributors = append(book.Contributors, models.BookAuthor{
+			AuthorID: author.ID, Role: role, Position: len(book.Contributors), Author: author,
+		})
+	}
+	if derived {
+		book.Author = repositories.CreditedName(book.Contributors)
+	}
+
+	book.PublisherID = nil
+	if book.Publisher != "" {
+		publisher, err := publishers.FindOrCreate(book.Publisher)
+		if err != nil {
+			return err
+		}
+		book.PublisherID = &publisher.ID
+		book.Publisher = publisher.Name
+	}
+	return nil
+}
+
+// creditedAuthor finds the author a credit names. An ID of an author that
+// was merged away credits the author it was merged into.
+func creditedAuthor(authors *repositories.AuthorRepository, credit ContributorInput) (*models.Author, error) {
+	if credit.AuthorID == 0 {
+		return authors.FindOrCreate(strings.TrimSpace(credit.Name))
+	}
+	author, err := authors.FindByID(credit.AuthorID)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return author, err
+	}
+	merged, err := authors.FindMerged(credit.AuthorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownAuthor, credit.AuthorID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return creditedAuthor(authors, ContributorInput{AuthorID: *merged.MergedIntoID})
+}
+
+// checkGrouping makes sure the book's work and series exist.
+func (s *BookService) checkGrouping(book *models.Book) error {
+	if book.WorkID != nil && s.Works != nil {
+		if _, err := s.Works.FindByID(*book.WorkID); errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownWork
+		} else if err != nil {
+			return err
+		}
+	}
+	if book.SeriesID != nil && s.Series != nil {
+		if _, err := s.Series.FindByID(*book.SeriesID); errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownSeries
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveTaxonomy links the book to its subjects and tags by name,
+// creating the ones that don't exist, and tidies the names: subjects as
+// the subject is named, tags normalized, duplicates dropped.
+func resolveTaxonomy(taxonomy *repositories.TaxonomyRepository, book *models.Book) error {
+	var subjects []string
+	book.SubjectLinks = []models.BookSubject{}
+	for _, name := range book.Subjects {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		subject, err := taxonomy.FindOrCreateSubject(name)
+		if err != nil {
+			return err
+		}
+		if !linksSubject(book.SubjectLinks, subject.ID) {
+			subjects = append(subjects, subject.Name)
+			book.SubjectLinks = append(book.SubjectLinks, models.BookSubject{SubjectID: subject.ID})
+		}
+	}
+	var tags []string
+	book.TagLinks = []models.BookTag{}
+	for _, name := range book.Tags {
+		name = repositories.NormalizeTag(name)
+		if name == "" {
+			continue
+		}
+		tag, err := taxonomy.FindOrCreateTag(name)
+		if err != nil {
+			return err
+		}
+		if !linksTag(book.TagLinks, tag.ID) {
+			tags = append(tags, tag.Name)
+			book.TagLinks = append(book.TagLinks, models.BookTag{TagID: tag.ID})
+		}
+	}
+	book.Subjects, book.Tags = subjects, tags
+	return nil
+}
+
+func linksSubject(links []models.BookSubject, id uint) bool {
+	for _, link := range links {
+		if link.SubjectID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func linksTag(links []models.BookTag, id uint) bool {
+	for _, link := range links {
+		if link.TagID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkBooks credits authors and sets publishers, by name, on books that
+// have the names but aren't linked: books from before authors and
+// publishers were tracked, and imported books, whose files only have names.
+// Books enriched before subjects were tracked get linked to them. It
+// returns how many books it credited.
+func (s *BookService) LinkBooks(ctx context.Context) (int, error) {
+	if s.Taxonomy != nil {
+		if err := s.linkSubjects(ctx); err != nil {
+			return 0, err
+		}
+	}
+	if s.Authors == nil || s.Publishers == nil {
+		return 0, nil
+	}
+	if err := s.Publishers.LinkBooks(); err != nil {
+		return 0, err
+	}
+	linked := 0
+	for ctx.Err() == nil {
+		books, err := s.Repo.FindUnlinked(200)
+		if err != nil || len(books) == 0 {
+			return linked, err
+		}
+		credits := make([]models.BookAuthor, 0, len(books))
+		for _, book := range books {
+			author, err := s.Authors.FindOrCreate(book.Author)
+			if err != nil {
+				return linked, err
+			}
+			credits = append(credits, models.BookAuthor{BookID: book.ID, AuthorID: author.ID, Role: models.ContributorAuthor})
+		}
+		if err := s.Repo.AddContributors(credits); err != nil {
+			return linked, err
+		}
+		linked += len(books)
+	}
+	return linked, ctx.Err()
+}
+
+func (s *BookService) linkSubjects(ctx context.Context) error {
+	var after uint
+	for ctx.Err() == nil {
+		books, err := s.Taxonomy.FindUnlinkedSubjects(after, 200)
+		if err != nil || len(books) == 0 {
+			return err
+		}
+		var links []models.BookSubject
+		for _, book := range books {
+			after = book.ID
+			for _, name := range book.Subjects {
+				if name = strings.TrimSpace(name); name == "" {
+					continue
+				}
+				subject, err := s.Taxonomy.FindOrCreateSubject(name)
+				if err != nil {
+					return err
+				}
+				links = append(links, models.BookSubject{BookID: book.ID, SubjectID: subject.ID})
+			}
+		}
+		if err := s.Taxonomy.AddSubjectLinks(links); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// linkImported links the books of an import batch and drops cached
+// listings, which may already have been refilled without the credits.
+func (s *BookService) linkImported(ctx context.Context, event events.Event) error {
+	linked, err := s.LinkBooks(ctx)
+	if err != nil || linked == 0 {
+		return err
+	}
+	return s.invalidateCache(ctx, event)
+}
+
+// checkISBN looks for another book with book's ISBN, so the conflict can
+// name it. The unique index still decides races; see duplicateISBN.
+func (s *BookService) checkISBN(book *models.Book) error {
+	if book.ISBN13 == nil {
+		return nil
+	}
+	existing, err := s.Repo.FindByISBN(*book.ISBN13, true)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && existing.ID == book.ID) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &DuplicateISBNError{ISBN: *book.ISBN13, BookID: existing.ID, Deleted: existing.DeletedAt.Valid}
+}
+
+// duplicateISBN turns a unique index violation on a write into a
+// DuplicateISBNError; other errors pass through.
+func (s *BookService) duplicateISBN(book *models.Book, err error) error {
+	if !errors.Is(err, gorm.ErrDuplicatedKey) || book.ISBN13 == nil {
+		return err
+	}
+	if dupErr := s.checkISBN(book); dupErr != nil {
+		return dupErr
+	}
+	return err
+}
+
+func (s *BookService) GetBooks(filter repositories.BookFilter, limit, offset int) ([]models.Book, error) {
+	cacheKey := fmt.Sprintf("books:limit:%d:offset:%d:%s", limit, offset, filterKey(filter))
 	var books []models.Book
 
 	err := s.Cache.Get(cacheKey, &books)
@@ -40,7 +419,7 @@ func (s *BookService) GetBooks(limit, offset int) ([]models.Book, error) {
 		return books, nil
 	}
 
-	books, err = s.Repo.FindAll(limit, offset)
+	books, err = s.Repo.FindAll(filter, limit, offset)
 	if err != nil {
 		(fmt.Sprintf("Error fetching books: %v", err))
 		return nil, err
@@ -53,31 +432,218 @@ func (s *BookService) GetBooks(limit, offset int) ([]models.Book, error) {
 	return books, nil
 }
 
+// filterKey identifies a filter in cache keys.
+func filterKey(f repositories.BookFilter) string {
+	available := "any"
+	if f.Available != nil {
+		available = strconv.FormatBool(*f.Available)
+	}
+	return fmt.Sprintf("title:%q:author:%q:author_id:%d:role:%q:publisher_id:%d:subject:%d:tag:%q:language:%q:work:%d:series:%d:available:%s:sort:%s",
+		f.Title, f.Author, f.AuthorID, f.Role, f.PublisherID, f.SubjectID, repositories.NormalizeTag(f.Tag), f.Language, f.WorkID, f.SeriesID, available, f.Sort)
+}
+
+// GetFacets counts the books matching filter by subject, author, language
+// and availability, limit values per facet. Counts are cached like
+// listings and dropped with them when the catalog changes.
+func (s *BookService) GetFacets(filter repositories.BookFilter, limit int) (*repositories.BookFacets, error) {
+	cacheKey := fmt.Sprintf("books:facets:limit:%d:%s", limit, filterKey(filter))
+	var facets repositories.BookFacets
+	if err := s.Cache.Get(cacheKey, &facets); err == nil {
+		return &facets, nil
+	}
+	result, err := s.Repo.Facets(filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	s.Cache.Set(cacheKey, result, 5*time.Minute)
+	return result, nil
+}
+
+// ExportBooks streams every book matching filter to fn in batches. It reads
+// the database directly; exports are too large to cache.
+func (s *BookService) ExportBooks(filter repositories.BookFilter, fn func([]models.Book) error) error {
+	return s.Repo.FindInBatches(filter, 1000, fn)
+}
+
 // Other methods (GetBook, UpdateBook, DeleteBook) remain unchanged
 func (s *BookService) GetBook(id uint) (*models.Book, error) {
 	return s.Repo.FindByID(id)
 }
 
-func (s *BookService) UpdateBook(id uint, title, author string) (*models.Book, error) {
+// UpdateBook changes the book if it is still at version, the version the
+// caller last read; otherwise it returns ErrVersionConflict.
+func (s *BookService) UpdateBook(id, version uint, input BookInput) (*models.Book, error) {
 	book, err := s.Repo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
-	book.Title = title
-	book.Author = author
-	if err := s.Repo.Update(book); err != nil {
+	if err := setBookInput(book, input); err != nil {
+		return nil, err
+	}
+	if err := s.checkISBN(book); err != nil {
 		return nil, err
 	}
-	// Invalidate books cache on update
-	s.Cache.Client.Del(context.Background(), "books")
+	if err := s.checkGrouping(book); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.Update(book, version, s.resolve(book, input.Contributors), newEvent(events.BookUpdated, book)); err != nil {
+		return nil, s.duplicateISBN(book, err)
+	}
 	return book, nil
 }
 
-func (s *BookService) DeleteBook(id uint) error {
-	err := s.Repo.Delete(id)
-	if err == nil {
-		// Invalidate books cache on delete
-		s.Cache.Client.Del(context.Background(), "books")
+func (s *BookService) DeleteBook(id, version uint) error {
+	return s.Repo.Delete(id, version, newEvent(events.BookDeleted, events.BookDeletedData{ID: id}))
+}
+
+// EnrichBook fills the book's bibliographic details from the metadata
+// provider, looked up by its ISBN. Details the book already has are kept
+// unless overwrite is set, which also replaces the title and author.
+func (s *BookService) EnrichBook(ctx context.Context, id uint, overwrite bool) (*models.Book, error) {
+	if s.Metadata == nil {
+		return nil, ErrEnrichmentDisabled
+	}
+	book, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if book.ISBN13 == nil {
+		return nil, ErrBookHasNoISBN
+	}
+	md, err := s.Metadata.Lookup(ctx, *book.ISBN13)
+	if err != nil {
+		return nil, err
+	}
+	// The provider's authors replace the credits only when they replace
+	// the author name; otherwise the book keeps its credits
+	var credits []ContributorInput
+	if len(md.Authors) > 0 && (overwrite || book.Author == "") {
+		for _, name := range md.Authors {
+			credits = append(credits, ContributorInput{Name: name})
+		}
+	} else {
+		for _, credit := range book.Contributors {
+			credits = append(credits, ContributorInput{AuthorID: credit.AuthorID, Role: credit.Role})
+		}
+	}
+	applyMetadata(book, md, overwrite)
+	if err := s.checkGrouping(book); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	book.EnrichedAt = &now
+	if err := s.Repo.Update(book, book.Version, s.resolve(book, credits), newEvent(events.BookUpdated, book)); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+func applyMetadata(book *models.Book, md *metadata.Metadata, overwrite bool) {
+	setString := func(field *string, value string) {
+		if value != "" && (overwrite || *field == "") {
+			*field = value
+		}
+	}
+	setInt := func(field *int, value int) {
+		if value > 0 && (overwrite || *field == 0) {
+			*field = value
+		}
+	}
+	setString(&book.Title, md.Title)
+	setString(&book.Author, strings.Join(md.Authors, ", "))
+	setString(&book.Publisher, md.Publisher)
+	setString(&book.Language, md.Language)
+	setInt(&book.PublishedYear, md.PublishedYear)
+	setInt(&book.PageCount, md.PageCount)
+	setString(&book.Description, md.Description)
+	setString(&book.CoverURL, md.CoverURL)
+	if len(md.Subjects) > 0 && (overwrite || len(book.Subjects) == 0) {
+		book.Subjects = md.Subjects
+	}
+}
+
+// RegisterHandlers subscribes the side effects of catalog changes.
+func (s *BookService) RegisterHandlers(d *events.Dispatcher) {
+	d.Handle("book_cache", s.invalidateCache, events.BookCreated, events.BookUpdated, events.BookDeleted, events.BookRestored, events.BooksImported,
+		events.AuthorUpdated, events.AuthorsMerged, events.SubjectUpdated, events.SubjectDeleted, events.TagUpdated, events.TagDeleted,
+		events.EditionsAdded, events.WorkDeleted, events.SeriesDeleted, events.ReviewCreated, events.ReviewUpdated, events.ReviewDeleted,
+		events.UserPurged)
+	d.Handle("book_availability_cache", s.invalidateAvailability, events.LoanCreated, events.LoanReturned)
+	d.Handle("book_link", s.linkImported, events.BooksImported)
+	d.Handle("book_notify", s.notifyStaff, events.BookCreated, events.BookUpdated, events.BookDeleted, events.BookRestored)
+	if s.AutoEnrich && s.Metadata != nil {
+		d.Handle("book_enrich", s.enrichCreated, events.BookCreated)
+	}
+}
+
+// enrichCreated enriches a new book. Books without an ISBN, or that the
+// provider doesn't know, are left alone; provider outages are retried.
+func (s *BookService) enrichCreated(ctx context.Context, event events.Event) error {
+	var book models.Book
+	if err := event.Decode(&book); err != nil {
+		return err
+	}
+	if book.ISBN13 == nil {
+		return nil
+	}
+	_, err := s.EnrichBook(ctx, book.ID, false)
+	if errors.Is(err, metadata.ErrNotFound) || errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrBookHasNoISBN) {
+		return nil
 	}
 	return err
-}
\ No newline at end of file
+}
+
+// invalidateCache drops every cached page of the book listing.
+func (s *BookService) invalidateCache(ctx context.Context, event events.Event) error {
+	iter := s.Cache.Client.Scan(ctx, 0, "books:*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := s.Cache.Client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// availabilityKeys match the cached facets and the listings filtered by
+// availability, the only cached results a loan changes.
+var availabilityKeys = []string{"books:facets:*", "books:*:available:true:*", "books:*:available:false:*"}
+
+// invalidateAvailability drops the cached results a checkout or return
+// changes, leaving the other listings cached.
+func (s *BookService) invalidateAvailability(ctx context.Context, event events.Event) error {
+	for _, pattern := range availabilityKeys {
+		iter := s.Cache.Client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			if err := s.Cache.Client.Del(ctx, iter.Val()).Err(); err != nil {
+				return err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BookService) notifyStaff(ctx context.Context, event events.Event) error {
+	var data interface{}
+	if event.Type == events.BookDeleted {
+		data = &events.BookDeletedData{}
+	} else {
+		data = &models.Book{}
+	}
+	if err := event.Decode(data); err != nil {
+		return err
+	}
+	// Notification types match the event types
+	s.Notifier.NotifyStaff(notify.TopicCatalog, event.Type, data)
+	return nil
+}
+
+// newEvent encodes data once the repository has written the row, so a
+// pointer to the model picks up its generated ID and timestamps.
+func newEvent(eventType string, data interface{}) repositories.EventFunc {
+	return func() (*models.OutboxEvent, error) {
+		return events.New(eventType, data)
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"library-api/email"
+	"library-api/logger"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+var ErrCampaignNotCancellable = errors.New("only scheduled campaigns can be cancelled")
+
+// CampaignSendError means a campaign meant to go out straight away was
+// stored but failed to send; it is kept with the failed status.
+type CampaignSendError struct {
+	CampaignID uint
+	Err        error
+}
+
+func (e *CampaignSendError) Error() string {
+	return fmt.Sprintf("campaign %d failed to send: %v", e.CampaignID, e.Err)
+}
+
+func (e *CampaignSendError) Unwrap() error { return e.Err }
+
+type CampaignService struct {
+	Repo         *repositories.CampaignRepository
+	UserRepo     *repositories.UserRepository
+	EmailService *email.EmailService
+	Logger       *logger.AsyncLogger
+}
+
+func NewCampaignService(repo *repositories.CampaignRepository, userRepo *repositories.UserRepository, emailService *email.EmailService, logger *logger.AsyncLogger) *CampaignService {
+	return &CampaignService{Repo: repo, UserRepo: userRepo, EmailService: emailService, Logger: logger}
+}
+
+// CountRecipients is the dry run: how many addresses the audience would reach.
+func (s *CampaignService) CountRecipients(audience models.CampaignAudience) (int64, error) {
+	return s.UserRepo.CountByAudience(audience)
+}
+
+// CreateCampaign stores the campaign and sends it straight away, unless it is
+// scheduled for later, in which case the scheduler picks it up.
+func (s *CampaignService) CreateCampaign(campaign *models.Campaign) (*models.Campaign, error) {
+	if campaign.Template == "" {
+		campaign.Template = "announcement"
+	}
+	// Fail early on unknown templates or content the template can't render
+	tmpl, err := s.EmailService.Templates.GetTemplate(campaign.Template)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Preview(campaignData(campaign)); err != nil {
+		return nil, err
+	}
+
+	campaign.Status = models.CampaignScheduled
+	if campaign.ScheduledAt == nil {
+		now := time.Now()
+		campaign.ScheduledAt = &now
+	}
+	if err := s.Repo.Create(campaign); err != nil {
+		return nil, err
+	}
+	if !campaign.ScheduledAt.After(time.Now()) {
+		if err := s.send(campaign); err != nil {
+			return campaign, &CampaignSendError{CampaignID: campaign.ID, Err: err}
+		}
+	}
+	return campaign, nil
+}
+
+func (s *CampaignService) ListCampaigns(limit, offset int) ([]models.Campaign, error) {
+	return s.Repo.FindAll(limit, offset)
+}
+
+func (s *CampaignService) GetCampaign(id uint) (*models.Campaign, error) {
+	return s.Repo.FindByID(id)
+}
+
+func (s *CampaignService) CancelCampaign(id uint) (*models.Campaign, error) {
+	if _, err := s.Repo.FindByID(id); err != nil {
+		return nil, err
+	}
+	ok, err := s.Repo.TransitionStatus(id, models.CampaignScheduled, models.CampaignCancelled)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCampaignNotCancellable
+	}
+	return s.Repo.FindByID(id)
+}
+
+// RunScheduler sends due campaigns every interval until ctx is cancelled.
+func (s *CampaignService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			due, err := s.Repo.FindDue(time.Now())
+			if err != nil {
+				s.Logger.Log(fmt.Sprintf("Failed to load due campaigns: %v", err))
+				continue
+			}
+			for i := range due {
+				if err := s.send(&due[i]); err != nil {
+					s.Logger.Log(fmt.Sprintf("Campaign %d failed: %v", due[i].ID, err))
+				}
+			}
+		}
+	}
+}
+
+func (s *CampaignService) send(campaign *models.Campaign) error {
+	claimed, err := s.Repo.TransitionStatus(campaign.ID, models.CampaignScheduled, models.CampaignSending)
+	if err != nil || !claimed {
+		return err // Someone else is already sending it
+	}
+	recipients, err := s.UserRepo.FindEmailsByAudience(campaign.Audience)
+	if err == nil {
+		campaign.TaskID, err = s.EmailService.SendBulkTemplate(recipients, campaign.Template, campaign.Subject, campaignData(campaign))
+	}
+	now := time.Now()
+	campaign.SentAt = &now
+	campaign.RecipientCount = len(recipients)
+	campaign.Status = models.CampaignSent
+	if err != nil {
+		campaign.Status = models.CampaignFailed
+		campaign.Error = err.Error()
+	}
+	if saveErr := s.Repo.Update(campaign); saveErr != nil {
+		return saveErr
+	}
+	s.Logger.Log(fmt.Sprintf("Campaign %d %s to %d recipients", campaign.ID, campaign.Status, campaign.RecipientCount))
+	return err
+}
+
+func campaignData(campaign *models.Campaign) map[string]interface{} {
+	return map[string]interface{}{"Body": campaign.Body, "Subject": campaign.Subject}
+}
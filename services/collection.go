@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"library-api/cache"
+	"library-api/events"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+// MaxCollectionBooks bounds a collection, which is read in one go.
+const MaxCollectionBooks = 1000
+
+var ErrCollectionFull = fmt.Errorf("a collection holds at most %d books", MaxCollectionBooks)
+
+// Cached collections are found under generation-versioned keys: bumping a
+// generation makes every key of the old one unreachable at once, and they
+// expire on their own. Shared collections are otherwise dropped one by one
+// as they or their books change.
+const (
+	collectionsPublicGen = "collections:public:gen" // Public listing pages
+	collectionsSharedGen = "collections:shared:gen" // Every shared collection
+)
+
+// CollectionService manages users' collections of books. Only owners see
+// and change their private collections; public and unlisted ones can be
+// read by anyone through their share token, and are cached.
+type CollectionService struct {
+	Repo  *repositories.CollectionRepository
+	Books *repositories.BookRepository
+	Cache *cache.Cache
+}
+
+func NewCollectionService(repo *repositories.CollectionRepository, books *repositories.BookRepository, cache *cache.Cache) *CollectionService {
+	return &CollectionService{Repo: repo, Books: books, Cache: cache}
+}
+
+// CollectionInput is what owners set on a collection. An empty
+// Visibility is private.
+type CollectionInput struct {
+	Title       string
+	Description string
+	Visibility  string
+}
+
+// ListPublic lists public collections, most recently changed first,
+// without their books.
+func (s *CollectionService) ListPublic(limit, offset int) ([]models.Collection, error) {
+	generation, err := s.generation(collectionsPublicGen)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := fmt.Sprintf("collections:public:%s:limit:%d:offset:%d", generation, limit, offset)
+	var collections []models.Collection
+	if err := s.Cache.Get(cacheKey, &collections); err == nil {
+		return collections, nil
+	}
+	collections, err = s.Repo.FindAll(repositories.CollectionFilter{Visibility: models.VisibilityPublic}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	s.Cache.Set(cacheKey, collections, 5*time.Minute)
+	return collections, nil
+}
+
+// ListOwn lists the owner's collections, without their books.
+func (s *CollectionService) ListOwn(ownerID uint, limit, offset int) ([]models.Collection, error) {
+	return s.Repo.FindAll(repositories.CollectionFilter{OwnerID: ownerID}, limit, offset)
+}
+
+// GetShared reads a public or unlisted collection, with its books, by its
+// share token.
+func (s *CollectionService) GetShared(token string) (*models.Collection, error) {
+	cacheKey, err := s.sharedKey(token)
+	if err != nil {
+		return nil, err
+	}
+	var collection models.Collection
+	if err := s.Cache.Get(cacheKey, &collection); err == nil {
+		return &collection, nil
+	}
+	found, err := s.Repo.FindByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if found.Visibility == models.VisibilityPrivate {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if err := s.Repo.LoadItems(found); err != nil {
+		return nil, err
+	}
+	s.Cache.Set(cacheKey, found, 10*time.Minute)
+	return found, nil
+}
+
+// GetOwn reads one of the owner's collections with its books.
+func (s *CollectionService) GetOwn(id, ownerID uint) (*models.Collection, error) {
+	collection, err := s.own(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.LoadItems(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// own finds the collection if ownerID owns it. Other users' collections
+// are reported missing rather than forbidden, so private ones stay secret.
+func (s *CollectionService) own(id, ownerID uint) (*models.Collection, error) {
+	collection, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if collection.OwnerID != ownerID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return collection, nil
+}
+
+func (s *CollectionService) CreateCollection(ownerID uint, input CollectionInput) (*models.Collection, error) {
+	collection := &models.Collection{OwnerID: ownerID, ShareToken: newShareToken()}
+	setCollectionInput(collection, input)
+	if err := s.Repo.Create(collection, newEvent(events.CollectionUpdated, collection)); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func (s *CollectionService) UpdateCollection(id, ownerID uint, input CollectionInput) (*models.Collection, error) {
+	collection, err := s.own(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	setCollectionInput(collection, input)
+	if err := s.Repo.Update(collection, newEvent(events.CollectionUpdated, collection)); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func setCollectionInput(collection *models.Collection, input CollectionInput) {
+	collection.Title = strings.TrimSpace(input.Title)
+	collection.Description = input.Description
+	collection.Visibility = input.Visibility
+	if collection.Visibility == "" {
+		collection.Visibility = models.VisibilityPrivate
+	}
+}
+
+func (s *CollectionService) DeleteCollection(id, ownerID uint) error {
+	collection, err := s.own(id, ownerID)
+	if err != nil {
+		return err
+	}
+	return s.Repo.Delete(collection, newEvent(events.CollectionDeleted, collection))
+}
+
+// AddBooks puts the books into the collection at position, or at the end
+// if position is nil. Books already in it don't move.
+func (s *CollectionService) AddBooks(id, ownerID uint, bookIDs []uint, position *int) (*models.Collection, error) {
+	collection, err := s.own(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	bookIDs = uniqueIDs(bookIDs)
+	existing, err := s.Books.CountExisting(bookIDs)
+	if err != nil {
+		return nil, err
+	}
+	if existing != int64(len(bookIDs)) {
+		return nil, ErrUnknownBook
+	}
+	if collection.BookCount+len(bookIDs) > MaxCollectionBooks {
+		return nil, ErrCollectionFull
+	}
+	at := -1
+	if position != nil {
+		at = *position
+	}
+	if err := s.Repo.AddBooks(collection, bookIDs, at, newEvent(events.CollectionUpdated, collection)); err != nil {
+		return nil, err
+	}
+	return s.GetOwn(id, ownerID)
+}
+
+// RemoveBook takes the book out of the collection. gorm.ErrRecordNotFound
+// means the collection doesn't exist or the book isn't in it.
+func (s *CollectionService) RemoveBook(id, ownerID, bookID uint) error {
+	collection, err := s.own(id, ownerID)
+	if err != nil {
+		return err
+	}
+	return s.Repo.RemoveBook(collection, bookID, newEvent(events.CollectionUpdated, collection))
+}
+
+// ReorderBooks puts the collection's books in the given order, which must
+// list each of them once.
+func (s *CollectionService) ReorderBooks(id, ownerID uint, bookIDs []uint) (*models.Collection, error) {
+	collection, err := s.own(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.Reorder(collection, bookIDs, newEvent(events.CollectionUpdated, collection)); err != nil {
+		return nil, err
+	}
+	return s.GetOwn(id, ownerID)
+}
+
+// generation reads the current generation under genKey, "0" before the
+// first bump.
+func (s *CollectionService) generation(genKey string) (string, error) {
+	generation, err := s.Cache.Client.Get(context.Background(), genKey).Result()
+	if err == redis.Nil {
+		return "0", nil
+	}
+	return generation, err
+}
+
+func (s *CollectionService) sharedKey(token string) (string, error) {
+	generation, err := s.generation(collectionsSharedGen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("collections:shared:%s:%s", generation, token), nil
+}
+
+// RegisterHandlers keeps cached collections in step with them and with the
+// books they show.
+func (s *CollectionService) RegisterHandlers(d *events.Dispatcher) {
+	d.Handle("collection_cache", s.invalidateCache, events.CollectionUpdated, events.CollectionDeleted,
+		events.BookUpdated, events.BookDeleted, events.BookRestored, events.BooksImported, events.UserPurged)
+}
+
+// invalidateCache drops what the event makes stale, and only that: the
+// changed collection, or the shared collections holding the changed book.
+// Public listing pages only change with collections, or with the book
+// counts of public ones. Imports and purged users, which don't say which
+// collections they touched, move to a new generation of everything.
+func (s *CollectionService) invalidateCache(ctx context.Context, event events.Event) error {
+	var stale []models.Collection
+	switch event.Type {
+	case events.BooksImported, events.UserPurged:
+		if err := s.Cache.Client.Incr(ctx, collectionsSharedGen).Err(); err != nil {
+			return err
+		}
+		return s.Cache.Client.Incr(ctx, collectionsPublicGen).Err()
+	case events.CollectionUpdated, events.CollectionDeleted:
+		var collection models.Collection
+		if err := event.Decode(&collection); err != nil {
+			return err
+		}
+		// Its visibility may have just changed, so public pages go either way
+		collection.Visibility = models.VisibilityPublic
+		stale = append(stale, collection)
+	default:
+		var book struct {
+			ID uint `json:"id"`
+		}
+		if err := event.Decode(&book); err != nil {
+			return err
+		}
+		shared, err := s.Repo.FindSharedWithBook(book.ID)
+		if err != nil {
+			return err
+		}
+		stale = shared
+	}
+
+	generation, err := s.generation(collectionsSharedGen)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(stale))
+	publicChanged := false
+	for _, collection := range stale {
+		keys = append(keys, fmt.Sprintf("collections:shared:%s:%s", generation, collection.ShareToken))
+		// Book edits don't show on the pages, only books coming and going do
+		if collection.Visibility == models.VisibilityPublic && event.Type != events.BookUpdated {
+			publicChanged = true
+		}
+	}
+	if len(keys) > 0 {
+		if err := s.Cache.Client.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+	}
+	if publicChanged {
+		return s.Cache.Client.Incr(ctx, collectionsPublicGen).Err()
+	}
+	return nil
+}
+
+func newShareToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
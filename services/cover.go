@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"library-api/cover"
+	"library-api/events"
+	"library-api/models"
+	"library-api/repositories"
+	"library-api/storage"
+)
+
+var ErrNoCover = errors.New("book has no uploaded cover")
+
+// CoverService keeps uploaded book covers, in every size of cover.Sizes,
+// in Storage.
+type CoverService struct {
+	Books   *repositories.BookRepository
+	Storage storage.Storage
+}
+
+func NewCoverService(books *repositories.BookRepository, store storage.Storage) *CoverService {
+	return &CoverService{Books: books, Storage: store}
+}
+
+func (s *CoverService) GetBook(id uint) (*models.Book, error) {
+	return s.Books.FindByID(id)
+}
+
+// UploadCover makes the image in data the book's cover. Each upload is
+// stored under a key of its own, so the old cover is served until the new
+// one is committed and its files are deleted afterwards.
+func (s *CoverService) UploadCover(ctx context.Context, id uint, data []byte) (*models.Book, error) {
+	book, err := s.Books.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	images, err := cover.Process(data)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key := fmt.Sprintf("covers/%d/%d", id, now.UnixNano())
+	for _, img := range images {
+		if err := s.Storage.Put(ctx, key+"/"+img.Size, img.Data, img.ContentType); err != nil {
+			s.deleteFiles(context.Background(), key) // Best effort; ctx may be what failed
+			return nil, err
+		}
+	}
+	book.CoverKey, book.CoverType, book.CoverUpdatedAt = key, images[0].ContentType, &now
+	if err := s.setCover(book); err != nil {
+		s.deleteFiles(context.Background(), key)
+		return nil, err
+	}
+	return book, nil
+}
+
+// RemoveCover takes the uploaded cover off the book. An external CoverURL
+// is kept.
+func (s *CoverService) RemoveCover(id uint) (*models.Book, error) {
+	book, err := s.Books.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if book.CoverKey == "" {
+		return nil, ErrNoCover
+	}
+	book.CoverKey, book.CoverType, book.CoverUpdatedAt = "", "", nil
+	if err := s.setCover(book); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// setCover saves the book's cover and announces the files of the one it
+// replaced, if any, for deletion.
+func (s *CoverService) setCover(book *models.Book) error {
+	replaced := &events.CoverReplacedData{BookID: book.ID}
+	return s.Books.SetCover(book, &replaced.Key,
+		newEvent(events.BookUpdated, book), newEvent(events.CoverReplaced, replaced))
+}
+
+// OpenCover opens one size of the book's uploaded cover. ErrNoCover means
+// the book has none, or its files are gone.
+func (s *CoverService) OpenCover(ctx context.Context, book *models.Book, size string) (io.ReadCloser, int64, error) {
+	if book.CoverKey == "" {
+		return nil, 0, ErrNoCover
+	}
+	body, length, err := s.Storage.Get(ctx, book.CoverKey+"/"+size)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, 0, ErrNoCover
+	}
+	return body, length, err
+}
+
+// RegisterHandlers deletes the files of replaced covers and of purged
+// books' covers. A deleted book keeps its cover files until it is purged,
+// so restoring it brings the cover back.
+func (s *CoverService) RegisterHandlers(d *events.Dispatcher) {
+	d.Handle("cover_files", s.deleteOldFiles, events.CoverReplaced, events.BookPurged)
+}
+
+func (s *CoverService) deleteOldFiles(ctx context.Context, event events.Event) error {
+	var key string
+	if event.Type == events.BookPurged {
+		var data events.BookPurgedData
+		if err := event.Decode(&data); err != nil {
+			return err
+		}
+		key = data.CoverKey
+	} else {
+		var data events.CoverReplacedData
+		if err := event.Decode(&data); err != nil {
+			return err
+		}
+		key = data.Key
+	}
+	if key == "" {
+		return nil
+	}
+	return s.deleteFiles(ctx, key)
+}
+
+// HasFiles reports whether the cover stored under key is still there,
+// judging by its original size.
+func (s *CoverService) HasFiles(ctx context.Context, key string) (bool, error) {
+	body, _, err := s.Storage.Get(ctx, key+"/"+cover.Original)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	body.Close()
+	return true, nil
+}
+
+// deleteFiles deletes every size stored under key.
+func (s *CoverService) deleteFiles(ctx context.Context, key string) error {
+	var first error
+	for _, size := range cover.Sizes {
+		if err := s.Storage.Delete(ctx, key+"/"+size.Name); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
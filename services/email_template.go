@@ -0,0 +1,75 @@
+package services
+
+import (
+	"strings"
+
+	"library-api/email"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+type EmailTemplateService struct {
+	Repo         *repositories.EmailTemplateRepository
+	EmailService *email.EmailService
+}
+
+func NewEmailTemplateService(repo *repositories.EmailTemplateRepository, emailService *email.EmailService) *EmailTemplateService {
+	return &EmailTemplateService{Repo: repo, EmailService: emailService}
+}
+
+// ListTemplates returns the stored templates followed by any built-in ones
+// that have not been overridden.
+func (s *EmailTemplateService) ListTemplates() ([]*email.Template, error) {
+	stored, err := s.Repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var templates []*email.Template
+	for i := range stored {
+		templates = append(templates, repositories.ToEmailTemplate(&stored[i]))
+		seen[stored[i].Name] = true
+	}
+	for name := range email.DefaultTemplates {
+		if !seen[name] {
+			tmpl, _ := email.NewDefaultTemplateStore().GetTemplate(name)
+			templates = append(templates, tmpl)
+		}
+	}
+	return templates, nil
+}
+
+func (s *EmailTemplateService) GetTemplate(name string) (*email.Template, error) {
+	return s.EmailService.Templates.GetTemplate(name)
+}
+
+// SaveTemplate checks that every part parses and renders before storing it.
+func (s *EmailTemplateService) SaveTemplate(tmpl *email.Template) (*email.Template, error) {
+	if _, err := tmpl.Preview(nil); err != nil {
+		return nil, err
+	}
+	record := &models.EmailTemplate{
+		Name:      tmpl.Name,
+		Subject:   tmpl.Subject,
+		HTML:      tmpl.HTML,
+		Text:      tmpl.Text,
+		Variables: strings.Join(tmpl.Variables, ","),
+	}
+	if err := s.Repo.Save(record); err != nil {
+		return nil, err
+	}
+	return repositories.ToEmailTemplate(record), nil
+}
+
+func (s *EmailTemplateService) DeleteTemplate(name string) error {
+	return s.Repo.DeleteByName(name)
+}
+
+// PreviewTemplate renders the named template, filling gaps in data with placeholders.
+func (s *EmailTemplateService) PreviewTemplate(name string, data map[string]interface{}) (*email.Rendered, error) {
+	tmpl, err := s.GetTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Preview(data)
+}
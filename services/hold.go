@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/events"
+	"library-api/models"
+	"library-api/notify"
+	"library-api/repositories"
+)
+
+// HoldExistsError means the member already has an open hold on the work.
+type HoldExistsError struct {
+	HoldID uint
+}
+
+func (e *HoldExistsError) Error() string {
+	return fmt.Sprintf("already holding the work in hold %d", e.HoldID)
+}
+
+// Holder is who acts on a hold. Staff and admins see and cancel anyone's.
+type Holder struct {
+	UserID uint
+	Staff  bool
+}
+
+// HoldService queues members for works. A hold is filled by any edition of
+// its work: when one is returned, added to the work or otherwise free, it
+// is set aside for the oldest waiting hold and the member is sent
+// hold.ready. Checking the book out to them fulfils the hold.
+type HoldService struct {
+	Repo     *repositories.HoldRepository
+	Works    *repositories.WorkRepository
+	Books    *repositories.BookRepository
+	Notifier *notify.Notifier // Optional; tells members their hold is ready
+}
+
+func NewHoldService(repo *repositories.HoldRepository, works *repositories.WorkRepository, books *repositories.BookRepository) *HoldService {
+	return &HoldService{Repo: repo, Works: works, Books: books}
+}
+
+func (s *HoldService) ListHolds(filter repositories.HoldFilter, limit, offset int) ([]models.Hold, error) {
+	return s.Repo.FindAll(filter, limit, offset)
+}
+
+// ListWorkHolds lists the work's queue.
+func (s *HoldService) ListWorkHolds(workID uint, status string, limit, offset int) ([]models.Hold, error) {
+	if _, err := s.Works.FindByID(workID); err != nil {
+		return nil, err
+	}
+	return s.Repo.FindAll(repositories.HoldFilter{WorkID: workID, Status: status}, limit, offset)
+}
+
+// GetHold finds a hold; members only find their own.
+func (s *HoldService) GetHold(id uint, by Holder) (*models.Hold, error) {
+	hold, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !by.Staff && hold.UserID != by.UserID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return hold, nil
+}
+
+// PlaceHold queues the member for the work, and fills the hold straight
+// away if an edition is free.
+func (s *HoldService) PlaceHold(workID, userID uint) (*models.Hold, error) {
+	if existing, err := s.Repo.FindOpen(workID, userID); err == nil {
+		return nil, &HoldExistsError{HoldID: existing.ID}
+	}
+	hold := &models.Hold{WorkID: workID, UserID: userID}
+	if err := s.Repo.Create(hold); err != nil {
+		if errors.Is(err, repositories.ErrHoldExists) {
+			// Lost a race with the same member's other request
+			if existing, findErr := s.Repo.FindOpen(workID, userID); findErr == nil {
+				return nil, &HoldExistsError{HoldID: existing.ID}
+			}
+		}
+		return nil, err
+	}
+	if err := s.fillWork(workID); err != nil {
+		return nil, err
+	}
+	return s.Repo.FindByID(hold.ID)
+}
+
+// CancelHold cancels a waiting or ready hold, as its member or staff. A
+// book set aside for it goes to the next hold in the queue.
+func (s *HoldService) CancelHold(id uint, by Holder) (*models.Hold, error) {
+	hold, err := s.GetHold(id, by)
+	if err != nil {
+		return nil, err
+	}
+	wasReady := hold.Status == models.HoldReady
+	if err := s.Repo.Cancel(hold); err != nil {
+		return nil, err
+	}
+	if wasReady && hold.BookID != nil {
+		if err := s.fill(*hold.BookID); err != nil {
+			return nil, err
+		}
+	}
+	return hold, nil
+}
+
+func (s *HoldService) RegisterHandlers(d *events.Dispatcher) {
+	d.Handle("hold_fill", s.fillFreed, events.LoanReturned, events.LoanCreated, events.EditionsAdded, events.BookCreated, events.BookRestored)
+}
+
+// fillFreed fills holds from the books the event may have freed: a returned
+// book, the other edition a member's checkout released, or editions new to
+// a work.
+func (s *HoldService) fillFreed(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.LoanReturned:
+		var data events.LoanReturnedData
+		if err := event.Decode(&data); err != nil {
+			return err
+		}
+		return s.fill(data.BookID)
+	case events.LoanCreated:
+		var data events.LoanCreatedData
+		if err := event.Decode(&data); err != nil {
+			return err
+		}
+		book, err := s.Books.FindByID(data.BookID)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && book.WorkID == nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.fillWork(*book.WorkID)
+	case events.EditionsAdded:
+		var data events.EditionsAddedData
+		if err := event.Decode(&data); err != nil {
+			return err
+		}
+		return s.fillWork(data.WorkID)
+	}
+	var book models.Book
+	if err := event.Decode(&book); err != nil {
+		return err
+	}
+	if book.WorkID == nil {
+		return nil
+	}
+	return s.fillWork(*book.WorkID)
+}
+
+func (s *HoldService) fill(bookID uint) error {
+	hold, err := s.Repo.Fill(bookID, time.Now())
+	if err != nil || hold == nil {
+		return err
+	}
+	s.notifyReady(hold)
+	return nil
+}
+
+func (s *HoldService) fillWork(workID uint) error {
+	filled, err := s.Repo.FillWork(workID, time.Now())
+	for i := range filled {
+		s.notifyReady(&filled[i])
+	}
+	return err
+}
+
+func (s *HoldService) notifyReady(hold *models.Hold) {
+	s.Notifier.NotifyUser(hold.UserID, notify.EventHoldReady, notify.HoldData{HoldID: hold.ID, WorkID: hold.WorkID, BookID: *hold.BookID})
+}
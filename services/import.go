@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/apperror"
+	"library-api/bookimport"
+	"library-api/events"
+	"library-api/logger"
+	"library-api/models"
+	"library-api/notify"
+	"library-api/repositories"
+)
+
+// MaxImportRowErrors caps the error report of one import; past it only the
+// failed count goes up.
+const MaxImportRowErrors = 10000
+
+// ImportService runs catalog imports in the background. Uploads are
+// spooled to a temporary file first, so the request can finish while the
+// rows are read from disk one at a time.
+type ImportService struct {
+	Repo      *repositories.ImportRepository
+	Books     *repositories.BookRepository
+	Notifier  *notify.Notifier // Optional; progress goes to the bulk_tasks topic
+	Logger    *logger.AsyncLogger
+	BatchSize int
+}
+
+func NewImportService(repo *repositories.ImportRepository, books *repositories.BookRepository, logger *logger.AsyncLogger) *ImportService {
+	return &ImportService{Repo: repo, Books: books, Logger: logger, BatchSize: 500}
+}
+
+// StartImport saves upload and starts importing it. With dryRun every row
+// is validated and matched against the catalog but nothing is kept.
+func (s *ImportService) StartImport(upload io.Reader, format string, dryRun bool, userID uint) (*models.ImportJob, error) {
+	file, err := os.CreateTemp("", "book-import-*."+format)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, upload); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	// A bad header fails the request rather than a job nobody is watching yet
+	reader, err := bookimport.NewReader(file, format)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	job := &models.ImportJob{Format: format, DryRun: dryRun, Status: models.ImportRunning, CreatedBy: userID}
+	if err := s.Repo.Create(job); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	go func() {
+		defer os.Remove(file.Name())
+		defer file.Close()
+		s.run(job, reader)
+	}()
+	return job, nil
+}
+
+func (s *ImportService) GetImport(id uint) (*models.ImportJob, error) {
+	return s.Repo.FindByID(id)
+}
+
+func (s *ImportService) ListImports(limit, offset int) ([]models.ImportJob, error) {
+	return s.Repo.FindAll(limit, offset)
+}
+
+// ImportErrors returns a page of the job's error report, ordered by line.
+func (s *ImportService) ImportErrors(id uint, limit, offset int) ([]models.ImportRowError, error) {
+	if _, err := s.Repo.FindByID(id); err != nil {
+		return nil, err
+	}
+	return s.Repo.FindErrors(id, limit, offset)
+}
+
+// RunJanitor fails jobs that haven't made progress for staleAfter, such as
+// those of a replica that was stopped mid-import.
+func (s *ImportService) RunJanitor(ctx context.Context, interval, staleAfter time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := s.Repo.FailStale(time.Now().Add(-staleAfter)); err != nil {
+			s.Logger.Log(fmt.Sprintf("Import janitor failed: %v", err))
+		} else if n > 0 {
+			s.Logger.Log(fmt.Sprintf("Marked %d interrupted imports as failed", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ImportService) run(job *models.ImportJob, reader *bookimport.Reader) {
+	var batch []models.Book
+	var lines []int // The line of each book in batch
+	var rowErrors []models.ImportRowError
+	stored := 0
+	addError := func(line int, fe apperror.FieldError) {
+		if stored < MaxImportRowErrors {
+			rowErrors = append(rowErrors, models.ImportRowError{JobID: job.ID, Line: line, Field: fe.Field, Code: fe.Code, Message: fe.Message})
+			stored++
+		}
+	}
+
+	flush := func() error {
+		if len(batch) > 0 {
+			created, updated, skipped, err := s.upsert(job, batch)
+			if err != nil {
+				return err
+			}
+			job.Created += created
+			job.Updated += updated
+			job.Failed += len(skipped)
+			for _, skip := range skipped {
+				addError(lines[skip.Index], apperror.FieldError{Field: skip.Field, Code: skip.Code, Message: skip.Message})
+			}
+		}
+		batch, lines = batch[:0], lines[:0]
+		if err := s.Repo.AddErrors(rowErrors); err != nil {
+			return err
+		}
+		rowErrors = rowErrors[:0]
+		if err := s.Repo.Save(job); err != nil {
+			return err
+		}
+		s.notify(job)
+		return nil
+	}
+
+	var err error
+	for {
+		var row bookimport.Row
+		row, err = reader.Next()
+		if err != nil {
+			break
+		}
+		job.Rows++
+		if len(row.Errors) > 0 {
+			job.Failed++
+			for _, fe := range row.Errors {
+				addError(row.Line, fe)
+			}
+		} else {
+			book := models.Book{Version: 1}
+			book.ID = row.ID
+			setBookInput(&book, BookInput{Title: row.Title, Author: row.Author, ISBN: row.ISBN}) // Already validated
+			batch = append(batch, book)
+			lines = append(lines, row.Line)
+		}
+		if len(batch) >= s.BatchSize || len(rowErrors) >= s.BatchSize {
+			if err = flush(); err != nil {
+				break
+			}
+		}
+	}
+	if err == io.EOF {
+		err = flush()
+	}
+
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = models.ImportCompleted
+	if err != nil {
+		job.Status = models.ImportFailed
+		job.Error = err.Error()
+		s.Logger.Log(fmt.Sprintf("Import %d failed after %d rows: %v", job.ID, job.Rows, err))
+	}
+	if err := s.Repo.Save(job); err != nil {
+		s.Logger.Log(fmt.Sprintf("Failed to save import %d: %v", job.ID, err))
+	}
+	s.notify(job)
+}
+
+// errDryRun rolls back the batch of a dry run once it has been counted.
+var errDryRun = errors.New("dry run")
+
+// upsert writes the batch. A dry run writes it the same way, so it reports
+// the same created, updated and skipped rows, and then rolls it back;
+// batches are rolled back one by one, so a book repeated in a later batch is
+// counted as created again rather than updated.
+func (s *ImportService) upsert(job *models.ImportJob, batch []models.Book) (created, updated int, skipped []repositories.UpsertSkip, err error) {
+	if !job.DryRun {
+		data := events.BooksImportedData{JobID: job.ID, Books: len(batch)}
+		return s.Books.Upsert(batch, newEvent(events.BooksImported, data))
+	}
+	err = s.Books.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, updated, skipped, err = repositories.NewBookRepository(tx).Upsert(batch)
+		if err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return created, updated, skipped, err
+}
+
+func (s *ImportService) notify(job *models.ImportJob) {
+	s.Notifier.NotifyStaff(notify.TopicBulkTasks, notify.EventImportProgress, job)
+}
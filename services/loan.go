@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/events"
+	"library-api/logger"
+	"library-api/models"
+	"library-api/notify"
+	"library-api/repositories"
+)
+
+var (
+	ErrUnknownMember   = errors.New("member does not exist")
+	ErrLoanUnknownBook = errors.New("book to lend does not exist")
+	ErrDueInPast       = errors.New("due date must be in the future")
+)
+
+// LoanService is circulation: staff check books out to members and take
+// them back. Both writes append a loan event to the outbox, and RunDueChecker
+// records loan.overdue for loans that pass their due date, which the member
+// is then told of through Notifier.
+type LoanService struct {
+	Repo     *repositories.LoanRepository
+	Users    *repositories.UserRepository
+	Period   time.Duration // Lending period when checkout gives no due date
+	Logger   *logger.AsyncLogger
+	Notifier *notify.Notifier
+}
+
+func NewLoanService(repo *repositories.LoanRepository, users *repositories.UserRepository, period time.Duration, logger *logger.AsyncLogger) *LoanService {
+	return &LoanService{Repo: repo, Users: users, Period: period, Logger: logger}
+}
+
+func (s *LoanService) ListLoans(filter repositories.LoanFilter, limit, offset int) ([]models.Loan, error) {
+	return s.Repo.FindAll(filter, limit, offset)
+}
+
+func (s *LoanService) GetLoan(id uint) (*models.Loan, error) {
+	return s.Repo.FindByID(id)
+}
+
+// Checkout lends the book to the member until dueAt, or for Period when
+// dueAt is nil. A book that is already out is repositories.ErrBookOnLoan.
+func (s *LoanService) Checkout(bookID, userID uint, dueAt *time.Time) (*models.Loan, error) {
+	if _, err := s.Users.FindByID(userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownMember
+		}
+		return nil, err
+	}
+	now := time.Now()
+	loan := &models.Loan{BookID: bookID, UserID: userID, BorrowedAt: now, DueAt: now.Add(s.Period)}
+	if dueAt != nil {
+		if !dueAt.After(now) {
+			return nil, ErrDueInPast
+		}
+		loan.DueAt = *dueAt
+	}
+	// Built once the loan is written, so the event has its ID
+	err := s.Repo.Create(loan, func() (*models.OutboxEvent, error) {
+		return events.New(events.LoanCreated, events.LoanCreatedData{LoanID: loan.ID, BookID: loan.BookID, UserID: loan.UserID, DueAt: loan.DueAt})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrLoanUnknownBook
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loan, nil
+}
+
+// Return closes the loan. A loan returned before is
+// repositories.ErrLoanReturned.
+func (s *LoanService) Return(id uint) (*models.Loan, error) {
+	loan, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if loan.ReturnedAt != nil {
+		return nil, repositories.ErrLoanReturned
+	}
+	err = s.Repo.Return(loan, time.Now(), func() (*models.OutboxEvent, error) {
+		return events.New(events.LoanReturned, events.LoanReturnedData{LoanID: loan.ID, BookID: loan.BookID, UserID: loan.UserID, ReturnedAt: *loan.ReturnedAt})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loan, nil
+}
+
+func (s *LoanService) RegisterHandlers(d *events.Dispatcher) {
+	d.Handle("loan_notify", s.notifyOverdue, events.LoanOverdue)
+}
+
+// notifyOverdue tells the member their loan is overdue.
+func (s *LoanService) notifyOverdue(ctx context.Context, event events.Event) error {
+	var data events.LoanOverdueData
+	if err := event.Decode(&data); err != nil {
+		return err
+	}
+	s.Notifier.NotifyUser(data.UserID, notify.EventOverdue, notify.LoanData{LoanID: data.LoanID, BookID: data.BookID, DueAt: data.DueAt})
+	return nil
+}
+
+// RunDueChecker records loan.overdue, once, for each open loan past its due
+// date, checking every interval.
+func (s *LoanService) RunDueChecker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.markOverdue(time.Now()); err != nil {
+				s.Logger.Log(fmt.Sprintf("Marking overdue loans failed: %v", err))
+			}
+		}
+	}
+}
+
+func (s *LoanService) markOverdue(now time.Time) error {
+	for {
+		loans, err := s.Repo.FindOverdue(now, 100)
+		if err != nil || len(loans) == 0 {
+			return err
+		}
+		for i := range loans {
+			loan := &loans[i]
+			_, err := s.Repo.MarkOverdue(loan, now, newEvent(events.LoanOverdue, events.LoanOverdueData{
+				LoanID: loan.ID, BookID: loan.BookID, UserID: loan.UserID, DueAt: loan.DueAt,
+			}))
+			if err != nil {
+				return err
+			}
+		}
+		if len(loans) < 100 {
+			return nil
+		}
+	}
+}
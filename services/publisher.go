@@ -0,0 +1,30 @@
+package services
+
+import (
+	"library-api/models"
+	"library-api/repositories"
+)
+
+type PublisherService struct {
+	Repo  *repositories.PublisherRepository
+	Books *BookService
+}
+
+func NewPublisherService(repo *repositories.PublisherRepository, books *BookService) *PublisherService {
+	return &PublisherService{Repo: repo, Books: books}
+}
+
+func (s *PublisherService) ListPublishers(query string, limit, offset int) ([]models.Publisher, error) {
+	return s.Repo.FindAll(query, limit, offset)
+}
+
+func (s *PublisherService) GetPublisher(id uint) (*models.Publisher, error) {
+	return s.Repo.FindByID(id)
+}
+
+func (s *PublisherService) GetPublisherBooks(id uint, limit, offset int) ([]models.Book, error) {
+	if _, err := s.Repo.FindByID(id); err != nil {
+		return nil, err
+	}
+	return s.Books.GetBooks(repositories.BookFilter{PublisherID: id}, limit, offset)
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"library-api/cache"
+	"library-api/logger"
+	"library-api/models"
+	"library-api/recommend"
+	"library-api/repositories"
+)
+
+// Why a book was recommended. Results list read_together books first, then
+// same_author_or_subject ones, then popular ones.
+const (
+	ReasonReadTogether = "read_together"
+	ReasonRelated      = "same_author_or_subject"
+	ReasonPopular      = "popular"
+)
+
+const (
+	recsModelKey    = "recs:model" // Holds the current model generation
+	recsRebuildLock = "recs:rebuild:lock"
+	// maxHistory bounds how many of a member's books are read, for the
+	// model and for their recommendations.
+	maxHistory = 200
+	// similarPerBook is how many similar books the model keeps per book.
+	similarPerBook = 50
+	// maxSeeds is how many of a member's latest books their
+	// recommendations start from.
+	maxSeeds = 50
+)
+
+// Recommendation is a recommended book with its score and reason. Scores
+// compare books of the same reason only.
+type Recommendation struct {
+	Book   models.Book `json:"book"`
+	Score  float64     `json:"score"`
+	Reason string      `json:"reason"`
+}
+
+// ranked is a recommendation before its book is read; results are cached
+// this way so deleted or edited books never show stale.
+type ranked struct {
+	BookID uint    `json:"book_id"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
+// RecommendationService recommends books from what members read together.
+// A periodic rebuild computes, for every book, the books most often read
+// by the same members and stores that model in Redis; requests only read
+// it. Books with thin history are completed with books sharing their
+// authors or subjects, and members without any history get popular books.
+type RecommendationService struct {
+	Repo   *repositories.RecommendationRepository
+	Books  *repositories.BookRepository
+	Cache  *cache.Cache
+	Logger *logger.AsyncLogger
+}
+
+func NewRecommendationService(repo *repositories.RecommendationRepository, books *repositories.BookRepository, cache *cache.Cache, logger *logger.AsyncLogger) *RecommendationService {
+	return &RecommendationService{Repo: repo, Books: books, Cache: cache, Logger: logger}
+}
+
+// Similar recommends books like the book, for GET /books/{id}/similar.
+func (s *RecommendationService) Similar(bookID uint, limit int) ([]Recommendation, error) {
+	if _, err := s.Books.FindByID(bookID); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	generation, err := s.generation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := fmt.Sprintf("recs:similar:%s:%d:%d", generation, bookID, limit)
+	var results []ranked
+	if err := s.Cache.Get(cacheKey, &results); err != nil {
+		lists, err := s.model(ctx, generation, []uint{bookID})
+		if err != nil {
+			return nil, err
+		}
+		exclude := map[uint]bool{bookID: true}
+		results = tier(nil, recommend.Combine(lists, exclude, limit), ReasonReadTogether, exclude, limit)
+		if len(results) < limit {
+			related, err := s.Repo.Related([]uint{bookID}, limit)
+			if err != nil {
+				return nil, err
+			}
+			results = tier(results, related, ReasonRelated, exclude, limit)
+		}
+		s.Cache.Set(cacheKey, results, 10*time.Minute)
+	}
+	return s.load(results)
+}
+
+// ForMember recommends books the member hasn't read, for GET
+// /users/me/recommendations. Results are cached for a few minutes, so a
+// book just read can still show up briefly.
+func (s *RecommendationService) ForMember(userID uint, limit int) ([]Recommendation, error) {
+	ctx := context.Background()
+	generation, err := s.generation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := fmt.Sprintf("recs:user:%s:%d:%d", generation, userID, limit)
+	var results []ranked
+	if err := s.Cache.Get(cacheKey, &results); err != nil {
+		read, err := s.Repo.ReadBy(userID, maxHistory)
+		if err != nil {
+			return nil, err
+		}
+		exclude := make(map[uint]bool, len(read))
+		for _, id := range read {
+			exclude[id] = true
+		}
+		seeds := read
+		if len(seeds) > maxSeeds {
+			seeds = seeds[:maxSeeds]
+		}
+		if len(seeds) > 0 {
+			lists, err := s.model(ctx, generation, seeds)
+			if err != nil {
+				return nil, err
+			}
+			results = tier(results, recommend.Combine(lists, exclude, limit), ReasonReadTogether, exclude, limit)
+		}
+		if len(results) < limit && len(seeds) > 0 {
+			related, err := s.Repo.Related(seeds, limit+len(read)+len(results))
+			if err != nil {
+				return nil, err
+			}
+			results = tier(results, related, ReasonRelated, exclude, limit)
+		}
+		if len(results) < limit {
+			popular, err := s.Repo.Popular(read, limit+len(results))
+			if err != nil {
+				return nil, err
+			}
+			results = tier(results, popular, ReasonPopular, exclude, limit)
+		}
+		s.Cache.Set(cacheKey, results, 10*time.Minute)
+	}
+	return s.load(results)
+}
+
+// tier appends the scored books, with their reason, to results up to
+// limit, skipping excluded books and those already in results.
+func tier(results []ranked, scored []recommend.Scored, reason string, exclude map[uint]bool, limit int) []ranked {
+	for _, s := range scored {
+		if len(results) >= limit {
+			break
+		}
+		if exclude[s.BookID] {
+			continue
+		}
+		exclude[s.BookID] = true
+		results = append(results, ranked{BookID: s.BookID, Score: s.Score, Reason: reason})
+	}
+	return results
+}
+
+// load reads the ranked books, dropping those deleted since.
+func (s *RecommendationService) load(results []ranked) ([]Recommendation, error) {
+	recommendations := []Recommendation{}
+	if len(results) == 0 {
+		return recommendations, nil
+	}
+	ids := make([]uint, len(results))
+	byID := make(map[uint]ranked, len(results))
+	for i, r := range results {
+		ids[i] = r.BookID
+		byID[r.BookID] = r
+	}
+	books, err := s.Books.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, book := range books {
+		r := byID[book.ID]
+		recommendations = append(recommendations, Recommendation{Book: book, Score: r.Score, Reason: r.Reason})
+	}
+	return recommendations, nil
+}
+
+// generation is the current model's generation, or "" before the first
+// rebuild.
+func (s *RecommendationService) generation(ctx context.Context) (string, error) {
+	generation, err := s.Cache.Client.Get(ctx, recsModelKey).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return generation, err
+}
+
+// model reads the similar books of each book from the model.
+func (s *RecommendationService) model(ctx context.Context, generation string, bookIDs []uint) ([][]recommend.Scored, error) {
+	if generation == "" {
+		return nil, nil
+	}
+	keys := make([]string, len(bookIDs))
+	for i, id := range bookIDs {
+		keys[i] = modelKey(generation, id)
+	}
+	values, err := s.Cache.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var lists [][]recommend.Scored
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // Nothing was read with this book
+		}
+		var list []recommend.Scored
+		if err := json.Unmarshal([]byte(data), &list); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+func modelKey(generation string, bookID uint) string {
+	return fmt.Sprintf("recs:model:%s:%d", generation, bookID)
+}
+
+// Rebuild computes the model from every member's history and stores it
+// as a new generation, which readers switch to at once, then drops the
+// previous one. Keys expire after ttl in case rebuilds stop.
+func (s *RecommendationService) Rebuild(ctx context.Context, ttl time.Duration) (int, error) {
+	histories, err := s.Repo.Histories(maxHistory)
+	if err != nil {
+		return 0, err
+	}
+	model := recommend.Similar(histories, similarPerBook)
+
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+	pipe := s.Cache.Client.Pipeline()
+	for bookID, similar := range model {
+		data, err := json.Marshal(similar)
+		if err != nil {
+			return 0, err
+		}
+		pipe.Set(ctx, modelKey(generation, bookID), data, ttl)
+		if pipe.Len() >= 500 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	previous, err := s.Cache.Client.GetSet(ctx, recsModelKey, generation).Result()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if err := s.Cache.Client.Expire(ctx, recsModelKey, ttl).Err(); err != nil {
+		return 0, err
+	}
+	if previous != "" {
+		iter := s.Cache.Client.Scan(ctx, 0, "recs:model:"+previous+":*", 500).Iterator()
+		for iter.Next(ctx) {
+			if err := s.Cache.Client.Del(ctx, iter.Val()).Err(); err != nil {
+				return 0, err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return len(model), nil
+}
+
+// RunRebuilder rebuilds the model at start and every interval. Replicas
+// take a lock so only one of them rebuilds each time.
+func (s *RecommendationService) RunRebuilder(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if locked, err := s.Cache.SetNX(recsRebuildLock, true, interval/2); err != nil {
+			s.Logger.Log(fmt.Sprintf("Recommendation rebuild failed: %v", err))
+		} else if locked {
+			if n, err := s.Rebuild(ctx, 3*interval); err != nil {
+				s.Logger.Log(fmt.Sprintf("Recommendation rebuild failed: %v", err))
+			} else {
+				s.Logger.Log(fmt.Sprintf("Rebuilt recommendations for %d books", n))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/events"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+var (
+	ErrNotReviewAuthor = errors.New("only the review's author can change it")
+	ErrNotBorrower     = errors.New("only members who borrowed the book can review it")
+)
+
+// Borrowers tells whether a member has borrowed a book, which is what
+// entitles them to review it. repositories.LoanRepository is one.
+type Borrowers interface {
+	HasBorrowed(userID, bookID uint) (bool, error)
+}
+
+// ReviewExistsError means the member has already reviewed the book; they
+// edit that review instead.
+type ReviewExistsError struct {
+	ReviewID uint
+}
+
+func (e *ReviewExistsError) Error() string {
+	return fmt.Sprintf("already reviewed in review %d", e.ReviewID)
+}
+
+// Reviewer is who acts on a review. Moderators (staff and admins) can hide
+// and delete anyone's review.
+type Reviewer struct {
+	UserID    uint
+	Moderator bool
+}
+
+// ReviewService manages members' reviews of books. Every change updates
+// the book's rating_average and rating_count. Only members Borrowers says
+// have borrowed a book can review it; without Borrowers nobody can.
+type ReviewService struct {
+	Repo      *repositories.ReviewRepository
+	Books     *repositories.BookRepository
+	Borrowers Borrowers
+}
+
+func NewReviewService(repo *repositories.ReviewRepository, books *repositories.BookRepository, borrowers Borrowers) *ReviewService {
+	return &ReviewService{Repo: repo, Books: books, Borrowers: borrowers}
+}
+
+func (s *ReviewService) ListReviews(filter repositories.ReviewFilter, limit, offset int) ([]models.Review, error) {
+	return s.Repo.FindAll(filter, limit, offset)
+}
+
+// ListBookReviews lists the book's visible reviews.
+func (s *ReviewService) ListBookReviews(bookID uint, limit, offset int) ([]models.Review, error) {
+	if _, err := s.Books.FindByID(bookID); err != nil {
+		return nil, err
+	}
+	hidden := false
+	return s.Repo.FindAll(repositories.ReviewFilter{BookID: bookID, Hidden: &hidden}, limit, offset)
+}
+
+// GetReview finds a review. Hidden reviews are only found by moderators
+// and by their author.
+func (s *ReviewService) GetReview(id uint, by Reviewer) (*models.Review, error) {
+	review, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if review.Hidden && !by.Moderator && review.UserID != by.UserID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return review, nil
+}
+
+func (s *ReviewService) CreateReview(bookID uint, by Reviewer, rating int, text string) (*models.Review, error) {
+	if _, err := s.Books.FindByID(bookID); err != nil {
+		return nil, err
+	}
+	if existing, err := s.Repo.FindByBookAndUser(bookID, by.UserID); err == nil {
+		return nil, &ReviewExistsError{ReviewID: existing.ID}
+	}
+	if s.Borrowers == nil {
+		return nil, ErrNotBorrower
+	}
+	borrowed, err := s.Borrowers.HasBorrowed(by.UserID, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if !borrowed {
+		return nil, ErrNotBorrower
+	}
+	review := &models.Review{BookID: bookID, UserID: by.UserID, Rating: rating, Text: strings.TrimSpace(text)}
+	if err := s.Repo.Create(review, newEvent(events.ReviewCreated, review)); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// Lost a race with the same member's other request
+			if existing, findErr := s.Repo.FindByBookAndUser(bookID, by.UserID); findErr == nil {
+				return nil, &ReviewExistsError{ReviewID: existing.ID}
+			}
+		}
+		return nil, err
+	}
+	return s.Repo.FindByID(review.ID)
+}
+
+// UpdateReview changes the rating and text. Only the author can; a hidden
+// review stays hidden until a moderator shows it again.
+func (s *ReviewService) UpdateReview(id uint, by Reviewer, rating int, text string) (*models.Review, error) {
+	review, err := s.GetReview(id, by)
+	if err != nil {
+		return nil, err
+	}
+	if review.UserID != by.UserID {
+		return nil, ErrNotReviewAuthor
+	}
+	review.Rating, review.Text = rating, strings.TrimSpace(text)
+	if err := s.Repo.Update(review, newEvent(events.ReviewUpdated, review)); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// DeleteReview deletes the review, for its author or a moderator.
+func (s *ReviewService) DeleteReview(id uint, by Reviewer) error {
+	review, err := s.GetReview(id, by)
+	if err != nil {
+		return err
+	}
+	if review.UserID != by.UserID && !by.Moderator {
+		return ErrNotReviewAuthor
+	}
+	return s.Repo.Delete(review, newEvent(events.ReviewDeleted, review))
+}
+
+// HideReview takes the review out of listings and of the book's rating,
+// noting the moderator and their reason; hidden false shows it again.
+func (s *ReviewService) HideReview(id uint, moderatorID uint, hidden bool, reason string) (*models.Review, error) {
+	review, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	review.Hidden, review.HiddenReason, review.HiddenBy, review.HiddenAt = false, "", nil, nil
+	if hidden {
+		now := time.Now()
+		review.Hidden, review.HiddenReason, review.HiddenBy, review.HiddenAt = true, strings.TrimSpace(reason), &moderatorID, &now
+	}
+	if err := s.Repo.SetHidden(review, newEvent(events.ReviewUpdated, review)); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"library-api/events"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+// MaxSeriesBooks caps the books GetSeries returns; long-running series
+// with many editions per volume are still well below it.
+const MaxSeriesBooks = 1000
+
+type SeriesService struct {
+	Repo *repositories.SeriesRepository
+}
+
+func NewSeriesService(repo *repositories.SeriesRepository) *SeriesService {
+	return &SeriesService{Repo: repo}
+}
+
+func (s *SeriesService) ListSeries(query string, limit, offset int) ([]models.Series, error) {
+	return s.Repo.FindAll(query, limit, offset)
+}
+
+// GetSeries returns the series and its books in volume order.
+func (s *SeriesService) GetSeries(id uint) (*models.Series, []models.Book, error) {
+	series, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	books, err := s.Repo.FindBooks(id, MaxSeriesBooks)
+	return series, books, err
+}
+
+func (s *SeriesService) CreateSeries(series *models.Series) (*models.Series, error) {
+	if err := s.Repo.Create(series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+func (s *SeriesService) UpdateSeries(id uint, update models.Series) (*models.Series, error) {
+	series, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	series.Title = update.Title
+	series.Description = update.Description
+	if err := s.Repo.Update(series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// DeleteSeries deletes the series and takes its books out of it.
+func (s *SeriesService) DeleteSeries(id uint) error {
+	series, err := s.Repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return s.Repo.Delete(series, newEvent(events.SeriesDeleted, series))
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"library-api/events"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+var (
+	ErrUnknownParent      = errors.New("parent subject does not exist")
+	ErrSubjectCycle       = errors.New("a subject can't be moved below itself")
+	ErrSubjectHasChildren = errors.New("subject has child subjects")
+	ErrTagTaken           = errors.New("another tag has this name")
+)
+
+// TaxonomyService manages subject trees and tags. Books are linked to them
+// by name when they are saved, see BookService.
+type TaxonomyService struct {
+	Repo *repositories.TaxonomyRepository
+}
+
+func NewTaxonomyService(repo *repositories.TaxonomyRepository) *TaxonomyService {
+	return &TaxonomyService{Repo: repo}
+}
+
+// SubjectInput is what callers set on a subject. Kind is ignored below a
+// parent; children have their parent's kind.
+type SubjectInput struct {
+	Name     string
+	Kind     string
+	ParentID *uint
+}
+
+func (s *TaxonomyService) ListSubjects(filter repositories.SubjectFilter, limit, offset int) ([]models.Subject, error) {
+	return s.Repo.FindSubjects(filter, limit, offset)
+}
+
+func (s *TaxonomyService) GetSubject(id uint) (*models.Subject, error) {
+	return s.Repo.FindSubject(id)
+}
+
+func (s *TaxonomyService) CreateSubject(input SubjectInput) (*models.Subject, error) {
+	subject := &models.Subject{Name: strings.TrimSpace(input.Name), Kind: input.Kind, ParentID: input.ParentID}
+	parent, err := s.parent(subject)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.CreateSubject(subject, parent); err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
+// UpdateSubject renames or moves a subject. Books listing it by its old
+// name show the new one.
+func (s *TaxonomyService) UpdateSubject(id uint, input SubjectInput) (*models.Subject, error) {
+	subject, err := s.Repo.FindSubject(id)
+	if err != nil {
+		return nil, err
+	}
+	oldName := subject.Name
+	subject.Name = strings.TrimSpace(input.Name)
+	subject.Kind = input.Kind
+	subject.ParentID = input.ParentID
+	parent, err := s.parent(subject)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil && strings.HasPrefix(parent.Path, subject.Path) {
+		return nil, ErrSubjectCycle
+	}
+	if err := s.Repo.UpdateSubject(subject, oldName, parent, newEvent(events.SubjectUpdated, subject)); err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
+// parent loads the subject's parent, if it has one, and gives the subject
+// the parent's kind.
+func (s *TaxonomyService) parent(subject *models.Subject) (*models.Subject, error) {
+	if subject.Kind == "" {
+		subject.Kind = models.SubjectKindSubject
+	}
+	if subject.ParentID == nil {
+		return nil, nil
+	}
+	parent, err := s.Repo.FindSubject(*subject.ParentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownParent
+	}
+	if err != nil {
+		return nil, err
+	}
+	subject.Kind = parent.Kind
+	return parent, nil
+}
+
+// DeleteSubject deletes a subject that has no children and takes it off
+// its books.
+func (s *TaxonomyService) DeleteSubject(id uint) error {
+	subject, err := s.Repo.FindSubject(id)
+	if err != nil {
+		return err
+	}
+	children, err := s.Repo.CountChildren(id)
+	if err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrSubjectHasChildren
+	}
+	return s.Repo.DeleteSubject(subject, newEvent(events.SubjectDeleted, subject))
+}
+
+func (s *TaxonomyService) ListTags(query string, limit, offset int) ([]models.Tag, error) {
+	return s.Repo.FindTags(query, limit, offset)
+}
+
+func (s *TaxonomyService) GetTag(id uint) (*models.Tag, error) {
+	return s.Repo.FindTag(id)
+}
+
+func (s *TaxonomyService) CreateTag(name string) (*models.Tag, error) {
+	tag := &models.Tag{Name: repositories.NormalizeTag(name)}
+	if err := s.Repo.CreateTag(tag); err != nil {
+		return nil, tagTaken(err)
+	}
+	return tag, nil
+}
+
+// RenameTag renames the tag everywhere it is used.
+func (s *TaxonomyService) RenameTag(id uint, name string) (*models.Tag, error) {
+	tag, err := s.Repo.FindTag(id)
+	if err != nil {
+		return nil, err
+	}
+	name = repositories.NormalizeTag(name)
+	if name == tag.Name {
+		return tag, nil
+	}
+	if err := s.Repo.RenameTag(tag, name, newEvent(events.TagUpdated, tag)); err != nil {
+		return nil, tagTaken(err)
+	}
+	return tag, nil
+}
+
+func (s *TaxonomyService) DeleteTag(id uint) error {
+	tag, err := s.Repo.FindTag(id)
+	if err != nil {
+		return err
+	}
+	return s.Repo.DeleteTag(tag, newEvent(events.TagDeleted, tag))
+}
+
+func tagTaken(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrTagTaken
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/events"
+	"library-api/logger"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+// TrashService manages soft-deleted books and users: admins list them,
+// restore them or purge them for good, and RunPurger purges those deleted
+// longer ago than the retention period.
+type TrashService struct {
+	Books  *repositories.BookRepository
+	Users  *repositories.UserRepository
+	Covers *CoverService
+	Logger *logger.AsyncLogger
+}
+
+func NewTrashService(books *repositories.BookRepository, users *repositories.UserRepository, covers *CoverService, logger *logger.AsyncLogger) *TrashService {
+	return &TrashService{Books: books, Users: users, Covers: covers, Logger: logger}
+}
+
+func (s *TrashService) ListBooks(limit, offset int) ([]models.Book, error) {
+	return s.Books.FindAllDeleted(limit, offset)
+}
+
+// RestoreBook undeletes the book. Its ISBN stays reserved while it is
+// deleted, so no live book can normally hold it; if one does, the unique
+// index refuses the restore and the error names that book. A cover whose
+// files are gone, such as one deleted along with the book before covers
+// were kept until purge, is taken off the book.
+func (s *TrashService) RestoreBook(ctx context.Context, id uint) (*models.Book, error) {
+	book, err := s.Books.FindDeleted(id)
+	if err != nil {
+		return nil, err
+	}
+	if book.CoverKey != "" {
+		found, err := s.Covers.HasFiles(ctx, book.CoverKey)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			book.CoverKey, book.CoverType, book.CoverUpdatedAt = "", "", nil
+		}
+	}
+	if err := s.Books.Restore(book, newEvent(events.BookRestored, book)); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) && book.ISBN13 != nil {
+			if existing, findErr := s.Books.FindByISBN(*book.ISBN13, false); findErr == nil {
+				return nil, &DuplicateISBNError{ISBN: *book.ISBN13, BookID: existing.ID}
+			}
+		}
+		return nil, err
+	}
+	return book, nil
+}
+
+// PurgeBook deletes a deleted book for good. Its cover files are deleted
+// once that has committed.
+func (s *TrashService) PurgeBook(id uint) error {
+	book, err := s.Books.FindDeleted(id)
+	if err != nil {
+		return err
+	}
+	return s.Books.Purge(id, newEvent(events.BookPurged, events.BookPurgedData{ID: id, CoverKey: book.CoverKey}))
+}
+
+// ListUsers lists deleted users, without their password hashes.
+func (s *TrashService) ListUsers(limit, offset int) ([]models.User, error) {
+	users, err := s.Users.FindAllDeleted(limit, offset)
+	for i := range users {
+		users[i].Password = ""
+	}
+	return users, err
+}
+
+// RestoreUser undeletes the user. The unique index keeps their username
+// reserved while they are deleted, and refuses the restore with
+// ErrUsernameTaken should a live user hold it anyway.
+func (s *TrashService) RestoreUser(id uint) (*models.User, error) {
+	user, err := s.Users.FindDeleted(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Users.Restore(user); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// PurgeUser deletes a deleted user for good, with their collections and
+// reviews.
+func (s *TrashService) PurgeUser(id uint) error {
+	return s.Users.Purge(id, newEvent(events.UserPurged, events.UserPurgedData{ID: id}))
+}
+
+// purgeBatch is how many records of each kind the purger reads at a time.
+const purgeBatch = 100
+
+// RunPurger purges books and users deleted more than retention ago, at
+// start and every interval. Replicas can run it side by side: a record
+// purged by one is skipped by the others.
+func (s *TrashService) RunPurger(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if books, users, err := s.PurgeExpired(time.Now().Add(-retention)); err != nil {
+			s.Logger.Log(fmt.Sprintf("Trash purge failed: %v", err))
+		} else if books+users > 0 {
+			s.Logger.Log(fmt.Sprintf("Purged %d books and %d users from the trash", books, users))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired purges books and users deleted before cutoff and returns
+// how many of each it purged.
+func (s *TrashService) PurgeExpired(cutoff time.Time) (books, users int, err error) {
+	for {
+		expired, err := s.Books.FindDeletedBefore(cutoff, purgeBatch)
+		if err != nil {
+			return books, users, err
+		}
+		if len(expired) == 0 {
+			break
+		}
+		for _, book := range expired {
+			err := s.Books.Purge(book.ID, newEvent(events.BookPurged, events.BookPurgedData{ID: book.ID, CoverKey: book.CoverKey}))
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // Restored or purged by someone else meanwhile
+			}
+			if err != nil {
+				return books, users, err
+			}
+			books++
+		}
+	}
+	for {
+		expired, err := s.Users.FindDeletedBefore(cutoff, purgeBatch)
+		if err != nil {
+			return books, users, err
+		}
+		if len(expired) == 0 {
+			break
+		}
+		for _, user := range expired {
+			err := s.PurgeUser(user.ID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return books, users, err
+			}
+			users++
+		}
+	}
+	return books, users, nil
+}
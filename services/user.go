@@ -1,14 +1,23 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
     "time"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 	"library-api/email"
+	"library-api/events"
 	"library-api/models"
 	"library-api/repositories"
 )
 
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// ErrDeleteSelf keeps admins from locking themselves out.
+var ErrDeleteSelf = errors.New("admins can't delete their own account")
+
 type UserService struct {
 	Repo        *repositories.UserRepository
 	EmailService *email.EmailService // New
@@ -27,18 +36,48 @@ func (s *UserService) CreateUser(username, password, email string) (*models.User
 		Username: username,
 		Password: string(hashedPassword),
 		Email:    email, // New
+		Role:     models.RoleMember,
+	}
+	// The welcome email follows from the event, see RegisterHandlers
+	registered := func() (*models.OutboxEvent, error) {
+		return events.New(events.UserRegistered, events.UserRegisteredData{UserID: user.ID, Username: user.Username, Email: user.Email})
 	}
-	if err := s.Repo.Create(user); err != nil {
+	if err := s.Repo.Create(user, registered); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrUsernameTaken
+		}
 		return nil, err
 	}
-	// Send welcome email
-	// Send welcome email with a unique ID
-	s.EmailService.Send(email, "Welcome to the Library!",
-		fmt.Sprintf("Hi %s, welcome to our library system!", username),
-		fmt.Sprintf("welcome_%s_%d", username, time.Now().Unix()))
 	return user, nil
 }
 
+// DeleteUser soft-deletes the user, who can no longer log in. Admins can
+// restore the account from the trash until it is purged.
+func (s *UserService) DeleteUser(id, callerID uint) error {
+	if id == callerID {
+		return ErrDeleteSelf
+	}
+	return s.Repo.Delete(id)
+}
+
+// RegisterHandlers subscribes the side effects of account changes.
+func (s *UserService) RegisterHandlers(d *events.Dispatcher) {
+	d.Handle("welcome_email", s.sendWelcome, events.UserRegistered)
+}
+
+func (s *UserService) sendWelcome(ctx context.Context, event events.Event) error {
+	var data events.UserRegisteredData
+	if err := event.Decode(&data); err != nil {
+		return err
+	}
+	if data.Email == "" {
+		return nil
+	}
+	// The event ID keeps the email ID stable if the event is handled again
+	return s.EmailService.SendTemplate(data.Email, "welcome", map[string]interface{}{"Username": data.Username},
+		fmt.Sprintf("welcome_%d", event.ID))
+}
+
 func (s *UserService) Login(username, password string) (*models.User, error) {
 	user, err := s.Repo.FindByUsername(username)
 	if err != nil {
@@ -47,5 +86,8 @@ func (s *UserService) Login(username, password string) (*models.User, error) {
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
 		return nil, err
 	}
+	now := time.Now()
+	user.LastLoginAt = &now
+	s.Repo.TouchLastLogin(user.ID, now)
 	return user, nil
 }
\ No newline at end of file
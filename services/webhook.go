@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"library-api/events"
+	"library-api/logger"
+	"library-api/models"
+	"library-api/repositories"
+	"library-api/webhook"
+)
+
+var (
+	ErrInvalidWebhookURL    = errors.New("url must be an absolute http or https URL")
+	ErrInvalidWebhookEvents = errors.New("events must list at least one known event type")
+)
+
+// WebhookService manages subscriptions and delivers events to them. Publish
+// only queues deliveries in the database; RunDispatcher sends them.
+type WebhookService struct {
+	Repo        *repositories.WebhookRepository
+	Sender      *webhook.Sender
+	Logger      *logger.AsyncLogger
+	Concurrency int // Deliveries sent at once per dispatcher tick
+}
+
+func NewWebhookService(repo *repositories.WebhookRepository, sender *webhook.Sender, logger *logger.AsyncLogger) *WebhookService {
+	return &WebhookService{Repo: repo, Sender: sender, Logger: logger, Concurrency: 4}
+}
+
+// CreateWebhook validates and stores a subscription, generating a secret if
+// none was given.
+func (s *WebhookService) CreateWebhook(hook *models.Webhook) (*models.Webhook, error) {
+	if err := validateWebhook(hook); err != nil {
+		return nil, err
+	}
+	if hook.Secret == "" {
+		hook.Secret = webhook.NewSecret()
+	}
+	hook.Active = true
+	if err := s.Repo.Create(hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (s *WebhookService) ListWebhooks() ([]models.Webhook, error) {
+	return s.Repo.FindAll()
+}
+
+func (s *WebhookService) GetWebhook(id uint) (*models.Webhook, error) {
+	return s.Repo.FindByID(id)
+}
+
+// UpdateWebhook replaces the URL, events and active flag. An empty secret
+// keeps the current one.
+func (s *WebhookService) UpdateWebhook(id uint, update models.Webhook) (*models.Webhook, error) {
+	hook, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhook(&update); err != nil {
+		return nil, err
+	}
+	hook.URL = update.URL
+	hook.Events = update.Events
+	hook.Active = update.Active
+	if update.Secret != "" {
+		hook.Secret = update.Secret
+	}
+	if err := s.Repo.Update(hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (s *WebhookService) DeleteWebhook(id uint) error {
+	if _, err := s.Repo.FindByID(id); err != nil {
+		return err
+	}
+	return s.Repo.Delete(id)
+}
+
+func (s *WebhookService) ListDeliveries(webhookID uint, limit, offset int) ([]models.WebhookDelivery, error) {
+	if _, err := s.Repo.FindByID(webhookID); err != nil {
+		return nil, err
+	}
+	return s.Repo.FindDeliveries(webhookID, limit, offset)
+}
+
+// Redeliver queues a fresh copy of a past delivery. The original stays in
+// the log as it was.
+func (s *WebhookService) Redeliver(webhookID, deliveryID uint) (*models.WebhookDelivery, error) {
+	original, err := s.Repo.FindDelivery(webhookID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	copied := []models.WebhookDelivery{{
+		WebhookID:     webhookID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+		RedeliveryOf:  &original.ID,
+	}}
+	if err := s.Repo.CreateDeliveries(copied); err != nil {
+		return nil, err
+	}
+	return &copied[0], nil
+}
+
+// RegisterHandlers makes webhooks a sink for domain events. Events that
+// aren't webhook event types are skipped.
+func (s *WebhookService) RegisterHandlers(d *events.Dispatcher) {
+	d.Handle("webhooks", func(ctx context.Context, event events.Event) error {
+		if !webhook.ValidEvent(event.Type) {
+			return nil
+		}
+		return s.Publish(event.Type, event.Data)
+	})
+}
+
+// Publish queues event for every active webhook subscribed to it. It never
+// waits on the receivers; RunDispatcher sends the deliveries.
+func (s *WebhookService) Publish(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	hooks, err := s.Repo.FindActive()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var deliveries []models.WebhookDelivery
+	for _, hook := range hooks {
+		if subscribed(hook, event) {
+			deliveries = append(deliveries, models.WebhookDelivery{
+				WebhookID:     hook.ID,
+				Event:         event,
+				Payload:       string(payload),
+				Status:        models.DeliveryPending,
+				NextAttemptAt: now,
+			})
+		}
+	}
+	return s.Repo.CreateDeliveries(deliveries)
+}
+
+// RunDispatcher sends due deliveries every interval until ctx is cancelled.
+// Several replicas can run it; each delivery is claimed before sending.
+func (s *WebhookService) RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.dispatchDue(ctx)
+		}
+	}
+}
+
+func (s *WebhookService) dispatchDue(ctx context.Context) {
+	due, err := s.Repo.FindDue(time.Now(), 100)
+	if err != nil {
+		s.Logger.Log(fmt.Sprintf("Failed to load due webhook deliveries: %v", err))
+		return
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.Concurrency)
+	for i := range due {
+		// Hold the claim for longer than a send can take
+		claimed, err := s.Repo.ClaimDelivery(&due[i], time.Now().Add(s.Sender.Client.Timeout+time.Minute))
+		if err != nil || !claimed {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.deliver(ctx, delivery)
+		}(&due[i])
+	}
+	wg.Wait()
+}
+
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	hook, err := s.Repo.FindByID(delivery.WebhookID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !hook.Active) {
+		// Deleted or switched off since the event: give up without retrying
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "webhook was deleted or deactivated"
+		if err := s.Repo.UpdateDelivery(delivery); err != nil {
+			s.Logger.Log(fmt.Sprintf("Failed to record webhook delivery %d: %v", delivery.ID, err))
+		}
+		return
+	}
+	status := 0
+	if err == nil {
+		status, err = s.Sender.Send(ctx, webhook.Delivery{
+			ID:        delivery.ID,
+			Event:     delivery.Event,
+			URL:       hook.URL,
+			Secret:    hook.Secret,
+			Data:      []byte(delivery.Payload),
+			CreatedAt: delivery.CreatedAt,
+		})
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = status
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= webhook.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(webhook.Backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+	if err := s.Repo.UpdateDelivery(delivery); err != nil {
+		s.Logger.Log(fmt.Sprintf("Failed to record webhook delivery %d: %v", delivery.ID, err))
+	}
+}
+
+func validateWebhook(hook *models.Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	events := WebhookEvents(*hook)
+	if len(events) == 0 {
+		return ErrInvalidWebhookEvents
+	}
+	for _, event := range events {
+		if !webhook.ValidEvent(event) {
+			return ErrInvalidWebhookEvents
+		}
+	}
+	hook.Events = strings.Join(events, ",")
+	return nil
+}
+
+// WebhookEvents splits the stored comma-separated event list.
+func WebhookEvents(hook models.Webhook) []string {
+	var events []string
+	for _, event := range strings.Split(hook.Events, ",") {
+		if event = strings.TrimSpace(event); event != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func subscribed(hook models.Webhook, event string) bool {
+	for _, e := range WebhookEvents(hook) {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+
+	"library-api/events"
+	"library-api/models"
+	"library-api/repositories"
+)
+
+var ErrUnknownBook = errors.New("book does not exist")
+
+// WorkService groups editions into works. Editions are plain books with a
+// work_id, so they are listed and cached like any book listing.
+type WorkService struct {
+	Repo  *repositories.WorkRepository
+	Books *BookService
+}
+
+func NewWorkService(repo *repositories.WorkRepository, books *BookService) *WorkService {
+	return &WorkService{Repo: repo, Books: books}
+}
+
+func (s *WorkService) ListWorks(query string, limit, offset int) ([]models.Work, error) {
+	return s.Repo.FindAll(query, limit, offset)
+}
+
+// GetWork returns the work and how many editions it has.
+func (s *WorkService) GetWork(id uint) (*models.Work, int64, error) {
+	work, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	editions, err := s.Repo.CountEditions(id)
+	return work, editions, err
+}
+
+func (s *WorkService) CreateWork(work *models.Work) (*models.Work, error) {
+	if err := s.Repo.Create(work); err != nil {
+		return nil, err
+	}
+	return work, nil
+}
+
+func (s *WorkService) UpdateWork(id uint, update models.Work) (*models.Work, error) {
+	work, err := s.Repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	work.Title = update.Title
+	work.Description = update.Description
+	if err := s.Repo.Update(work); err != nil {
+		return nil, err
+	}
+	return work, nil
+}
+
+// DeleteWork deletes the work and leaves its editions without one.
+func (s *WorkService) DeleteWork(id uint) error {
+	work, err := s.Repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return s.Repo.Delete(work, newEvent(events.WorkDeleted, work))
+}
+
+func (s *WorkService) GetEditions(id uint, limit, offset int) ([]models.Book, error) {
+	if _, err := s.Repo.FindByID(id); err != nil {
+		return nil, err
+	}
+	return s.Books.GetBooks(repositories.BookFilter{WorkID: id}, limit, offset)
+}
+
+// AddEditions makes existing books editions of the work, moving them from
+// the work they were in, if any.
+func (s *WorkService) AddEditions(id uint, bookIDs []uint) error {
+	if _, err := s.Repo.FindByID(id); err != nil {
+		return err
+	}
+	bookIDs = uniqueIDs(bookIDs)
+	existing, err := s.Books.Repo.CountExisting(bookIDs)
+	if err != nil {
+		return err
+	}
+	if existing != int64(len(bookIDs)) {
+		return ErrUnknownBook
+	}
+	data := events.EditionsAddedData{WorkID: id, BookIDs: bookIDs}
+	return s.Repo.AddEditions(id, bookIDs, newEvent(events.EditionsAdded, data))
+}
+
+func uniqueIDs(ids []uint) []uint {
+	unique := make([]uint, 0, len(ids))
+	seen := map[uint]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,38 @@
+// Package storage keeps binary objects, such as cover images, by key. Keys
+// are slash-separated paths like covers/12/1700000000/small.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Storage is where objects live: the local filesystem or an S3-compatible
+// bucket.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens the object and returns its size. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Delete removes the object; a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey rejects keys that could escape the storage root.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
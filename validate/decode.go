@@ -0,0 +1,87 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"library-api/apperror"
+)
+
+// MaxBodyBytes is the default limit for JSON request bodies.
+const MaxBodyBytes = 1 << 20
+
+// DecodeJSON strictly decodes the request body into dst and validates it
+// with Struct. Unknown fields, trailing data, bodies over MaxBodyBytes and
+// values of the wrong type are all rejected with an *apperror.Error.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	return DecodeJSONLimit(w, r, dst, MaxBodyBytes)
+}
+
+func DecodeJSONLimit(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64) error {
+	return decodeStrict(http.MaxBytesReader(w, r.Body, limit), dst, limit)
+}
+
+// Unmarshal applies the same rules as DecodeJSON to a document that is
+// already in memory, such as the result of applying a patch.
+func Unmarshal(data []byte, dst interface{}) error {
+	return decodeStrict(bytes.NewReader(data), dst, int64(len(data)))
+}
+
+func decodeStrict(body io.Reader, dst interface{}, limit int64) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err, limit)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return apperror.BadRequest("Request body must contain a single JSON object")
+	}
+	if errs := Struct(dst); len(errs) > 0 {
+		return apperror.InvalidFields(errs)
+	}
+	return nil
+}
+
+func decodeError(err error, limit int64) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		return apperror.BadRequest("Request body is empty")
+	case errors.As(err, &tooLarge):
+		return apperror.New(http.StatusRequestEntityTooLarge, apperror.CodeBodyTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", limit))
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return apperror.BadRequest("Request body is not valid JSON")
+	case errors.As(err, &typeErr):
+		return apperror.InvalidFields([]apperror.FieldError{{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: "must be a " + jsonType(typeErr.Type.Kind().String()),
+		}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no type for this one
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return apperror.InvalidFields([]apperror.FieldError{{Field: field, Code: "unknown_field", Message: "is not a known field"}})
+	}
+	return apperror.BadRequest("Request body could not be decoded")
+}
+
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "slice" || kind == "array":
+		return "list"
+	case kind == "struct" || kind == "map":
+		return "object"
+	case kind == "bool":
+		return "boolean"
+	}
+	return kind
+}
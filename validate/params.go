@@ -0,0 +1,122 @@
+package validate
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"library-api/apperror"
+)
+
+// Params reads path and query parameters and collects every problem, so a
+// client sees all of them at once:
+//
+//	p := validate.NewParams(r)
+//	id := p.PathID("id")
+//	limit := p.QueryInt("limit", 10, 1, 100)
+//	if err := p.Err(); err != nil { ... }
+type Params struct {
+	r    *http.Request
+	errs []apperror.FieldError
+}
+
+func NewParams(r *http.Request) *Params {
+	return &Params{r: r}
+}
+
+// PathID parses a positive integer ID from the route.
+func (p *Params) PathID(name string) uint {
+	raw := mux.Vars(p.r)[name]
+	id, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil || id == 0 {
+		p.add(name, "invalid_id", "must be a positive integer")
+		return 0
+	}
+	return uint(id)
+}
+
+// PathString returns a required route value.
+func (p *Params) PathString(name string) string {
+	value := mux.Vars(p.r)[name]
+	if value == "" {
+		p.add(name, "required", "is required")
+	}
+	return value
+}
+
+// QueryInt parses an optional integer within [min, max], returning def when absent.
+func (p *Params) QueryInt(name string, def, min, max int) int {
+	raw := p.r.URL.Query().Get(name)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		p.add(name, "invalid_type", "must be an integer")
+		return def
+	}
+	if value < min || value > max {
+		p.add(name, "out_of_range", "must be between "+strconv.Itoa(min)+" and "+strconv.Itoa(max))
+		return def
+	}
+	return value
+}
+
+// QueryString returns a query value, recording an error if it is required and missing.
+func (p *Params) QueryString(name string, required bool) string {
+	value := p.r.URL.Query().Get(name)
+	if value == "" && required {
+		p.add(name, "required", "is required")
+	}
+	return value
+}
+
+// QueryOneOf returns a query value that must be one of allowed, or def when absent.
+func (p *Params) QueryOneOf(name, def string, allowed ...string) string {
+	value := p.r.URL.Query().Get(name)
+	if value == "" {
+		return def
+	}
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	p.add(name, "not_allowed", "must be one of "+strings.Join(allowed, ", "))
+	return def
+}
+
+// QueryBool parses an optional boolean, returning false when absent.
+func (p *Params) QueryBool(name string) bool {
+	raw := p.r.URL.Query().Get(name)
+	if raw == "" {
+		return false
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		p.add(name, "invalid_type", "must be true or false")
+	}
+	return value
+}
+
+// QueryOptionalBool parses an optional boolean, returning nil when absent.
+func (p *Params) QueryOptionalBool(name string) *bool {
+	if p.r.URL.Query().Get(name) == "" {
+		return nil
+	}
+	value := p.QueryBool(name)
+	return &value
+}
+
+// Err returns every problem found so far as one 400, or nil.
+func (p *Params) Err() error {
+	if len(p.errs) == 0 {
+		return nil
+	}
+	return apperror.InvalidParams(p.errs)
+}
+
+func (p *Params) add(field, code, message string) {
+	p.errs = append(p.errs, apperror.FieldError{Field: field, Code: code, Message: message})
+}
@@ -0,0 +1,163 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"library-api/apperror"
+	"library-api/isbn"
+)
+
+// Struct checks v, a pointer to a struct, against the rules in its
+// `validate` tags and returns every broken rule. Rules are comma-separated:
+//
+//	required     not empty: non-blank string, non-empty slice or map, non-nil pointer
+//	min=N, max=N length of strings (in characters) and slices, value of numbers
+//	email        a plain address like ada@example.com
+//	url          an absolute http or https URL
+//	oneof=a|b    one of the listed values
+//	isbn         a valid ISBN-10 or ISBN-13, hyphens allowed
+//
+// Rules other than required pass for empty values, so optional fields only
+// need to be valid when present. Nested structs are checked too, including
+// those in slices, with paths like contributors[0].role.
+func Struct(v interface{}) []apperror.FieldError {
+	var errs []apperror.FieldError
+	checkStruct(reflect.Indirect(reflect.ValueOf(v)), "", &errs)
+	return errs
+}
+
+func checkStruct(v reflect.Value, prefix string, errs *[]apperror.FieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		value := v.Field(i)
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			checkStruct(value, prefix, errs)
+			continue
+		}
+		path := prefix + name
+		if rules := field.Tag.Get("validate"); rules != "" {
+			checkField(value, path, rules, errs)
+		}
+		inner := reflect.Indirect(value)
+		if inner.Kind() == reflect.Struct && inner.Type().PkgPath() != "time" {
+			checkStruct(inner, path+".", errs)
+		}
+		if inner.Kind() == reflect.Slice && inner.Type().Elem().Kind() == reflect.Struct {
+			for j := 0; j < inner.Len(); j++ {
+				checkStruct(inner.Index(j), fmt.Sprintf("%s[%d].", path, j), errs)
+			}
+		}
+	}
+}
+
+func checkField(v reflect.Value, path, rules string, errs *[]apperror.FieldError) {
+	empty := isEmpty(v)
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			if empty {
+				*errs = append(*errs, apperror.FieldError{Field: path, Code: "required", Message: "is required"})
+				return
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+		if err := checkRule(reflect.Indirect(v), name, arg); err != nil {
+			err.Field = path
+			*errs = append(*errs, *err)
+			return // One error per field is enough
+		}
+	}
+}
+
+func checkRule(v reflect.Value, name, arg string) *apperror.FieldError {
+	switch name {
+	case "min", "max":
+		limit, _ := strconv.ParseFloat(arg, 64)
+		size, unit := measure(v)
+		if name == "min" && size < limit {
+			return &apperror.FieldError{Code: "too_small", Message: fmt.Sprintf("must be at least %s%s", arg, unit)}
+		}
+		if name == "max" && size > limit {
+			return &apperror.FieldError{Code: "too_large", Message: fmt.Sprintf("must be at most %s%s", arg, unit)}
+		}
+	case "email":
+		addr, err := mail.ParseAddress(v.String())
+		if err != nil || addr.Address != v.String() || addr.Name != "" {
+			return &apperror.FieldError{Code: "invalid_email", Message: "must be a valid email address"}
+		}
+	case "url":
+		u, err := url.Parse(v.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &apperror.FieldError{Code: "invalid_url", Message: "must be an absolute http or https URL"}
+		}
+	case "isbn":
+		if _, err := isbn.Normalize(v.String()); err != nil {
+			return &apperror.FieldError{Code: "invalid_isbn", Message: "must be a valid ISBN-10 or ISBN-13"}
+		}
+	case "oneof":
+		options := strings.Split(arg, "|")
+		for _, option := range options {
+			if fmt.Sprint(v.Interface()) == option {
+				return nil
+			}
+		}
+		return &apperror.FieldError{Code: "not_allowed", Message: "must be one of " + strings.Join(options, ", ")}
+	default:
+		panic("validate: unknown rule " + name)
+	}
+	return nil
+}
+
+// measure returns what min and max compare against, and its unit for messages.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	panic("validate: min/max on unsupported kind " + v.Kind().String())
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,134 @@
+package validate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"library-api/apperror"
+)
+
+type audience struct {
+	Role string `json:"role" validate:"oneof=member|staff"`
+}
+
+type signup struct {
+	Username string     `json:"username" validate:"required,min=3,max=10"`
+	Email    string     `json:"email" validate:"required,email"`
+	Website  string     `json:"website" validate:"url"`
+	ISBN     string     `json:"isbn" validate:"isbn"`
+	Tags     []string   `json:"tags" validate:"max=2"`
+	Age      int        `json:"age" validate:"min=13"`
+	Audience audience   `json:"audience"`
+	Teams    []audience `json:"teams"`
+}
+
+func fields(errs []apperror.FieldError) map[string]string {
+	out := map[string]string{}
+	for _, e := range errs {
+		out[e.Field] = e.Code
+	}
+	return out
+}
+
+func TestStruct(t *testing.T) {
+	errs := Struct(&signup{
+		Username: "  ",
+		Email:    "Ada <ada@example.com>",
+		Website:  "ftp://example.com",
+		ISBN:     "0-306-40615-3",
+		Tags:     []string{"a", "b", "c"},
+		Age:      5,
+		Audience: audience{Role: "root"},
+		Teams:    []audience{{Role: "staff"}, {Role: "root"}},
+	})
+	assert.Equal(t, map[string]string{
+		"username":      "required",
+		"email":         "invalid_email",
+		"website":       "invalid_url",
+		"isbn":          "invalid_isbn",
+		"tags":          "too_large",
+		"age":           "too_small",
+		"audience.role": "not_allowed",
+		"teams[1].role": "not_allowed",
+	}, fields(errs))
+
+	assert.Empty(t, Struct(&signup{Username: "ada", Email: "ada@example.com"}), "optional fields may be left out")
+}
+
+func decode(body string, dst interface{}) *apperror.Error {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	err := DecodeJSONLimit(httptest.NewRecorder(), r, dst, 256)
+	if err == nil {
+		return nil
+	}
+	return err.(*apperror.Error)
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var s signup
+	require.Nil(t, decode(`{"username": "ada", "email": "ada@example.com"}`, &s))
+	assert.Equal(t, "ada", s.Username)
+
+	err := decode(`{"username": "ada", "email": "ada@example.com", "admin": true}`, &signup{})
+	assert.Equal(t, http.StatusUnprocessableEntity, err.Status)
+	assert.Equal(t, map[string]string{"admin": "unknown_field"}, fields(err.Errors))
+
+	err = decode(`{"username": 7}`, &signup{})
+	assert.Equal(t, map[string]string{"username": "invalid_type"}, fields(err.Errors))
+
+	err = decode(`{"username": "ada"} {}`, &signup{})
+	assert.Equal(t, http.StatusBadRequest, err.Status)
+
+	err = decode(`{"username": "`+strings.Repeat("a", 300)+`"}`, &signup{})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, err.Status)
+
+	err = decode(``, &signup{})
+	assert.Equal(t, http.StatusBadRequest, err.Status)
+
+	err = decode(`{"username": "ad"}`, &signup{})
+	assert.Equal(t, map[string]string{"username": "too_small", "email": "required"}, fields(err.Errors))
+}
+
+func TestUnmarshal(t *testing.T) {
+	var s signup
+	require.NoError(t, Unmarshal([]byte(`{"username": "ada", "email": "ada@example.com"}`), &s))
+	assert.Equal(t, "ada", s.Username)
+
+	err := Unmarshal([]byte(`{"username": "ada", "id": 3}`), &signup{}).(*apperror.Error)
+	assert.Equal(t, map[string]string{"id": "unknown_field"}, fields(err.Errors))
+}
+
+func TestParams(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/books/abc?limit=500&offset=x", nil)
+	r = mux.SetURLVars(r, map[string]string{"id": "abc"})
+	p := NewParams(r)
+	p.PathID("id")
+	p.QueryInt("limit", 10, 1, 100)
+	p.QueryInt("offset", 0, 0, 1000)
+	err := p.Err().(*apperror.Error)
+	assert.Equal(t, http.StatusBadRequest, err.Status)
+	assert.Equal(t, map[string]string{"id": "invalid_id", "limit": "out_of_range", "offset": "invalid_type"}, fields(err.Errors))
+
+	r = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/books/7", nil), map[string]string{"id": "7"})
+	p = NewParams(r)
+	assert.Equal(t, uint(7), p.PathID("id"))
+	assert.Equal(t, 10, p.QueryInt("limit", 10, 1, 100))
+	assert.NoError(t, p.Err())
+}
+
+func TestParams_QueryOptionalBool(t *testing.T) {
+	p := NewParams(httptest.NewRequest(http.MethodGet, "/books?available=false&open=maybe", nil))
+	available := p.QueryOptionalBool("available")
+	if assert.NotNil(t, available) {
+		assert.False(t, *available)
+	}
+	assert.Nil(t, p.QueryOptionalBool("missing"))
+	p.QueryOptionalBool("open")
+	err := p.Err().(*apperror.Error)
+	assert.Equal(t, map[string]string{"open": "invalid_type"}, fields(err.Errors))
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Event types a webhook can subscribe to.
+const (
+	BookCreated = "book.created"
+	BookUpdated = "book.updated"
+	BookDeleted = "book.deleted"
+
+	LoanCreated  = "loan.created"
+	LoanReturned = "loan.returned"
+	LoanOverdue  = "loan.overdue"
+)
+
+var Events = []string{BookCreated, BookUpdated, BookDeleted, LoanCreated, LoanReturned, LoanOverdue}
+
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxAttempts is how often a delivery is tried before it is marked failed.
+const MaxAttempts = 8
+
+// Backoff is the wait before retrying after the given number of failed
+// attempts: 30s, 1m, 2m, ... up to 6h.
+func Backoff(attempts int) time.Duration {
+	wait := 30 * time.Second
+	for i := 1; i < attempts && wait < 6*time.Hour; i++ {
+		wait *= 2
+	}
+	if wait > 6*time.Hour {
+		wait = 6 * time.Hour
+	}
+	return wait
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sign returns the X-Webhook-Signature value: an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret. Receivers should
+// compute the same and reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delivery is one event on its way to one webhook.
+type Delivery struct {
+	ID        uint
+	Event     string
+	URL       string
+	Secret    string
+	Data      []byte // JSON
+	CreatedAt time.Time
+}
+
+// Body is what receivers get.
+type Body struct {
+	ID        uint            `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type Sender struct {
+	Client    *http.Client
+	UserAgent string
+}
+
+func NewSender(timeout time.Duration) *Sender {
+	return &Sender{Client: &http.Client{Timeout: timeout}, UserAgent: "library-api-webhooks/1.0"}
+}
+
+// Send posts the delivery and returns the response status. Anything but a
+// 2xx response is an error.
+func (s *Sender) Send(ctx context.Context, d Delivery) (int, error) {
+	body, err := json.Marshal(Body{ID: d.ID, Event: d.Event, CreatedAt: d.CreatedAt, Data: d.Data})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", s.UserAgent)
+	req.Header.Set("X-Webhook-ID", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(d.Secret, timestamp, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
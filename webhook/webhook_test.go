@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSend_SignsTheBody(t *testing.T) {
+	var got Body
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+		assert.Equal(t, Sign("s3cret", timestamp, body), r.Header.Get("X-Webhook-Signature"))
+		assert.Equal(t, BookCreated, r.Header.Get("X-Webhook-Event"))
+		assert.Equal(t, "12", r.Header.Get("X-Webhook-ID"))
+		json.Unmarshal(body, &got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	status, err := NewSender(time.Second).Send(context.Background(), Delivery{
+		ID: 12, Event: BookCreated, URL: server.URL, Secret: "s3cret", Data: []byte(`{"title":"Dune"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, uint(12), got.ID)
+	assert.JSONEq(t, `{"title":"Dune"}`, string(got.Data))
+}
+
+func TestSend_NonSuccessIsAnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	status, err := NewSender(time.Second).Send(context.Background(), Delivery{URL: server.URL, Data: []byte(`{}`)})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadGateway, status)
+}
+
+func TestSign_DependsOnSecretAndTimestamp(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	assert.Equal(t, Sign("a", 1, body), Sign("a", 1, body))
+	assert.NotEqual(t, Sign("a", 1, body), Sign("b", 1, body))
+	assert.NotEqual(t, Sign("a", 1, body), Sign("a", 2, body))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, 6*time.Hour, Backoff(20))
+}